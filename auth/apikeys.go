@@ -0,0 +1,293 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ScopeCatalogRead cho phép API key đọc dữ liệu trang admin mà không có quyền ghi nào
+const ScopeCatalogRead = "catalog:read"
+
+// Header chứa API key của các script nhập dữ liệu
+const apiKeyHeader = "X-API-Key"
+
+// Tiền tố của mọi API key, giúp nhận ra key bị lộ trong log hoặc mã nguồn
+const apiKeyPrefix = "fw_"
+
+// Lưu API key trong Redis: hash prefix -> thông tin key (JSON, chỉ có mã băm),
+// hash prefix -> thời điểm dùng gần nhất (unix) tách riêng để mỗi request chỉ ghi một trường
+const (
+	apiKeysKey         = "auth:api-keys"
+	apiKeysLastUsedKey = "auth:api-keys:last-used"
+)
+
+// Các lỗi khi tạo hoặc dùng API key
+var (
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	ErrInvalidScope  = errors.New("invalid api key scope")
+	ErrAPIKeyStore   = errors.New("api key store unavailable")
+)
+
+// APIKey là khóa cho client không có người dùng (script nhập dữ liệu), chỉ có các quyền trong Scopes
+type APIKey struct {
+	Prefix    string     `json:"prefix"` // Phần đầu của key, dùng làm ID và hiển thị cho admin
+	Name      string     `json:"name"`
+	Hash      string     `json:"hash,omitempty"` // SHA-256 của toàn bộ key
+	Scopes    []string   `json:"scopes"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+// apiKeyScopes là các scope được cấp cho API key: đọc và ghi nội dung phim, danh mục.
+// Quyền quản lý người dùng, quảng cáo và hệ thống chỉ dành cho tài khoản đăng nhập,
+// để một secret sống lâu không thể dùng để tự nâng quyền
+var apiKeyScopes = []string{
+	ScopeCatalogRead,
+	PermissionMovieWrite,
+	PermissionEpisodeWrite,
+	PermissionQualityWrite,
+	PermissionCatalogWrite,
+}
+
+// APIKeyScopes liệt kê các scope hợp lệ của API key
+func APIKeyScopes() []string {
+	return append([]string(nil), apiKeyScopes...)
+}
+
+// Expired cho biết key đã hết hạn
+func (key *APIKey) Expired() bool {
+	return key.ExpiresAt != nil && !time.Now().Before(*key.ExpiresAt)
+}
+
+// Allows cho biết key có đủ tất cả các quyền yêu cầu.
+// Scope không còn hợp lệ (key cũ được cấp user:manage, system:manage) bị bỏ qua
+func (key *APIKey) Allows(permissions ...string) bool {
+	for _, permission := range permissions {
+		if !validScope(permission) || !key.hasScope(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsAny cho biết key có ít nhất một trong các quyền
+func (key *APIKey) AllowsAny(permissions ...string) bool {
+	for _, permission := range permissions {
+		if key.Allows(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+func (key *APIKey) hasScope(permission string) bool {
+	for _, scope := range key.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func validScope(scope string) bool {
+	for _, value := range apiKeyScopes {
+		if value == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKey tạo API key mới, trả về key đầy đủ (chỉ hiển thị một lần) và thông tin đã lưu
+func CreateAPIKey(name string, scopes []string, createdBy string, expiresAt *time.Time) (string, *APIKey, error) {
+	if redisStore == nil {
+		return "", nil, ErrAPIKeyStore
+	}
+	if len(scopes) == 0 {
+		return "", nil, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return "", nil, ErrInvalidScope
+		}
+	}
+
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	prefix := apiKeyPrefix + hex.EncodeToString(id)
+	plain := prefix + "_" + secret
+	key := &APIKey{
+		Prefix:    prefix,
+		Name:      name,
+		Hash:      hashToken(plain),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", nil, err
+	}
+	// HSETNX để hai key trùng prefix (rất hiếm) không ghi đè lên nhau
+	created, err := redisStore.HSetNX(context.Background(), apiKeysKey, prefix, data).Result()
+	if err != nil {
+		return "", nil, err
+	}
+	if !created {
+		return CreateAPIKey(name, scopes, createdBy, expiresAt)
+	}
+
+	key.Hash = ""
+	return plain, key, nil
+}
+
+// lookupAPIKey tìm key theo prefix và so khớp mã băm của toàn bộ key
+func lookupAPIKey(plain string) (*APIKey, error) {
+	if redisStore == nil || !strings.HasPrefix(plain, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	// Phần secret (base64 URL) có thể chứa "_", prefix dạng hex thì không
+	separator := strings.Index(plain[len(apiKeyPrefix):], "_")
+	if separator <= 0 {
+		return nil, ErrInvalidAPIKey
+	}
+	prefix := plain[:len(apiKeyPrefix)+separator]
+
+	ctx := context.Background()
+	data, err := redisStore.HGet(ctx, apiKeysKey, prefix).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var key APIKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashToken(plain))) != 1 || key.Expired() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err := redisStore.HSet(ctx, apiKeysLastUsedKey, prefix, time.Now().Unix()).Err(); err != nil {
+		log.Println("Error updating api key last used:", err)
+	}
+	key.Hash = ""
+	return &key, nil
+}
+
+// APIKeys liệt kê các API key (không kèm mã băm), key mới tạo đứng đầu
+func APIKeys() ([]*APIKey, error) {
+	if redisStore == nil {
+		return nil, ErrAPIKeyStore
+	}
+
+	ctx := context.Background()
+	entries, err := redisStore.HGetAll(ctx, apiKeysKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	lastUsed, err := redisStore.HGetAll(ctx, apiKeysLastUsedKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*APIKey, 0, len(entries))
+	for prefix, data := range entries {
+		var key APIKey
+		if err := json.Unmarshal([]byte(data), &key); err != nil {
+			continue
+		}
+		key.Hash = ""
+		if value, ok := lastUsed[prefix]; ok {
+			if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+				usedAt := time.Unix(unix, 0)
+				key.LastUsed = &usedAt
+			}
+		}
+		keys = append(keys, &key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// RevokeAPIKey xóa API key, request tiếp theo dùng key này bị từ chối ngay
+func RevokeAPIKey(prefix string) (bool, error) {
+	if redisStore == nil {
+		return false, ErrAPIKeyStore
+	}
+
+	ctx := context.Background()
+	pipe := redisStore.TxPipeline()
+	deleted := pipe.HDel(ctx, apiKeysKey, prefix)
+	pipe.HDel(ctx, apiKeysLastUsedKey, prefix)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return deleted.Val() > 0, nil
+}
+
+// RevokeUserAPIKeys xóa mọi API key do người dùng tạo, dùng khi tài khoản bị khóa, xóa hoặc ẩn danh hóa
+func RevokeUserAPIKeys(userID string) error {
+	if redisStore == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	entries, err := redisStore.HGetAll(ctx, apiKeysKey).Result()
+	if err != nil {
+		return err
+	}
+
+	var prefixes []string
+	for prefix, data := range entries {
+		var key APIKey
+		if err := json.Unmarshal([]byte(data), &key); err == nil && key.CreatedBy == userID {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil
+	}
+
+	pipe := redisStore.TxPipeline()
+	pipe.HDel(ctx, apiKeysKey, prefixes...)
+	pipe.HDel(ctx, apiKeysLastUsedKey, prefixes...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Identity trả về thông tin xác thực của API key, không gắn với vai trò nào
+func (key *APIKey) Identity() *Identity {
+	return &Identity{
+		UserID:   "apikey:" + key.Prefix,
+		Username: key.Name,
+		APIKey:   key,
+	}
+}
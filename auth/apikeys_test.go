@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyIsStoredHashed(t *testing.T) {
+	mr := setupSessions(t)
+
+	plain, key, err := CreateAPIKey("importer", []string{PermissionQualityWrite}, "u1", nil)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(plain, key.Prefix+"_"))
+	assert.Empty(t, key.Hash)
+
+	stored := mr.HGet(apiKeysKey, key.Prefix)
+	assert.NotContains(t, stored, plain)
+	assert.Contains(t, stored, hashToken(plain))
+
+	_, _, err = CreateAPIKey("importer", []string{"movie:delete-everything"}, "u1", nil)
+	assert.Equal(t, ErrInvalidScope, err)
+	_, _, err = CreateAPIKey("importer", nil, "u1", nil)
+	assert.Equal(t, ErrInvalidScope, err)
+}
+
+func TestAuthenticateAcceptsAPIKeyHeader(t *testing.T) {
+	setupSessions(t)
+
+	plain, key, err := CreateAPIKey("importer", []string{ScopeCatalogRead, PermissionQualityWrite}, "u1", nil)
+	assert.NoError(t, err)
+
+	request := httptest.NewRequest(http.MethodPost, "/admin/add-quality", nil)
+	request.Header.Set("X-API-Key", plain)
+	identity, err := Authenticate(request)
+	assert.NoError(t, err)
+	assert.Equal(t, "apikey:"+key.Prefix, identity.UserID)
+	assert.Equal(t, "importer", identity.Username)
+
+	allowed, err := identity.Can(PermissionQualityWrite)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, err = identity.Can(PermissionMovieWrite)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	keys, err := APIKeys()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].LastUsed)
+
+	// Sai secret nhưng đúng prefix
+	request.Header.Set("X-API-Key", key.Prefix+"_wrong")
+	_, err = Authenticate(request)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	deleted, err := RevokeAPIKey(key.Prefix)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	request.Header.Set("X-API-Key", plain)
+	_, err = Authenticate(request)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestExpiredAPIKeyIsRejected(t *testing.T) {
+	setupSessions(t)
+
+	expired := time.Now().Add(-time.Minute)
+	plain, _, err := CreateAPIKey("old", []string{ScopeCatalogRead}, "u1", &expired)
+	assert.NoError(t, err)
+
+	_, err = lookupAPIKey(plain)
+	assert.Equal(t, ErrInvalidAPIKey, err)
+}
+
+func TestRequirePermissionUsesAPIKeyScopes(t *testing.T) {
+	setupSessions(t)
+	gin.SetMode(gin.TestMode)
+
+	plain, _, err := CreateAPIKey("importer", []string{ScopeCatalogRead}, "u1", nil)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/movies", RequireAuth(), RequirePermission(PermissionMovieWrite), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/admin/movies", AuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/movies", nil)
+	request.Header.Set("X-API-Key", plain)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	// Key chỉ đọc vẫn vào được các trang đọc của admin
+	request = httptest.NewRequest(http.MethodGet, "/admin/movies", nil)
+	request.Header.Set("X-API-Key", plain)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestAPIKeysCannotHoldManagementScopes(t *testing.T) {
+	mr := setupSessions(t)
+
+	for _, scope := range []string{PermissionUserManage, PermissionSystemManage, PermissionAdsManage} {
+		_, _, err := CreateAPIKey("importer", []string{ScopeCatalogRead, scope}, "u1", nil)
+		assert.Equal(t, ErrInvalidScope, err, scope)
+	}
+
+	// Key cũ đã được cấp quyền quản lý trước khi giới hạn scope: quyền đó bị bỏ qua
+	plain := apiKeyPrefix + "0badc0de_secret"
+	legacy, err := json.Marshal(&APIKey{
+		Prefix: apiKeyPrefix + "0badc0de",
+		Hash:   hashToken(plain),
+		Scopes: []string{PermissionUserManage, PermissionSystemManage},
+	})
+	assert.NoError(t, err)
+	mr.HSet(apiKeysKey, apiKeyPrefix+"0badc0de", string(legacy))
+
+	request := httptest.NewRequest(http.MethodGet, "/admin/dashboard", nil)
+	request.Header.Set("X-API-Key", plain)
+	identity, err := Authenticate(request)
+	assert.NoError(t, err)
+
+	allowed, err := identity.Can(PermissionUserManage)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+	staff, err := identity.CanAccessAdmin()
+	assert.NoError(t, err)
+	assert.False(t, staff)
+
+	// Key có scope nội dung vẫn vào được trang admin
+	_, key, err := CreateAPIKey("importer", []string{PermissionQualityWrite}, "u1", nil)
+	assert.NoError(t, err)
+	staff, err = key.Identity().CanAccessAdmin()
+	assert.NoError(t, err)
+	assert.True(t, staff)
+}
+
+func TestRevokeUserRevokesAPIKeysTheyCreated(t *testing.T) {
+	mr := setupSessions(t)
+
+	plain, key, err := CreateAPIKey("importer", []string{PermissionMovieWrite}, "u1", nil)
+	assert.NoError(t, err)
+	other, _, err := CreateAPIKey("importer", []string{PermissionMovieWrite}, "u2", nil)
+	assert.NoError(t, err)
+	_, err = lookupAPIKey(plain)
+	assert.NoError(t, err)
+
+	// Tài khoản bị khóa thì key do tài khoản đó tạo không còn dùng được, key của người khác vẫn dùng được
+	assert.NoError(t, RevokeUser("u1"))
+	_, err = lookupAPIKey(plain)
+	assert.Equal(t, ErrInvalidAPIKey, err)
+	assert.Equal(t, "", mr.HGet(apiKeysLastUsedKey, key.Prefix))
+	_, err = lookupAPIKey(other)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Mục đích của token gửi qua email, token của mục đích này không dùng được cho mục đích khác
+const (
+	EmailTokenVerify = "verify"
+	EmailTokenReset  = "reset"
+	EmailTokenChange = "email-change" // Xác minh địa chỉ mới khi người dùng đổi email
+)
+
+// Thời hạn của từng loại token gửi qua email
+var emailTokenLifetimes = map[string]time.Duration{
+	EmailTokenVerify: 24 * time.Hour,
+	EmailTokenReset:  1 * time.Hour,
+	EmailTokenChange: 24 * time.Hour,
+}
+
+// ErrInvalidEmailToken được trả về khi token sai, hết hạn hoặc đã dùng
+var ErrInvalidEmailToken = errors.New("invalid email token")
+
+// emailTokenKey lưu user ID theo mã băm của token, Redis không giữ token gốc
+func emailTokenKey(purpose string, hash string) string {
+	return "auth:email-token:" + purpose + ":" + hash
+}
+
+// userEmailTokenKey trỏ tới token mới nhất của người dùng, gửi token mới thì token cũ hết hiệu lực
+func userEmailTokenKey(purpose string, userID string) string {
+	return "user:" + userID + ":email-token:" + purpose
+}
+
+// EmailTokenLifetime trả về thời hạn của token theo mục đích
+func EmailTokenLifetime(purpose string) time.Duration {
+	return emailTokenLifetimes[purpose]
+}
+
+// CreateEmailToken tạo token dùng một lần để gửi qua email (xác minh email, đặt lại mật khẩu)
+func CreateEmailToken(purpose string, userID string) (string, error) {
+	lifetime, ok := emailTokenLifetimes[purpose]
+	if redisStore == nil || !ok {
+		return "", ErrInvalidEmailToken
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	hash := hashToken(token)
+	previous, err := redisStore.GetSet(ctx, userEmailTokenKey(purpose, userID), hash).Result()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+
+	pipe := redisStore.TxPipeline()
+	if previous != "" {
+		pipe.Del(ctx, emailTokenKey(purpose, previous))
+	}
+	pipe.Set(ctx, emailTokenKey(purpose, hash), userID, lifetime)
+	pipe.Expire(ctx, userEmailTokenKey(purpose, userID), lifetime)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// deleteIfEqualScript xóa key khi giá trị còn bằng ARGV[1], để không xóa con trỏ đã được token mới ghi đè
+var deleteIfEqualScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// ConsumeEmailToken đổi token lấy user ID và xóa token, hai request cùng token chỉ một request thành công
+func ConsumeEmailToken(purpose string, token string) (string, error) {
+	if redisStore == nil || token == "" {
+		return "", ErrInvalidEmailToken
+	}
+
+	ctx := context.Background()
+	hash := hashToken(token)
+	key := emailTokenKey(purpose, hash)
+	pipe := redisStore.TxPipeline()
+	get := pipe.Get(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return "", err
+	}
+
+	userID, err := get.Result()
+	if err == redis.Nil {
+		return "", ErrInvalidEmailToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Chỉ xóa con trỏ khi nó còn trỏ tới token này: token mới gửi trong lúc đó vẫn dùng được
+	if err := deleteIfEqualScript.Run(ctx, redisStore, []string{userEmailTokenKey(purpose, userID)}, hash).Err(); err != nil {
+		return "", err
+	}
+	return userID, nil
+}
+
+// CheckEmailToken cho biết token còn hiệu lực mà không dùng nó (hiển thị form đặt lại mật khẩu)
+func CheckEmailToken(purpose string, token string) (bool, error) {
+	if redisStore == nil || token == "" {
+		return false, nil
+	}
+
+	count, err := redisStore.Exists(context.Background(), emailTokenKey(purpose, hashToken(token))).Result()
+	return count > 0, err
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailTokenIsSingleUseAndHashed(t *testing.T) {
+	mr := setupSessions(t)
+
+	token, err := CreateEmailToken(EmailTokenReset, "u1")
+	assert.NoError(t, err)
+	assert.False(t, mr.Exists(emailTokenKey(EmailTokenReset, token)))
+	assert.True(t, mr.Exists(emailTokenKey(EmailTokenReset, hashToken(token))))
+	assert.Equal(t, EmailTokenLifetime(EmailTokenReset), mr.TTL(emailTokenKey(EmailTokenReset, hashToken(token))))
+
+	valid, err := CheckEmailToken(EmailTokenReset, token)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+
+	// Token đặt lại mật khẩu không dùng được để xác minh email
+	_, err = ConsumeEmailToken(EmailTokenVerify, token)
+	assert.Equal(t, ErrInvalidEmailToken, err)
+
+	userID, err := ConsumeEmailToken(EmailTokenReset, token)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", userID)
+
+	_, err = ConsumeEmailToken(EmailTokenReset, token)
+	assert.Equal(t, ErrInvalidEmailToken, err)
+}
+
+func TestNewEmailTokenReplacesPrevious(t *testing.T) {
+	setupSessions(t)
+
+	first, err := CreateEmailToken(EmailTokenVerify, "u1")
+	assert.NoError(t, err)
+	second, err := CreateEmailToken(EmailTokenVerify, "u1")
+	assert.NoError(t, err)
+
+	_, err = ConsumeEmailToken(EmailTokenVerify, first)
+	assert.Equal(t, ErrInvalidEmailToken, err)
+
+	userID, err := ConsumeEmailToken(EmailTokenVerify, second)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", userID)
+}
+
+func TestConsumeKeepsPointerToNewerToken(t *testing.T) {
+	mr := setupSessions(t)
+
+	first, err := CreateEmailToken(EmailTokenReset, "u1")
+	assert.NoError(t, err)
+
+	// Token mới được gửi đúng lúc token cũ đang được dùng: con trỏ đã trỏ tới token mới
+	// trong khi token cũ vẫn đọc được
+	second, err := CreateEmailToken(EmailTokenReset, "u1")
+	assert.NoError(t, err)
+	mr.Set(emailTokenKey(EmailTokenReset, hashToken(first)), "u1")
+
+	userID, err := ConsumeEmailToken(EmailTokenReset, first)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", userID)
+
+	pointer, err := mr.Get(userEmailTokenKey(EmailTokenReset, "u1"))
+	assert.NoError(t, err)
+	assert.Equal(t, hashToken(second), pointer)
+
+	// Dùng token mới thì con trỏ được xóa
+	_, err = ConsumeEmailToken(EmailTokenReset, second)
+	assert.NoError(t, err)
+	assert.False(t, mr.Exists(userEmailTokenKey(EmailTokenReset, "u1")))
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Tên cookie lưu phiên đăng nhập của trang admin
+const sessionCookieName = "session_token"
+
+// Các lỗi xác thực, dùng để chọn thông báo phù hợp cho người dùng
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidAuthFormat  = errors.New("invalid authorization format")
+	ErrInvalidToken       = errors.New("invalid token")
+)
+
+// Identity là thông tin người dùng đã xác thực, lấy từ claims của token
+type Identity struct {
+	UserID   string
+	Email    string
+	Username string
+	Role     string
+
+	// Session là phiên khi xác thực bằng cookie, nil khi dùng Bearer token
+	Session *Session
+	// TokenID là jti của access token khi xác thực bằng Bearer token
+	TokenID string
+	// APIKey là key khi xác thực bằng header X-API-Key, quyền lấy từ scope của key thay vì vai trò
+	APIKey *APIKey
+}
+
+// IsAdmin cho biết người dùng có quyền admin hay không
+func (identity *Identity) IsAdmin() bool {
+	return identity.Role == "admin"
+}
+
+// Can cho biết người dùng (theo vai trò) hoặc API key (theo scope) có đủ các quyền yêu cầu
+func (identity *Identity) Can(permissions ...string) (bool, error) {
+	if identity.APIKey != nil {
+		return identity.APIKey.Allows(permissions...), nil
+	}
+	return HasPermission(identity.Role, permissions...)
+}
+
+// CanAccessAdmin cho biết người dùng hoặc API key được vào trang admin.
+// Vai trò cần ít nhất một quyền quản trị; API key cần scope đọc hoặc ghi nội dung,
+// scope khác (kể cả của key cũ) không mở được trang admin
+func (identity *Identity) CanAccessAdmin() (bool, error) {
+	if identity.APIKey != nil {
+		return identity.APIKey.AllowsAny(apiKeyScopes...), nil
+	}
+	return IsStaff(identity.Role)
+}
+
+// Authenticate xác thực request bằng cookie phiên, header X-API-Key hoặc header Authorization: Bearer.
+// AuthMiddleware và WebSocket /ws dùng chung hàm này để chấp nhận cùng một loại thông tin đăng nhập.
+// Phiên hợp lệ được gia hạn sau mỗi request.
+func Authenticate(r *http.Request) (*Identity, error) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil && cookie.Value != "" {
+		session, err := LoadSession(cookie.Value)
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+		return session.Identity(), nil
+	}
+
+	if apiKey := r.Header.Get(apiKeyHeader); apiKey != "" {
+		key, err := lookupAPIKey(apiKey)
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+		return key.Identity(), nil
+	}
+
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return nil, ErrInvalidAuthFormat
+	}
+
+	return ParseToken(tokenString)
+}
+
+// ParseToken xác minh chữ ký JWT và trả về thông tin người dùng trong token
+func ParseToken(tokenString string) (*Identity, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.NewValidationError("Unexpected signing method", jwt.ValidationErrorSignatureInvalid)
+		}
+		// Token ký bằng khóa đã thay vẫn hợp lệ cho đến khi khóa hết thời gian xác minh
+		kid, _ := token.Header["kid"].(string)
+		return signingKeys().secret(kid)
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	// Token đã bị thu hồi (đăng xuất, tài khoản bị khóa) không còn hợp lệ dù chưa hết hạn
+	tokenID := claimString(claims, "jti")
+	if revoked, err := IsTokenRevoked(tokenID); err != nil || revoked {
+		return nil, ErrInvalidToken
+	}
+
+	return &Identity{
+		UserID:   claimString(claims, "sub"),
+		Email:    claimString(claims, "email"),
+		Username: claimString(claims, "username"),
+		Role:     claimString(claims, "role"),
+		TokenID:  tokenID,
+	}, nil
+}
+
+func claimString(claims jwt.MapClaims, key string) string {
+	if value, ok := claims[key]; ok && value != nil {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
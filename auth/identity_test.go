@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSessions(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	EnableRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	t.Cleanup(func() { EnableRedisStore(nil) })
+	return mr
+}
+
+func TestAuthenticateAcceptsBearerAndSessionCookie(t *testing.T) {
+	setupSessions(t)
+	token, err := CreateToken("u1", "admin@example.com", "admin", "admin", 1)
+	assert.NoError(t, err)
+
+	request := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	identity, err := Authenticate(request)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, identity.TokenID)
+	identity.TokenID = ""
+	assert.Equal(t, &Identity{UserID: "u1", Email: "admin@example.com", Username: "admin", Role: "admin"}, identity)
+
+	session, err := CreateSession(identity)
+	assert.NoError(t, err)
+
+	request = httptest.NewRequest(http.MethodGet, "/ws", nil)
+	request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: session.ID})
+	identity, err = Authenticate(request)
+	assert.NoError(t, err)
+	assert.True(t, identity.IsAdmin())
+	assert.Equal(t, session.ID, identity.Session.ID)
+}
+
+func TestAuthenticateRejectsInvalidCredentials(t *testing.T) {
+	setupSessions(t)
+	request := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	_, err := Authenticate(request)
+	assert.Equal(t, ErrMissingCredentials, err)
+
+	request.Header.Set("Authorization", "Token abc")
+	_, err = Authenticate(request)
+	assert.Equal(t, ErrInvalidAuthFormat, err)
+
+	// Cookie tự đặt (JSON cũ hoặc JWT) không phải ID phiên trong Redis nên bị từ chối
+	token, err := CreateToken("u1", "admin@example.com", "admin", "admin", 1)
+	assert.NoError(t, err)
+	for _, value := range []string{`{"role":"admin"}`, token} {
+		request = httptest.NewRequest(http.MethodGet, "/ws", nil)
+		request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: value})
+		_, err = Authenticate(request)
+		assert.Equal(t, ErrInvalidToken, err)
+	}
+}
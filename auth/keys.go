@@ -0,0 +1,458 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Khóa Redis lưu bộ khóa ký dùng chung giữa các instance.
+// Secret chỉ được mã hóa base64, không được mã hóa: ai đọc được Redis đều ký được token hợp lệ,
+// nên Redis phải đặt mật khẩu, chỉ mở trong mạng nội bộ và không được sao lưu ra nơi công khai.
+const (
+	signingKeysKey     = "auth:jwt:keys"       // Hash kid -> secret (base64)
+	retiredKeysKey     = "auth:jwt:retired"    // Hash kid -> thời điểm ngừng ký (unix)
+	activeKeyKey       = "auth:jwt:active"     // kid đang dùng để ký
+	configuredKeysKey  = "auth:jwt:configured" // Set các kid lấy từ cấu hình (JWT_KEYS, JWT_SECRET)
+	signingKeysChannel = "auth:jwt:rotated"    // Báo các instance tải lại bộ khóa
+)
+
+// ErrUnknownKey được trả về khi token không có kid hoặc kid không còn trong bộ khóa
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type signingKey struct {
+	secret    []byte
+	retiredAt time.Time // Zero khi khóa chưa bị thay
+}
+
+// KeyInfo mô tả một khóa ký, không kèm secret
+type KeyInfo struct {
+	ID        string     `json:"kid"`
+	Active    bool       `json:"active"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// KeySet là bộ khóa HMAC dùng để ký và xác minh JWT. Token mới được ký bằng khóa active,
+// token ký bằng khóa đã thay vẫn được xác minh cho đến khi hết hạn.
+type KeySet struct {
+	mutex  sync.RWMutex
+	active string
+	keys   map[string]*signingKey
+	redis  *redis.Client
+
+	// configured là true khi bộ khóa lấy từ biến môi trường thay vì sinh ngẫu nhiên,
+	// pinned là true khi JWT_ACTIVE_KID chỉ định khóa active
+	configured bool
+	pinned     bool
+}
+
+// LoadKeySet đọc bộ khóa từ biến môi trường:
+// JWT_KEYS="kid1:secret1,kid2:secret2" và JWT_ACTIVE_KID (mặc định là khóa đầu tiên),
+// hoặc JWT_SECRET cho cấu hình một khóa. Không có cấu hình thì sinh khóa ngẫu nhiên.
+func LoadKeySet() *KeySet {
+	keySet := &KeySet{keys: make(map[string]*signingKey)}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_KEYS"), ",") {
+		kid, secret, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || kid == "" || secret == "" {
+			continue
+		}
+		keySet.keys[kid] = &signingKey{secret: []byte(secret)}
+		if keySet.active == "" {
+			keySet.active = kid
+		}
+	}
+
+	if kid := os.Getenv("JWT_ACTIVE_KID"); kid != "" {
+		if _, ok := keySet.keys[kid]; ok {
+			keySet.active = kid
+			keySet.pinned = true
+		} else {
+			log.Printf("JWT_ACTIVE_KID %q không có trong JWT_KEYS, dùng khóa %q", kid, keySet.active)
+		}
+	}
+
+	if keySet.active == "" {
+		if secret := os.Getenv("JWT_SECRET"); secret != "" {
+			keySet.active = "default"
+			keySet.keys["default"] = &signingKey{secret: []byte(secret)}
+		}
+	}
+	keySet.configured = keySet.active != ""
+
+	if keySet.active == "" {
+		// Token sẽ mất hiệu lực khi khởi động lại và không dùng chung được giữa các instance
+		log.Println("Chưa cấu hình JWT_KEYS hoặc JWT_SECRET, dùng khóa ký ngẫu nhiên")
+		kid, key := newSigningKey()
+		keySet.active = kid
+		keySet.keys[kid] = key
+	}
+
+	return keySet
+}
+
+func newSigningKey() (string, *signingKey) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		log.Fatal("Không thể tạo khóa ký JWT: ", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal("Không thể tạo khóa ký JWT: ", err)
+	}
+	return time.Now().UTC().Format("20060102") + "-" + hex.EncodeToString(id), &signingKey{secret: secret}
+}
+
+// activeKey trả về kid và secret dùng để ký token mới
+func (keySet *KeySet) activeKey() (string, []byte) {
+	keySet.mutex.RLock()
+	defer keySet.mutex.RUnlock()
+
+	return keySet.active, keySet.keys[keySet.active].secret
+}
+
+// secret trả về secret của kid nếu khóa còn dùng để xác minh được
+func (keySet *KeySet) secret(kid string) ([]byte, error) {
+	keySet.mutex.RLock()
+	defer keySet.mutex.RUnlock()
+
+	key, ok := keySet.keys[kid]
+	if !ok || key.expired() {
+		return nil, ErrUnknownKey
+	}
+	return key.secret, nil
+}
+
+// expired cho biết khóa đã ngừng ký đủ lâu để mọi access token do nó ký đều đã hết hạn
+func (key *signingKey) expired() bool {
+	return !key.retiredAt.IsZero() && time.Since(key.retiredAt) > AccessTokenLifetime
+}
+
+// Keys liệt kê các khóa còn hiệu lực, khóa active đứng đầu
+func (keySet *KeySet) Keys() []KeyInfo {
+	keySet.mutex.RLock()
+	defer keySet.mutex.RUnlock()
+
+	infos := make([]KeyInfo, 0, len(keySet.keys))
+	for kid, key := range keySet.keys {
+		if key.expired() {
+			continue
+		}
+		info := KeyInfo{ID: kid, Active: kid == keySet.active}
+		if !key.retiredAt.IsZero() {
+			retiredAt := key.retiredAt
+			info.RetiredAt = &retiredAt
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Active != infos[j].Active {
+			return infos[i].Active
+		}
+		return infos[i].ID > infos[j].ID
+	})
+	return infos
+}
+
+// Rotate sinh khóa mới làm khóa active, khóa cũ chỉ còn dùng để xác minh.
+// Khi có Redis, khóa mới được lưu vào Redis và các instance khác tải lại ngay.
+func (keySet *KeySet) Rotate() (string, error) {
+	kid, key := newSigningKey()
+
+	keySet.mutex.RLock()
+	client := keySet.redis
+	keySet.mutex.RUnlock()
+
+	if client == nil {
+		keySet.mutex.Lock()
+		defer keySet.mutex.Unlock()
+
+		if previous, ok := keySet.keys[keySet.active]; ok {
+			previous.retiredAt = time.Now()
+		}
+		keySet.keys[kid] = key
+		keySet.active = kid
+		keySet.prune()
+		return kid, nil
+	}
+
+	ctx := context.Background()
+	if err := client.HSet(ctx, signingKeysKey, kid, base64.StdEncoding.EncodeToString(key.secret)).Err(); err != nil {
+		return "", err
+	}
+
+	// GETSET để hai lần thay khóa đồng thời không làm mất khóa nào: mỗi lần chỉ đánh dấu
+	// khóa mà chính nó thay thế
+	previous, err := client.GetSet(ctx, activeKeyKey, kid).Result()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+	if previous != "" {
+		if err := client.HSet(ctx, retiredKeysKey, previous, time.Now().Unix()).Err(); err != nil {
+			return "", err
+		}
+	}
+
+	if err := keySet.reload(); err != nil {
+		return "", err
+	}
+	client.Publish(ctx, signingKeysChannel, kid)
+	return kid, nil
+}
+
+// prune xóa các khóa đã hết thời gian xác minh, cần giữ mutex ghi
+func (keySet *KeySet) prune() {
+	for kid, key := range keySet.keys {
+		if key.expired() {
+			delete(keySet.keys, kid)
+		}
+	}
+}
+
+// EnableRedis dùng Redis làm nơi lưu bộ khóa chung và theo dõi việc thay khóa từ instance khác.
+// Mỗi lần khởi động, bộ khóa cấu hình được đối chiếu với Redis (xem reconcile); khóa sinh ngẫu nhiên
+// chỉ được ghi khi Redis chưa có khóa nào. Các khóa thay bằng Rotate chỉ có trong Redis.
+func (keySet *KeySet) EnableRedis(client *redis.Client) error {
+	ctx := context.Background()
+
+	keySet.mutex.RLock()
+	seed := make(map[string]string, len(keySet.keys))
+	for kid, key := range keySet.keys {
+		seed[kid] = base64.StdEncoding.EncodeToString(key.secret)
+	}
+	active := keySet.active
+	configured, pinned := keySet.configured, keySet.pinned
+	keySet.mutex.RUnlock()
+
+	if configured {
+		if err := reconcile(ctx, client, seed, active, pinned); err != nil {
+			return err
+		}
+	} else {
+		// Ghi khóa trước rồi mới đặt kid active, để instance khác không đọc được kid chưa có secret
+		exists, err := client.Exists(ctx, activeKeyKey).Result()
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			for kid, secret := range seed {
+				if err := client.HSetNX(ctx, signingKeysKey, kid, secret).Err(); err != nil {
+					return err
+				}
+			}
+			if err := client.SetNX(ctx, activeKeyKey, active, 0).Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	pubsub := client.Subscribe(ctx, signingKeysChannel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	keySet.mutex.Lock()
+	keySet.redis = client
+	keySet.mutex.Unlock()
+
+	if err := keySet.reload(); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go func() {
+		defer pubsub.Close()
+		for range pubsub.Channel() {
+			if err := keySet.reload(); err != nil {
+				log.Println("Error reloading JWT signing keys:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// reconcile đối chiếu bộ khóa cấu hình với Redis và ghi log mọi khác biệt:
+//   - khóa mới trong cấu hình được thêm vào, secret khác với Redis thì secret trong cấu hình được dùng;
+//   - khóa từng lấy từ cấu hình nhưng nay bị bỏ thì ngừng ký, chỉ còn xác minh token cũ đến khi hết hạn;
+//   - JWT_ACTIVE_KID luôn được áp dụng; không đặt thì giữ khóa active trong Redis (có thể do Rotate sinh ra),
+//     trừ khi khóa đó vừa bị bỏ khỏi cấu hình.
+func reconcile(ctx context.Context, client *redis.Client, seed map[string]string, active string, pinned bool) error {
+	stored, err := client.HGetAll(ctx, signingKeysKey).Result()
+	if err != nil {
+		return err
+	}
+	previouslyConfigured, err := client.SMembers(ctx, configuredKeysKey).Result()
+	if err != nil {
+		return err
+	}
+	current, err := client.Get(ctx, activeKeyKey).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	changed := false
+	kids := make([]interface{}, 0, len(seed))
+	for kid, secret := range seed {
+		kids = append(kids, kid)
+		value, ok := stored[kid]
+		if ok && value == secret {
+			continue
+		}
+		if ok {
+			log.Printf("CẢNH BÁO: secret của khóa ký JWT %q trong cấu hình khác với Redis, dùng secret trong cấu hình; token đã ký bằng secret cũ bị từ chối", kid)
+		} else {
+			log.Printf("Thêm khóa ký JWT %q từ cấu hình vào Redis", kid)
+		}
+		// Ghi khóa trước rồi mới đặt kid active, để instance khác không đọc được kid chưa có secret
+		if err := client.HSet(ctx, signingKeysKey, kid, secret).Err(); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if err := client.SAdd(ctx, configuredKeysKey, kids...).Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	dropped := make(map[string]bool)
+	for _, kid := range previouslyConfigured {
+		if _, ok := seed[kid]; ok {
+			continue
+		}
+		dropped[kid] = true
+		if _, ok := stored[kid]; ok {
+			log.Printf("Khóa ký JWT %q đã bị bỏ khỏi cấu hình, ngừng ký và chỉ xác minh token cũ đến khi hết hạn", kid)
+			// HSETNX giữ nguyên thời điểm ngừng ký nếu khóa đã bị thay trước đó
+			if err := client.HSetNX(ctx, retiredKeysKey, kid, now).Err(); err != nil {
+				return err
+			}
+			changed = true
+		}
+		if err := client.SRem(ctx, configuredKeysKey, kid).Err(); err != nil {
+			return err
+		}
+	}
+
+	target := current
+	if _, ok := stored[current]; pinned || !ok || dropped[current] {
+		target = active
+	}
+	if target != current {
+		log.Printf("Đổi khóa ký JWT active từ %q sang %q theo cấu hình", current, target)
+		previous, err := client.GetSet(ctx, activeKeyKey, target).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if previous != "" && previous != target {
+			if err := client.HSetNX(ctx, retiredKeysKey, previous, now).Err(); err != nil {
+				return err
+			}
+		}
+		changed = true
+	}
+	if err := client.HDel(ctx, retiredKeysKey, target).Err(); err != nil {
+		return err
+	}
+
+	if changed {
+		client.Publish(ctx, signingKeysChannel, target)
+	}
+	return nil
+}
+
+// reload đọc lại bộ khóa từ Redis và xóa các khóa đã hết thời gian xác minh
+func (keySet *KeySet) reload() error {
+	ctx := context.Background()
+
+	secrets, err := keySet.redis.HGetAll(ctx, signingKeysKey).Result()
+	if err != nil {
+		return err
+	}
+	retired, err := keySet.redis.HGetAll(ctx, retiredKeysKey).Result()
+	if err != nil {
+		return err
+	}
+	active, err := keySet.redis.Get(ctx, activeKeyKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(secrets))
+	var expired []string
+	for kid, encoded := range secrets {
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			log.Printf("Khóa ký JWT %q trong Redis không hợp lệ: %v", kid, err)
+			continue
+		}
+
+		key := &signingKey{secret: secret}
+		if value, ok := retired[kid]; ok && kid != active {
+			if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+				key.retiredAt = time.Unix(unix, 0)
+			}
+		}
+		if key.expired() {
+			expired = append(expired, kid)
+			continue
+		}
+		keys[kid] = key
+	}
+
+	if _, ok := keys[active]; !ok {
+		return ErrUnknownKey
+	}
+
+	if len(expired) > 0 {
+		keySet.redis.HDel(ctx, signingKeysKey, expired...)
+		keySet.redis.HDel(ctx, retiredKeysKey, expired...)
+	}
+
+	keySet.mutex.Lock()
+	keySet.keys = keys
+	keySet.active = active
+	keySet.mutex.Unlock()
+	return nil
+}
+
+var (
+	defaultKeysOnce sync.Once
+	defaultKeys     *KeySet
+)
+
+// signingKeys trả về bộ khóa của ứng dụng, nạp từ môi trường ở lần dùng đầu tiên
+// (sau khi main đã đọc file .env)
+func signingKeys() *KeySet {
+	defaultKeysOnce.Do(func() {
+		defaultKeys = LoadKeySet()
+	})
+	return defaultKeys
+}
+
+// EnableKeyRotation chia sẻ bộ khóa ký của ứng dụng qua Redis để thay khóa không cần khởi động lại
+func EnableKeyRotation(client *redis.Client) error {
+	return signingKeys().EnableRedis(client)
+}
+
+// RotateSigningKey thay khóa ký của ứng dụng và trả về kid mới
+func RotateSigningKey() (string, error) {
+	return signingKeys().Rotate()
+}
+
+// SigningKeys liệt kê các khóa ký còn hiệu lực của ứng dụng
+func SigningKeys() []KeyInfo {
+	return signingKeys().Keys()
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func signWith(t *testing.T, keySet *KeySet) string {
+	kid, secret := keySet.activeKey()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u1", "exp": time.Now().Add(time.Hour).Unix()})
+	token.Header["kid"] = kid
+	tokenString, err := token.SignedString(secret)
+	assert.NoError(t, err)
+	return tokenString
+}
+
+func verifyWith(keySet *KeySet, tokenString string) error {
+	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return keySet.secret(kid)
+	})
+	return err
+}
+
+func TestLoadKeySetFromEnv(t *testing.T) {
+	t.Setenv("JWT_KEYS", "2024a:first-secret, 2024b:second-secret")
+	t.Setenv("JWT_ACTIVE_KID", "2024b")
+
+	keySet := LoadKeySet()
+	kid, secret := keySet.activeKey()
+	assert.Equal(t, "2024b", kid)
+	assert.Equal(t, []byte("second-secret"), secret)
+
+	// Token ký bằng khóa chưa active trong cấu hình vẫn được xác minh
+	old, err := keySet.secret("2024a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("first-secret"), old)
+
+	t.Setenv("JWT_KEYS", "")
+	t.Setenv("JWT_ACTIVE_KID", "")
+	t.Setenv("JWT_SECRET", "single-secret")
+	kid, secret = LoadKeySet().activeKey()
+	assert.Equal(t, "default", kid)
+	assert.Equal(t, []byte("single-secret"), secret)
+}
+
+func TestRotateKeepsRetiredKeysUntilTokensExpire(t *testing.T) {
+	t.Setenv("JWT_KEYS", "old:old-secret")
+	keySet := LoadKeySet()
+	oldToken := signWith(t, keySet)
+
+	kid, err := keySet.Rotate()
+	assert.NoError(t, err)
+	assert.NotEqual(t, "old", kid)
+
+	assert.NoError(t, verifyWith(keySet, oldToken))
+	assert.NoError(t, verifyWith(keySet, signWith(t, keySet)))
+
+	// Hết thời hạn token thì khóa cũ không còn được chấp nhận
+	keySet.keys["old"].retiredAt = time.Now().Add(-AccessTokenLifetime - time.Minute)
+	assert.Error(t, verifyWith(keySet, oldToken))
+	assert.Len(t, keySet.Keys(), 1)
+}
+
+func TestParseTokenRejectsUnknownKid(t *testing.T) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "u1"})
+	token.Header["kid"] = "forged"
+	tokenString, err := token.SignedString([]byte("nguyen-secret-key"))
+	assert.NoError(t, err)
+
+	_, err = ParseToken(tokenString)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestRotationIsSharedThroughRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	t.Setenv("JWT_KEYS", "seed:seed-secret")
+	first := LoadKeySet()
+	assert.NoError(t, first.EnableRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()})))
+
+	// Instance thứ hai có thêm khóa trong cấu hình nhưng vẫn dùng khóa active đã có trong Redis
+	t.Setenv("JWT_KEYS", "seed:seed-secret,other:other-secret")
+	second := LoadKeySet()
+	assert.NoError(t, second.EnableRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()})))
+	assert.NoError(t, verifyWith(second, signWith(t, first)))
+
+	oldToken := signWith(t, second)
+	kid, err := first.Rotate()
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		active, _ := second.activeKey()
+		return active == kid
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, verifyWith(first, signWith(t, second)))
+	assert.NoError(t, verifyWith(second, oldToken))
+	assert.True(t, mr.Exists(retiredKeysKey))
+}
+
+func TestEnableRedisReconcilesConfiguredKeys(t *testing.T) {
+	mr := miniredis.RunT(t)
+	boot := func(keys string, active string) *KeySet {
+		t.Setenv("JWT_KEYS", keys)
+		t.Setenv("JWT_ACTIVE_KID", active)
+		keySet := LoadKeySet()
+		assert.NoError(t, keySet.EnableRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()})))
+		return keySet
+	}
+
+	first := boot("a:a-secret", "")
+	rotated, err := first.Rotate()
+	assert.NoError(t, err)
+	rotatedToken := signWith(t, first)
+
+	// Khóa mới trong cấu hình được thêm, JWT_ACTIVE_KID được áp dụng dù Redis đang dùng khóa khác
+	second := boot("a:a-secret,b:b-secret", "b")
+	active, _ := second.activeKey()
+	assert.Equal(t, "b", active)
+	assert.NoError(t, verifyWith(second, rotatedToken))
+
+	// Không đặt JWT_ACTIVE_KID thì giữ khóa active trong Redis
+	third := boot("b:b-secret,a:a-secret", "")
+	active, _ = third.activeKey()
+	assert.Equal(t, "b", active)
+
+	// Khóa bị bỏ khỏi cấu hình ngừng ký nhưng vẫn xác minh token cũ, khóa sinh bằng Rotate được giữ
+	aToken := signWith(t, boot("a:a-secret,b:b-secret", "a"))
+	fourth := boot("b:b-secret", "")
+	active, _ = fourth.activeKey()
+	assert.Equal(t, "b", active)
+	assert.NoError(t, verifyWith(fourth, aToken))
+	for _, info := range fourth.Keys() {
+		assert.Equal(t, info.ID != "b", info.RetiredAt != nil, info.ID)
+	}
+	assert.NotEmpty(t, mr.HGet(signingKeysKey, rotated))
+	configured, err := mr.Members(configuredKeysKey)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, configured)
+
+	// Secret trong cấu hình được dùng khi khác với Redis
+	fifth := boot("b:new-b-secret", "")
+	_, secret := fifth.activeKey()
+	assert.Equal(t, []byte("new-b-secret"), secret)
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Các quyền gán cho vai trò trong collection roles
+const (
+	PermissionMovieWrite   = "movie:write"
+	PermissionEpisodeWrite = "episode:write"
+	PermissionQualityWrite = "quality:write"
+	PermissionCatalogWrite = "catalog:write" // Danh mục, thể loại, quốc gia, server
+	PermissionUserManage   = "user:manage"
+	PermissionAdsManage    = "ads:manage"
+	PermissionSystemManage = "system:manage" // Khóa ký JWT, số liệu WebSocket
+)
+
+// Permissions liệt kê mọi quyền, dùng để kiểm tra dữ liệu khi lưu vai trò
+var Permissions = []string{
+	PermissionMovieWrite,
+	PermissionEpisodeWrite,
+	PermissionQualityWrite,
+	PermissionCatalogWrite,
+	PermissionUserManage,
+	PermissionAdsManage,
+	PermissionSystemManage,
+}
+
+// adminRole luôn có mọi quyền, kể cả khi chưa có bản ghi trong collection roles
+const adminRole = "admin"
+
+// Cache quyền của các vai trò: hash tên vai trò -> danh sách quyền (JSON)
+const (
+	rolePermissionsKey = "auth:role-permissions"
+	rolePermissionsTTL = 10 * time.Minute
+)
+
+// PermissionLoader đọc danh sách quyền của một vai trò từ MongoDB
+type PermissionLoader func(ctx context.Context, role string) ([]string, error)
+
+var loadPermissions PermissionLoader = func(ctx context.Context, role string) ([]string, error) {
+	return nil, nil
+}
+
+// SetPermissionLoader đặt hàm đọc quyền của vai trò, gọi khi khởi động sau khi kết nối MongoDB
+func SetPermissionLoader(loader PermissionLoader) {
+	loadPermissions = loader
+}
+
+// RolePermissions trả về các quyền của vai trò, ưu tiên cache trong Redis
+func RolePermissions(role string) ([]string, error) {
+	if role == adminRole {
+		return Permissions, nil
+	}
+
+	ctx := context.Background()
+	if redisStore != nil {
+		cached, err := redisStore.HGet(ctx, rolePermissionsKey, role).Result()
+		if err == nil {
+			var permissions []string
+			if json.Unmarshal([]byte(cached), &permissions) == nil {
+				return permissions, nil
+			}
+		} else if err != redis.Nil {
+			log.Println("Error reading role permissions cache:", err)
+		}
+	}
+
+	permissions, err := loadPermissions(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+
+	if redisStore != nil {
+		// Lưu cả danh sách rỗng để vai trò không có quyền không truy vấn MongoDB mỗi request
+		data, _ := json.Marshal(permissions)
+		pipe := redisStore.TxPipeline()
+		pipe.HSet(ctx, rolePermissionsKey, role, data)
+		pipe.Expire(ctx, rolePermissionsKey, rolePermissionsTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Println("Error caching role permissions:", err)
+		}
+	}
+	return permissions, nil
+}
+
+// InvalidateRolePermissions xóa cache quyền sau khi thêm, sửa hoặc xóa vai trò
+func InvalidateRolePermissions() error {
+	if redisStore == nil {
+		return nil
+	}
+	return redisStore.Del(context.Background(), rolePermissionsKey).Err()
+}
+
+// HasPermission cho biết vai trò có đủ tất cả các quyền yêu cầu hay không
+func HasPermission(role string, permissions ...string) (bool, error) {
+	granted, err := RolePermissions(role)
+	if err != nil {
+		return false, err
+	}
+
+	for _, permission := range permissions {
+		found := false
+		for _, value := range granted {
+			if value == permission {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// IsStaff cho biết vai trò có ít nhất một quyền quản trị, tức là được vào trang admin
+func IsStaff(role string) (bool, error) {
+	granted, err := RolePermissions(role)
+	return len(granted) > 0, err
+}
+
+// RequirePermission chỉ cho phép request tiếp tục khi vai trò của người dùng (hoặc scope của API key) có đủ các quyền,
+// dùng sau AuthMiddleware (cần "identity" trong context)
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("identity")
+		identity, ok := value.(*Identity)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		allowed, err := identity.Can(permissions...)
+		if err != nil {
+			log.Println("Error loading role permissions:", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !allowed {
+			log.Printf("Access denied: %q (role %q) lacks %v", identity.Username, identity.Role, permissions)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+			return
+		}
+
+		c.Next()
+	}
+}
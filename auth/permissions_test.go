@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubPermissions thay MongoDB bằng bảng vai trò cố định và đếm số lần đọc
+func stubPermissions(t *testing.T, roles map[string][]string) *int {
+	loads := 0
+	previous := loadPermissions
+	SetPermissionLoader(func(ctx context.Context, role string) ([]string, error) {
+		loads++
+		return roles[role], nil
+	})
+	t.Cleanup(func() { SetPermissionLoader(previous) })
+	return &loads
+}
+
+func TestRolePermissionsAreCachedInRedis(t *testing.T) {
+	mr := setupSessions(t)
+	loads := stubPermissions(t, map[string][]string{"editor": {PermissionEpisodeWrite}})
+
+	for i := 0; i < 3; i++ {
+		allowed, err := HasPermission("editor", PermissionEpisodeWrite)
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	assert.Equal(t, 1, *loads)
+	assert.True(t, mr.Exists(rolePermissionsKey))
+
+	// Sửa vai trò thì cache bị xóa và quyền được đọc lại
+	assert.NoError(t, InvalidateRolePermissions())
+	_, err := HasPermission("editor", PermissionEpisodeWrite)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *loads)
+}
+
+func TestRequirePermission(t *testing.T) {
+	setupSessions(t)
+	stubPermissions(t, map[string][]string{"editor": {PermissionEpisodeWrite, PermissionQualityWrite}})
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	admin := router.Group("/admin", AuthMiddleware())
+	admin.DELETE("/delete-episode/:id", RequirePermission(PermissionEpisodeWrite), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	admin.DELETE("/delete-movie/:id", RequirePermission(PermissionMovieWrite), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := func(role string, path string) int {
+		session, err := CreateSession(&Identity{UserID: "u-" + role, Role: role})
+		assert.NoError(t, err)
+
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: session.ID})
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	// Biên tập viên quản lý tập phim nhưng không xóa được phim
+	assert.Equal(t, http.StatusOK, request("editor", "/admin/delete-episode/1"))
+	assert.Equal(t, http.StatusForbidden, request("editor", "/admin/delete-movie/1"))
+
+	// Admin luôn có mọi quyền
+	assert.Equal(t, http.StatusOK, request("admin", "/admin/delete-movie/1"))
+
+	// Vai trò không có quyền quản trị không vào được trang admin
+	assert.Equal(t, http.StatusFound, request("customer", "/admin/delete-episode/1"))
+}
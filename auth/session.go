@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// SessionIdleTimeout là thời gian phiên còn hiệu lực kể từ request cuối cùng
+	SessionIdleTimeout = 1 * time.Hour
+	// SessionMaxLifetime giới hạn tổng thời gian của một phiên dù vẫn được gia hạn
+	SessionMaxLifetime = 7 * 24 * time.Hour
+)
+
+// ErrSessionNotFound được trả về khi phiên không tồn tại, đã hết hạn hoặc đã đăng xuất
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session là phiên đăng nhập lưu trong Redis, cookie chỉ chứa ID ngẫu nhiên của phiên
+type Session struct {
+	ID        string    `json:"-"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func sessionKey(id string) string {
+	return "session:" + id
+}
+
+// userSessionsKey là tập ID phiên của một người dùng, dùng để đăng xuất mọi thiết bị
+func userSessionsKey(userID string) string {
+	return "user:" + userID + ":sessions"
+}
+
+var redisStore *redis.Client
+
+// EnableRedisStore lưu phiên đăng nhập, refresh token và danh sách token bị thu hồi trong Redis
+func EnableRedisStore(client *redis.Client) {
+	redisStore = client
+}
+
+// randomToken sinh chuỗi ngẫu nhiên an toàn dài size byte, mã hóa base64 cho URL
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CreateSession tạo phiên mới cho người dùng đã xác thực
+func CreateSession(identity *Identity) (*Session, error) {
+	if redisStore == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	id, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:        id,
+		UserID:    identity.UserID,
+		Email:     identity.Email,
+		Username:  identity.Username,
+		Role:      identity.Role,
+		CreatedAt: now,
+		ExpiresAt: now.Add(SessionIdleTimeout),
+	}
+	if err := saveSession(session, false); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// saveSession ghi phiên vào Redis. Khi gia hạn chỉ ghi nếu phiên còn tồn tại,
+// để request đang chạy không khôi phục phiên vừa bị đăng xuất.
+func saveSession(session *Session, renew bool) error {
+	ctx := context.Background()
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	pipe := redisStore.TxPipeline()
+	if renew {
+		pipe.SetXX(ctx, sessionKey(session.ID), data, time.Until(session.ExpiresAt))
+	} else {
+		pipe.Set(ctx, sessionKey(session.ID), data, time.Until(session.ExpiresAt))
+	}
+	pipe.SAdd(ctx, userSessionsKey(session.UserID), session.ID)
+	pipe.Expire(ctx, userSessionsKey(session.UserID), SessionMaxLifetime)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// LoadSession đọc phiên theo ID và gia hạn thêm SessionIdleTimeout (sliding renewal),
+// không vượt quá SessionMaxLifetime kể từ lúc đăng nhập
+func LoadSession(id string) (*Session, error) {
+	if redisStore == nil || id == "" {
+		return nil, ErrSessionNotFound
+	}
+
+	data, err := redisStore.Get(context.Background(), sessionKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{ID: id}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	now := time.Now()
+	if !now.Before(session.ExpiresAt) {
+		return nil, ErrSessionNotFound
+	}
+
+	expiresAt := now.Add(SessionIdleTimeout)
+	if limit := session.CreatedAt.Add(SessionMaxLifetime); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	session.ExpiresAt = expiresAt
+	if err := saveSession(session, true); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// DeleteSession xóa một phiên của người dùng (đăng xuất thiết bị hiện tại)
+func DeleteSession(id string, userID string) error {
+	if redisStore == nil {
+		return ErrSessionNotFound
+	}
+
+	ctx := context.Background()
+	pipe := redisStore.TxPipeline()
+	pipe.Del(ctx, sessionKey(id))
+	pipe.SRem(ctx, userSessionsKey(userID), id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// DeleteUserSessions xóa mọi phiên của người dùng (đăng xuất tất cả thiết bị)
+func DeleteUserSessions(userID string) error {
+	if redisStore == nil {
+		return ErrSessionNotFound
+	}
+
+	ctx := context.Background()
+	ids, err := redisStore.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{userSessionsKey(userID)}
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id))
+	}
+	return redisStore.Del(ctx, keys...).Err()
+}
+
+// SetSessionCookie ghi ID phiên vào cookie, hết hạn cùng lúc với phiên
+func SetSessionCookie(w http.ResponseWriter, session *Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    session.ID,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSessionCookie xóa cookie phiên trên trình duyệt
+func ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Identity trả về thông tin người dùng của phiên
+func (session *Session) Identity() *Identity {
+	return &Identity{
+		UserID:   session.UserID,
+		Email:    session.Email,
+		Username: session.Username,
+		Role:     session.Role,
+		Session:  session,
+	}
+}
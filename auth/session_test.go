@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionSlidingRenewal(t *testing.T) {
+	mr := setupSessions(t)
+
+	session, err := CreateSession(&Identity{UserID: "u1", Role: "admin"})
+	assert.NoError(t, err)
+	assert.InDelta(t, SessionIdleTimeout, mr.TTL(sessionKey(session.ID)), float64(time.Second))
+
+	// Mỗi request gia hạn phiên thêm SessionIdleTimeout
+	mr.FastForward(SessionIdleTimeout - time.Minute)
+	loaded, err := LoadSession(session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", loaded.UserID)
+	assert.InDelta(t, SessionIdleTimeout, mr.TTL(sessionKey(session.ID)), float64(time.Second))
+
+	// Không request nào trong SessionIdleTimeout thì phiên hết hạn
+	mr.FastForward(SessionIdleTimeout + time.Second)
+	_, err = LoadSession(session.ID)
+	assert.Equal(t, ErrSessionNotFound, err)
+}
+
+func TestSessionMaxLifetime(t *testing.T) {
+	setupSessions(t)
+
+	session, err := CreateSession(&Identity{UserID: "u1"})
+	assert.NoError(t, err)
+
+	// Phiên đăng nhập gần đủ SessionMaxLifetime chỉ được gia hạn tới mốc đó
+	session.CreatedAt = time.Now().Add(-SessionMaxLifetime + time.Minute)
+	assert.NoError(t, saveSession(session, true))
+
+	loaded, err := LoadSession(session.ID)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, session.CreatedAt.Add(SessionMaxLifetime), loaded.ExpiresAt, time.Second)
+}
+
+func TestLogoutAllDevices(t *testing.T) {
+	setupSessions(t)
+
+	first, err := CreateSession(&Identity{UserID: "u1"})
+	assert.NoError(t, err)
+	second, err := CreateSession(&Identity{UserID: "u1"})
+	assert.NoError(t, err)
+	other, err := CreateSession(&Identity{UserID: "u2"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, DeleteSession(first.ID, "u1"))
+	_, err = LoadSession(first.ID)
+	assert.Equal(t, ErrSessionNotFound, err)
+	_, err = LoadSession(second.ID)
+	assert.NoError(t, err)
+
+	assert.NoError(t, DeleteUserSessions("u1"))
+	_, err = LoadSession(second.ID)
+	assert.Equal(t, ErrSessionNotFound, err)
+	_, err = LoadSession(other.ID)
+	assert.NoError(t, err)
+}
+
+func TestAuthMiddlewareRefreshesSessionCookie(t *testing.T) {
+	setupSessions(t)
+	gin.SetMode(gin.TestMode)
+
+	session, err := CreateSession(&Identity{UserID: "u1", Role: "admin"})
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/admin/dashboard", AuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/admin/dashboard", nil)
+	request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: session.ID})
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	cookie := recorder.Result().Cookies()[0]
+	assert.Equal(t, session.ID, cookie.Value)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+
+	// Sau khi đăng xuất, cookie cũ bị chuyển về trang đăng nhập
+	assert.NoError(t, DeleteSession(session.ID, "u1"))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusFound, recorder.Code)
+}
@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Giới hạn đăng nhập sai: vượt giới hạn thì bị khóa tạm thời, thời gian khóa tăng gấp đôi
+// sau mỗi lần sai tiếp theo (exponential backoff) cho tới loginLockoutMax
+const (
+	loginFailureWindow  = 15 * time.Minute // Bộ đếm lần sai được giữ trong khoảng này
+	accountFailureLimit = 5                // Số lần sai cho một tài khoản trước khi khóa
+	ipFailureLimit      = 20               // Số lần sai từ một IP (mọi tài khoản) trước khi chặn
+	loginLockoutBase    = 1 * time.Minute
+	loginLockoutMax     = 1 * time.Hour
+)
+
+// Giới hạn số email tài khoản (quên mật khẩu, gửi lại email xác minh) theo địa chỉ email và theo IP
+const (
+	accountEmailWindow  = 1 * time.Hour
+	accountEmailLimit   = 3  // Số email gửi tới một địa chỉ trong accountEmailWindow
+	accountEmailIPLimit = 20 // Số yêu cầu từ một IP (mọi địa chỉ) trong accountEmailWindow
+)
+
+// LoginFailure là kết quả sau khi ghi nhận một lần đăng nhập sai
+type LoginFailure struct {
+	Failures int           // Số lần sai liên tiếp của tài khoản
+	Locked   bool          // Tài khoản vừa bị khóa bởi lần sai này
+	Retry    time.Duration // Thời gian phải chờ trước khi thử lại, 0 nếu chưa bị khóa
+}
+
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginFailuresKey(kind string, value string) string {
+	return "login:failures:" + kind + ":" + value
+}
+
+func loginLockKey(kind string, value string) string {
+	return "login:locked:" + kind + ":" + value
+}
+
+// lockoutDuration tính thời gian khóa khi số lần sai vượt giới hạn
+func lockoutDuration(failures int, limit int) time.Duration {
+	if failures < limit {
+		return 0
+	}
+
+	duration := loginLockoutBase
+	for i := limit; i < failures && duration < loginLockoutMax; i++ {
+		duration *= 2
+	}
+	if duration > loginLockoutMax {
+		duration = loginLockoutMax
+	}
+	return duration
+}
+
+// LoginRetryAfter trả về thời gian còn bị khóa của tài khoản hoặc IP, 0 nếu được phép đăng nhập
+func LoginRetryAfter(email string, ip string) (time.Duration, error) {
+	if redisStore == nil {
+		return 0, nil
+	}
+
+	ctx := context.Background()
+	pipe := redisStore.Pipeline()
+	account := pipe.PTTL(ctx, loginLockKey("account", accountKey(email)))
+	address := pipe.PTTL(ctx, loginLockKey("ip", ip))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	retry := account.Val()
+	if address.Val() > retry {
+		retry = address.Val()
+	}
+	if retry < 0 {
+		// PTTL trả về số âm khi khóa không tồn tại
+		return 0, nil
+	}
+	return retry, nil
+}
+
+// RecordLoginFailure tăng bộ đếm lần sai của tài khoản và IP, khóa tạm thời khi vượt giới hạn.
+// Bộ đếm được tính cả với email không tồn tại để phản hồi không để lộ tài khoản nào có thật.
+func RecordLoginFailure(email string, ip string) (*LoginFailure, error) {
+	if redisStore == nil {
+		return &LoginFailure{}, nil
+	}
+
+	ctx := context.Background()
+	account := accountKey(email)
+
+	pipe := redisStore.TxPipeline()
+	accountFailures := pipe.Incr(ctx, loginFailuresKey("account", account))
+	ipFailures := pipe.Incr(ctx, loginFailuresKey("ip", ip))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	result := &LoginFailure{Failures: int(accountFailures.Val())}
+	accountLock := lockoutDuration(result.Failures, accountFailureLimit)
+	ipLock := lockoutDuration(int(ipFailures.Val()), ipFailureLimit)
+
+	// Giữ bộ đếm lâu hơn thời gian khóa để lần sai sau khi hết khóa tiếp tục tăng thời gian khóa
+	pipe = redisStore.TxPipeline()
+	pipe.Expire(ctx, loginFailuresKey("account", account), loginFailureWindow+accountLock)
+	pipe.Expire(ctx, loginFailuresKey("ip", ip), loginFailureWindow+ipLock)
+	if accountLock > 0 {
+		pipe.Set(ctx, loginLockKey("account", account), result.Failures, accountLock)
+	}
+	if ipLock > 0 {
+		pipe.Set(ctx, loginLockKey("ip", ip), ipFailures.Val(), ipLock)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	result.Locked = accountLock > 0
+	result.Retry = accountLock
+	if ipLock > result.Retry {
+		result.Retry = ipLock
+	}
+	return result, nil
+}
+
+// ResetLoginFailures xóa bộ đếm của tài khoản sau khi đăng nhập thành công.
+// Bộ đếm theo IP được giữ nguyên để kẻ tấn công không tự xóa bằng tài khoản của mình.
+func ResetLoginFailures(email string) error {
+	if redisStore == nil {
+		return nil
+	}
+	return redisStore.Del(context.Background(), loginFailuresKey("account", accountKey(email))).Err()
+}
+
+// TwoFactorRetryAfter trả về thời gian người dùng còn bị chặn nhập mã TOTP hoặc recovery code, 0 nếu được phép
+func TwoFactorRetryAfter(userID string) (time.Duration, error) {
+	if redisStore == nil {
+		return 0, nil
+	}
+
+	retry, err := redisStore.PTTL(context.Background(), loginLockKey("totp", userID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if retry < 0 {
+		return 0, nil
+	}
+	return retry, nil
+}
+
+// RecordTwoFactorFailure đếm lần nhập sai mã của người dùng trên mọi bước cần TOTP (đăng nhập, tắt 2FA,
+// tạo lại recovery code) với cùng giới hạn như bước TOTP khi đăng nhập, trả về thời gian bị chặn nếu vượt giới hạn
+func RecordTwoFactorFailure(userID string) (time.Duration, error) {
+	if redisStore == nil {
+		return 0, nil
+	}
+
+	ctx := context.Background()
+	failures, err := redisStore.Incr(ctx, loginFailuresKey("totp", userID)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	lock := lockoutDuration(int(failures), preAuthMaxAttempts)
+	pipe := redisStore.TxPipeline()
+	pipe.Expire(ctx, loginFailuresKey("totp", userID), loginFailureWindow+lock)
+	if lock > 0 {
+		pipe.Set(ctx, loginLockKey("totp", userID), failures, lock)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return lock, nil
+}
+
+// ResetTwoFactorFailures xóa bộ đếm nhập sai mã sau khi người dùng nhập đúng
+func ResetTwoFactorFailures(userID string) error {
+	if redisStore == nil {
+		return nil
+	}
+	return redisStore.Del(context.Background(), loginFailuresKey("totp", userID)).Err()
+}
+
+func accountEmailKey(kind string, value string) string {
+	return "account-email:requests:" + kind + ":" + value
+}
+
+// RecordAccountEmailRequest đếm yêu cầu gửi email tài khoản của địa chỉ email và IP, trả về thời gian
+// phải chờ khi vượt giới hạn. Đếm cả email không tồn tại để phản hồi không để lộ tài khoản nào có thật.
+func RecordAccountEmailRequest(email string, ip string) (time.Duration, error) {
+	if redisStore == nil {
+		return 0, nil
+	}
+
+	ctx := context.Background()
+	emailKey := accountEmailKey("email", accountKey(email))
+	ipKey := accountEmailKey("ip", ip)
+
+	pipe := redisStore.TxPipeline()
+	emailRequests := pipe.Incr(ctx, emailKey)
+	ipRequests := pipe.Incr(ctx, ipKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	// Cửa sổ cố định bắt đầu từ yêu cầu đầu tiên
+	pipe = redisStore.TxPipeline()
+	if emailRequests.Val() == 1 {
+		pipe.Expire(ctx, emailKey, accountEmailWindow)
+	}
+	if ipRequests.Val() == 1 {
+		pipe.Expire(ctx, ipKey, accountEmailWindow)
+	}
+	emailTTL := pipe.PTTL(ctx, emailKey)
+	ipTTL := pipe.PTTL(ctx, ipKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	var retry time.Duration
+	if emailRequests.Val() > accountEmailLimit {
+		retry = emailTTL.Val()
+	}
+	if ipRequests.Val() > accountEmailIPLimit && ipTTL.Val() > retry {
+		retry = ipTTL.Val()
+	}
+	return retry, nil
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountLockedAfterRepeatedFailures(t *testing.T) {
+	setupSessions(t)
+
+	for i := 1; i < accountFailureLimit; i++ {
+		failure, err := RecordLoginFailure("User@Example.com", "10.0.0.1")
+		assert.NoError(t, err)
+		assert.False(t, failure.Locked)
+		assert.Equal(t, i, failure.Failures)
+	}
+
+	retry, err := LoginRetryAfter("user@example.com", "10.0.0.2")
+	assert.NoError(t, err)
+	assert.Zero(t, retry)
+
+	failure, err := RecordLoginFailure("user@example.com", "10.0.0.1")
+	assert.NoError(t, err)
+	assert.True(t, failure.Locked)
+	assert.Equal(t, loginLockoutBase, failure.Retry)
+
+	// Khóa theo tài khoản, đổi IP cũng không đăng nhập được
+	retry, err = LoginRetryAfter(" USER@example.com ", "10.0.0.2")
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(loginLockoutBase), float64(retry), float64(time.Second))
+}
+
+func TestLockoutDoublesUpToMax(t *testing.T) {
+	assert.Zero(t, lockoutDuration(accountFailureLimit-1, accountFailureLimit))
+	assert.Equal(t, loginLockoutBase, lockoutDuration(accountFailureLimit, accountFailureLimit))
+	assert.Equal(t, 2*loginLockoutBase, lockoutDuration(accountFailureLimit+1, accountFailureLimit))
+	assert.Equal(t, 4*loginLockoutBase, lockoutDuration(accountFailureLimit+2, accountFailureLimit))
+	assert.Equal(t, loginLockoutMax, lockoutDuration(accountFailureLimit+50, accountFailureLimit))
+}
+
+func TestIPBlockedAcrossAccounts(t *testing.T) {
+	setupSessions(t)
+
+	var failure *LoginFailure
+	var err error
+	for i := 0; i < ipFailureLimit; i++ {
+		failure, err = RecordLoginFailure("user"+string(rune('a'+i))+"@example.com", "10.0.0.9")
+		assert.NoError(t, err)
+	}
+	assert.False(t, failure.Locked)
+	assert.Equal(t, loginLockoutBase, failure.Retry)
+
+	retry, err := LoginRetryAfter("other@example.com", "10.0.0.9")
+	assert.NoError(t, err)
+	assert.Greater(t, retry, time.Duration(0))
+
+	retry, err = LoginRetryAfter("other@example.com", "10.0.0.10")
+	assert.NoError(t, err)
+	assert.Zero(t, retry)
+}
+
+func TestResetLoginFailures(t *testing.T) {
+	setupSessions(t)
+
+	for i := 0; i < accountFailureLimit-1; i++ {
+		_, err := RecordLoginFailure("user@example.com", "10.0.0.1")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, ResetLoginFailures("user@example.com"))
+
+	failure, err := RecordLoginFailure("user@example.com", "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failure.Failures)
+	assert.False(t, failure.Locked)
+}
+
+func TestTwoFactorFailuresLockUser(t *testing.T) {
+	setupSessions(t)
+
+	for i := 1; i < preAuthMaxAttempts; i++ {
+		retry, err := RecordTwoFactorFailure("u1")
+		assert.NoError(t, err)
+		assert.Zero(t, retry)
+	}
+	assert.NoError(t, ResetTwoFactorFailures("u1"))
+
+	// Đúng mã thì bộ đếm về 0, sai tiếp đủ giới hạn mới bị chặn
+	for i := 1; i < preAuthMaxAttempts; i++ {
+		_, err := RecordTwoFactorFailure("u1")
+		assert.NoError(t, err)
+	}
+	retry, err := RecordTwoFactorFailure("u1")
+	assert.NoError(t, err)
+	assert.Equal(t, loginLockoutBase, retry)
+
+	retry, err = TwoFactorRetryAfter("u1")
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(loginLockoutBase), float64(retry), float64(time.Second))
+
+	// Chặn theo người dùng, người khác không bị ảnh hưởng
+	retry, err = TwoFactorRetryAfter("u2")
+	assert.NoError(t, err)
+	assert.Zero(t, retry)
+}
+
+func TestAccountEmailRequestsAreLimited(t *testing.T) {
+	setupSessions(t)
+
+	for i := 0; i < accountEmailLimit; i++ {
+		retry, err := RecordAccountEmailRequest("User@Example.com", "10.0.0.1")
+		assert.NoError(t, err)
+		assert.Zero(t, retry)
+	}
+	retry, err := RecordAccountEmailRequest("user@example.com", "10.0.0.2")
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(accountEmailWindow), float64(retry), float64(time.Second))
+
+	// Giới hạn theo IP áp dụng cho mọi địa chỉ email
+	for i := 0; i < accountEmailIPLimit-accountEmailLimit; i++ {
+		retry, err = RecordAccountEmailRequest("other"+strconv.Itoa(i)+"@example.com", "10.0.0.1")
+		assert.NoError(t, err)
+		assert.Zero(t, retry)
+	}
+	retry, err = RecordAccountEmailRequest("fresh@example.com", "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Positive(t, retry)
+}
@@ -0,0 +1,271 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// AccessTokenLifetime là thời hạn của access token, ngắn để token bị lộ nhanh chóng vô dụng
+	AccessTokenLifetime = 15 * time.Minute
+	// RefreshTokenLifetime là thời hạn của refresh token dùng để xin access token mới
+	RefreshTokenLifetime = 30 * 24 * time.Hour
+)
+
+// Các lỗi khi dùng refresh token
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// TokenPair là cặp access token và refresh token trả về khi đăng nhập hoặc làm mới
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Số giây access token còn hiệu lực
+}
+
+// denylistKey đánh dấu access token đã bị thu hồi cho tới khi nó hết hạn
+func denylistKey(tokenID string) string {
+	return "auth:denylist:" + tokenID
+}
+
+// userTokensKey là ZSET jti -> thời điểm hết hạn của các access token của người dùng
+func userTokensKey(userID string) string {
+	return "user:" + userID + ":tokens"
+}
+
+// refreshKey lưu refresh token theo mã băm, Redis không giữ token gốc
+func refreshKey(hash string) string {
+	return "refresh:" + hash
+}
+
+// refreshFamilyKey là tập mã băm các refresh token cùng một lần đăng nhập
+func refreshFamilyKey(family string) string {
+	return "refresh:family:" + family
+}
+
+// userFamiliesKey là tập các lần đăng nhập (family) còn refresh token của người dùng
+func userFamiliesKey(userID string) string {
+	return "user:" + userID + ":refresh"
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// trackToken ghi nhận access token mới của người dùng, bỏ các token đã hết hạn
+func trackToken(userID string, tokenID string, expiresAt time.Time) error {
+	if redisStore == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	pipe := redisStore.TxPipeline()
+	pipe.ZAdd(ctx, userTokensKey(userID), &redis.Z{Score: float64(expiresAt.Unix()), Member: tokenID})
+	pipe.ZRemRangeByScore(ctx, userTokensKey(userID), "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+	pipe.Expire(ctx, userTokensKey(userID), AccessTokenLifetime)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// IsTokenRevoked cho biết access token đã bị thu hồi hay chưa
+func IsTokenRevoked(tokenID string) (bool, error) {
+	if redisStore == nil || tokenID == "" {
+		return false, nil
+	}
+
+	count, err := redisStore.Exists(context.Background(), denylistKey(tokenID)).Result()
+	return count > 0, err
+}
+
+// RevokeToken thu hồi một access token cho tới khi nó hết hạn
+func RevokeToken(tokenID string) error {
+	if redisStore == nil || tokenID == "" {
+		return nil
+	}
+	return redisStore.Set(context.Background(), denylistKey(tokenID), 1, AccessTokenLifetime).Err()
+}
+
+// IssueTokens tạo access token và refresh token mới. family rỗng khi đăng nhập,
+// khi làm mới thì refresh token mới thuộc cùng family với token vừa dùng.
+func IssueTokens(identity *Identity, status int, family string) (*TokenPair, error) {
+	if redisStore == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	accessToken, tokenID, err := createToken(identity.UserID, identity.Email, identity.Username, identity.Role, status)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if family == "" {
+		if family, err = randomToken(16); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.Background()
+	hash := hashToken(refreshToken)
+	pipe := redisStore.TxPipeline()
+	pipe.HSet(ctx, refreshKey(hash), map[string]interface{}{
+		"user_id": identity.UserID,
+		"family":  family,
+		"jti":     tokenID, // Access token cấp cùng lúc, thu hồi theo khi phát hiện dùng lại
+		"uses":    0,
+	})
+	pipe.Expire(ctx, refreshKey(hash), RefreshTokenLifetime)
+	pipe.SAdd(ctx, refreshFamilyKey(family), hash)
+	pipe.Expire(ctx, refreshFamilyKey(family), RefreshTokenLifetime)
+	pipe.SAdd(ctx, userFamiliesKey(identity.UserID), family)
+	pipe.Expire(ctx, userFamiliesKey(identity.UserID), RefreshTokenLifetime)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenLifetime.Seconds()),
+	}, nil
+}
+
+// useRefreshTokenScript đánh dấu refresh token đã dùng và trả về số lần dùng,
+// chạy nguyên tử để hai request đồng thời không cùng đổi được một token
+var useRefreshTokenScript = redis.NewScript(`
+local data = redis.call('HMGET', KEYS[1], 'user_id', 'family')
+if not data[1] then
+	return false
+end
+local uses = redis.call('HINCRBY', KEYS[1], 'uses', 1)
+return {data[1], data[2], uses}
+`)
+
+// UseRefreshToken đổi refresh token lấy user ID và family để cấp cặp token mới.
+// Refresh token chỉ dùng được một lần: dùng lại token cũ nghĩa là token đã bị lộ,
+// cả family (mọi refresh token và access token của lần đăng nhập đó) bị thu hồi.
+func UseRefreshToken(refreshToken string) (string, string, error) {
+	if redisStore == nil || refreshToken == "" {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	result, err := useRefreshTokenScript.Run(context.Background(), redisStore, []string{refreshKey(hashToken(refreshToken))}).Result()
+	if err == redis.Nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 3 {
+		return "", "", ErrInvalidRefreshToken
+	}
+	userID, _ := values[0].(string)
+	family, _ := values[1].(string)
+	uses, _ := values[2].(int64)
+
+	if uses > 1 {
+		if err := RevokeFamily(family); err != nil {
+			return "", "", err
+		}
+		return "", "", ErrRefreshTokenReused
+	}
+	return userID, family, nil
+}
+
+// RevokeRefreshToken thu hồi lần đăng nhập chứa refresh token (dùng khi đăng xuất)
+func RevokeRefreshToken(refreshToken string) error {
+	if redisStore == nil || refreshToken == "" {
+		return nil
+	}
+
+	family, err := redisStore.HGet(context.Background(), refreshKey(hashToken(refreshToken)), "family").Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return RevokeFamily(family)
+}
+
+// RevokeFamily xóa mọi refresh token của một lần đăng nhập và thu hồi các access token đi kèm
+func RevokeFamily(family string) error {
+	ctx := context.Background()
+	hashes, err := redisStore.SMembers(ctx, refreshFamilyKey(family)).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{refreshFamilyKey(family)}
+	for _, hash := range hashes {
+		tokenID, err := redisStore.HGet(ctx, refreshKey(hash), "jti").Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err := RevokeToken(tokenID); err != nil {
+			return err
+		}
+		keys = append(keys, refreshKey(hash))
+	}
+	return redisStore.Del(ctx, keys...).Err()
+}
+
+// RevokeUser thu hồi ngay mọi quyền truy cập của người dùng: access token còn hạn,
+// refresh token, phiên đăng nhập và API key người dùng đã tạo. Dùng khi tài khoản bị khóa hoặc bị xóa.
+func RevokeUser(userID string) error {
+	if redisStore == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	tokens, err := redisStore.ZRangeByScoreWithScores(ctx, userTokensKey(userID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(now.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := redisStore.TxPipeline()
+	for _, token := range tokens {
+		// Giữ trong danh sách thu hồi tới khi token hết hạn, thêm 1 giây vì exp làm tròn theo giây
+		ttl := time.Until(time.Unix(int64(token.Score), 0)) + time.Second
+		pipe.Set(ctx, denylistKey(token.Member.(string)), 1, ttl)
+	}
+	pipe.Del(ctx, userTokensKey(userID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	families, err := redisStore.SMembers(ctx, userFamiliesKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if err := RevokeFamily(family); err != nil {
+			return err
+		}
+	}
+	if err := redisStore.Del(ctx, userFamiliesKey(userID)).Err(); err != nil {
+		return err
+	}
+	if err := RevokeUserAPIKeys(userID); err != nil {
+		return err
+	}
+
+	return DeleteUserSessions(userID)
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func authenticateBearer(token string) (*Identity, error) {
+	request := httptest.NewRequest(http.MethodGet, "/admin/dashboard", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	return Authenticate(request)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	mr := setupSessions(t)
+	identity := &Identity{UserID: "u1", Role: "admin"}
+
+	first, err := IssueTokens(identity, 1, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int(AccessTokenLifetime.Seconds()), first.ExpiresIn)
+
+	// Redis chỉ lưu mã băm của refresh token
+	assert.False(t, mr.Exists(refreshKey(first.RefreshToken)))
+	assert.True(t, mr.Exists(refreshKey(hashToken(first.RefreshToken))))
+
+	userID, family, err := UseRefreshToken(first.RefreshToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", userID)
+
+	second, err := IssueTokens(identity, 1, family)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	_, _, err = UseRefreshToken("unknown")
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	setupSessions(t)
+	identity := &Identity{UserID: "u1", Role: "admin"}
+
+	first, err := IssueTokens(identity, 1, "")
+	assert.NoError(t, err)
+	_, family, err := UseRefreshToken(first.RefreshToken)
+	assert.NoError(t, err)
+	second, err := IssueTokens(identity, 1, family)
+	assert.NoError(t, err)
+
+	// Lần đăng nhập khác của cùng người dùng không bị ảnh hưởng
+	other, err := IssueTokens(identity, 1, "")
+	assert.NoError(t, err)
+
+	// Dùng lại refresh token đã đổi: thu hồi toàn bộ family, kể cả token mới nhất
+	_, _, err = UseRefreshToken(first.RefreshToken)
+	assert.Equal(t, ErrRefreshTokenReused, err)
+
+	_, _, err = UseRefreshToken(second.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+	_, err = authenticateBearer(second.AccessToken)
+	assert.Equal(t, ErrInvalidToken, err)
+
+	_, err = authenticateBearer(other.AccessToken)
+	assert.NoError(t, err)
+	_, _, err = UseRefreshToken(other.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestRevokeUserDeniesTokensAndSessions(t *testing.T) {
+	setupSessions(t)
+	identity := &Identity{UserID: "u1", Role: "admin"}
+
+	tokens, err := IssueTokens(identity, 1, "")
+	assert.NoError(t, err)
+	session, err := CreateSession(identity)
+	assert.NoError(t, err)
+
+	authenticated, err := authenticateBearer(tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, authenticated.TokenID)
+
+	assert.NoError(t, RevokeUser("u1"))
+
+	_, err = authenticateBearer(tokens.AccessToken)
+	assert.Equal(t, ErrInvalidToken, err)
+	_, _, err = UseRefreshToken(tokens.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+	_, err = LoadSession(session.ID)
+	assert.Equal(t, ErrSessionNotFound, err)
+}
+
+func TestRevokeToken(t *testing.T) {
+	setupSessions(t)
+
+	token, err := CreateToken("u1", "admin@example.com", "admin", "admin", 1)
+	assert.NoError(t, err)
+	identity, err := authenticateBearer(token)
+	assert.NoError(t, err)
+
+	assert.NoError(t, RevokeToken(identity.TokenID))
+	_, err = authenticateBearer(token)
+	assert.Equal(t, ErrInvalidToken, err)
+}
@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Tham số TOTP theo RFC 6238, dùng giá trị mặc định mà mọi ứng dụng xác thực đều hỗ trợ
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+	totpSkew   = 1 // Chấp nhận mã của bước liền trước và liền sau để bù lệch đồng hồ
+	TOTPIssuer = "Fire Watch"
+)
+
+const (
+	// PreAuthTokenLifetime là thời gian để nhập mã TOTP sau khi nhập đúng mật khẩu
+	PreAuthTokenLifetime = 5 * time.Minute
+	preAuthMaxAttempts   = 5
+	// Secret đang đăng ký chỉ có hiệu lực khi người dùng xác nhận bằng một mã trong thời gian này
+	pendingTOTPLifetime = 10 * time.Minute
+	recoveryCodeCount   = 10
+)
+
+// ErrInvalidPreAuthToken được trả về khi pre-auth token không tồn tại, hết hạn hoặc nhập sai quá nhiều lần
+var ErrInvalidPreAuthToken = errors.New("invalid pre-auth token")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func preAuthKey(hash string) string {
+	return "auth:preauth:" + hash
+}
+
+func pendingTOTPKey(userID string) string {
+	return "auth:totp:pending:" + userID
+}
+
+// totpUsedKey đánh dấu bước thời gian đã dùng để một mã không đăng nhập được hai lần
+func totpUsedKey(userID string, step int64) string {
+	return "auth:totp:used:" + userID + ":" + strconv.FormatInt(step, 10)
+}
+
+// RequireAdminTwoFactor đọc cờ REQUIRE_ADMIN_2FA: bật thì mọi tài khoản được vào trang admin phải dùng TOTP
+func RequireAdminTwoFactor() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_ADMIN_2FA"))
+	return required
+}
+
+// TwoFactorRequired cho biết vai trò có bắt buộc bật xác thực hai bước hay không
+func TwoFactorRequired(role string) (bool, error) {
+	if !RequireAdminTwoFactor() {
+		return false, nil
+	}
+	return IsStaff(role)
+}
+
+// GenerateTOTPSecret sinh secret 160 bit mã hóa base32 để nhập vào ứng dụng xác thực
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPProvisioningURI tạo URI otpauth:// để client hiển thị thành mã QR
+func TOTPProvisioningURI(secret string, account string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", TOTPIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totpDigits))
+	query.Set("period", strconv.Itoa(int(totpPeriod.Seconds())))
+
+	label := url.PathEscape(TOTPIssuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// hotp tính mã một lần theo RFC 4226 cho bộ đếm counter
+func hotp(key []byte, counter uint64) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo)
+}
+
+// matchTOTP trả về bước thời gian khớp với mã, -1 nếu mã sai
+func matchTOTP(secret string, code string, now time.Time) int64 {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil || len(code) != totpDigits {
+		return -1
+	}
+
+	step := now.Unix() / int64(totpPeriod.Seconds())
+	for i := -totpSkew; i <= totpSkew; i++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(step+int64(i)))), []byte(code)) == 1 {
+			return step + int64(i)
+		}
+	}
+	return -1
+}
+
+// VerifyTOTP kiểm tra mã TOTP của người dùng, mỗi mã chỉ được chấp nhận một lần
+func VerifyTOTP(userID string, secret string, code string) (bool, error) {
+	step := matchTOTP(secret, strings.ReplaceAll(code, " ", ""), time.Now())
+	if step < 0 {
+		return false, nil
+	}
+	if redisStore == nil {
+		return true, nil
+	}
+
+	// Giữ dấu tới khi bước thời gian nằm ngoài khoảng được chấp nhận
+	fresh, err := redisStore.SetNX(context.Background(), totpUsedKey(userID, step), 1, (2*totpSkew+1)*totpPeriod).Result()
+	if err != nil {
+		return false, err
+	}
+	return fresh, nil
+}
+
+// normalizeRecoveryCode bỏ khoảng trắng, dấu gạch và chữ hoa mà người dùng có thể gõ thêm
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+// HashRecoveryCode trả về mã băm của recovery code để lưu trên tài liệu User
+func HashRecoveryCode(code string) string {
+	return hashToken(normalizeRecoveryCode(code))
+}
+
+// GenerateRecoveryCodes sinh các recovery code dùng một lần, trả về mã gốc (chỉ hiển thị một lần) và mã băm
+func GenerateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 10)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		value := strings.ToLower(totpEncoding.EncodeToString(buf))
+		code := value[:5] + "-" + value[5:10] + "-" + value[10:15]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// SetPendingTOTPSecret lưu secret đang đăng ký cho tới khi người dùng xác nhận bằng một mã đúng
+func SetPendingTOTPSecret(userID string, secret string) error {
+	if redisStore == nil {
+		return ErrSessionNotFound
+	}
+	return redisStore.Set(context.Background(), pendingTOTPKey(userID), secret, pendingTOTPLifetime).Err()
+}
+
+// PendingTOTPSecret trả về secret đang đăng ký, chuỗi rỗng nếu chưa đăng ký hoặc đã hết hạn
+func PendingTOTPSecret(userID string) (string, error) {
+	if redisStore == nil {
+		return "", nil
+	}
+	secret, err := redisStore.Get(context.Background(), pendingTOTPKey(userID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return secret, err
+}
+
+// ClearPendingTOTPSecret xóa secret đang đăng ký sau khi bật xác thực hai bước
+func ClearPendingTOTPSecret(userID string) error {
+	if redisStore == nil {
+		return nil
+	}
+	return redisStore.Del(context.Background(), pendingTOTPKey(userID)).Err()
+}
+
+// CreatePreAuthToken tạo token ngắn hạn sau khi mật khẩu đúng, chỉ dùng để hoàn tất bước TOTP
+func CreatePreAuthToken(userID string) (string, error) {
+	if redisStore == nil {
+		return "", ErrInvalidPreAuthToken
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	pipe := redisStore.TxPipeline()
+	pipe.HSet(ctx, preAuthKey(hashToken(token)), map[string]interface{}{"user_id": userID, "attempts": 0})
+	pipe.Expire(ctx, preAuthKey(hashToken(token)), PreAuthTokenLifetime)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// PreAuthUser trả về user ID của pre-auth token
+func PreAuthUser(token string) (string, error) {
+	if redisStore == nil || token == "" {
+		return "", ErrInvalidPreAuthToken
+	}
+
+	userID, err := redisStore.HGet(context.Background(), preAuthKey(hashToken(token)), "user_id").Result()
+	if err == redis.Nil {
+		return "", ErrInvalidPreAuthToken
+	}
+	return userID, err
+}
+
+// RecordPreAuthFailure đếm lần nhập sai mã, hủy token khi sai quá preAuthMaxAttempts lần
+func RecordPreAuthFailure(token string) error {
+	if redisStore == nil || token == "" {
+		return nil
+	}
+
+	ctx := context.Background()
+	key := preAuthKey(hashToken(token))
+	if count, err := redisStore.Exists(ctx, key).Result(); err != nil || count == 0 {
+		// Token đã hết hạn, không tạo lại key không có TTL
+		return err
+	}
+
+	attempts, err := redisStore.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		return err
+	}
+	if attempts >= preAuthMaxAttempts {
+		return DeletePreAuthToken(token)
+	}
+	return nil
+}
+
+// DeletePreAuthToken hủy pre-auth token sau khi đã dùng
+func DeletePreAuthToken(token string) error {
+	if redisStore == nil || token == "" {
+		return nil
+	}
+	return redisStore.Del(context.Background(), preAuthKey(hashToken(token))).Err()
+}
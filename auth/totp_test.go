@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Secret "12345678901234567890" của các vector thử trong RFC 6238 (SHA1), mã 6 chữ số
+var rfcSecret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPMatchesRFCVectors(t *testing.T) {
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, code := range vectors {
+		now := time.Unix(unix, 0)
+		assert.Equal(t, unix/30, matchTOTP(rfcSecret, code, now), "t=%d", unix)
+	}
+
+	// Mã của bước liền trước vẫn được chấp nhận, cách hai bước thì không
+	assert.Equal(t, int64(1), matchTOTP(rfcSecret, "287082", time.Unix(89, 0)))
+	assert.Equal(t, int64(-1), matchTOTP(rfcSecret, "287082", time.Unix(120, 0)))
+	assert.Equal(t, int64(-1), matchTOTP(rfcSecret, "000000", time.Unix(59, 0)))
+}
+
+func TestVerifyTOTPRejectsReplay(t *testing.T) {
+	setupSessions(t)
+
+	secret, err := GenerateTOTPSecret()
+	assert.NoError(t, err)
+	key, _ := totpEncoding.DecodeString(secret)
+	code := hotp(key, uint64(time.Now().Unix()/30))
+
+	ok, err := VerifyTOTP("u1", secret, code)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = VerifyTOTP("u1", secret, code)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("JBSWY3DPEHPK3PXP", "admin@example.com"))
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/"+TOTPIssuer+":admin@example.com", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, TOTPIssuer, uri.Query().Get("issuer"))
+}
+
+func TestRecoveryCodesAreHashed(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Len(t, hashes, recoveryCodeCount)
+
+	for i, code := range codes {
+		assert.NotEqual(t, code, hashes[i])
+		// Người dùng gõ chữ hoa hoặc bỏ dấu gạch vẫn khớp
+		assert.Equal(t, hashes[i], HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", ""))))
+	}
+}
+
+func TestPreAuthTokenExpiresAfterFailedAttempts(t *testing.T) {
+	setupSessions(t)
+
+	token, err := CreatePreAuthToken("u1")
+	assert.NoError(t, err)
+
+	userID, err := PreAuthUser(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", userID)
+
+	for i := 0; i < preAuthMaxAttempts; i++ {
+		assert.NoError(t, RecordPreAuthFailure(token))
+	}
+	_, err = PreAuthUser(token)
+	assert.Equal(t, ErrInvalidPreAuthToken, err)
+}
+
+func TestTwoFactorRequiredForStaffOnly(t *testing.T) {
+	stubPermissions(t, map[string][]string{"editor": {PermissionMovieWrite}})
+
+	required, err := TwoFactorRequired("admin")
+	assert.NoError(t, err)
+	assert.False(t, required)
+
+	t.Setenv("REQUIRE_ADMIN_2FA", "true")
+	for role, expected := range map[string]bool{"admin": true, "editor": true, "customer": false} {
+		required, err := TwoFactorRequired(role)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, required, role)
+	}
+}
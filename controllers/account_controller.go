@@ -0,0 +1,269 @@
+// controller/account_controller.go
+package controllers
+
+import (
+	"context"
+	middleware "fire-watch/auth"
+	"fire-watch/mailer"
+	"fire-watch/models"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Phản hồi chung cho quên mật khẩu và gửi lại email xác minh, không để lộ email nào đã đăng ký
+const accountEmailSent = "If an account exists for this email, we have sent you a link"
+
+// sendAccountEmail tạo token và gửi email chứa liên kết trong goroutine nền. Request chỉ còn một lần
+// đọc MongoDB giống nhau dù email có tồn tại hay không, nên thời gian phản hồi không để lộ tài khoản
+func sendAccountEmail(user *models.User, purpose string, path string, subject string, text func(link string) string) {
+	userID, email := user.ID.Hex(), user.Email
+	go func() {
+		token, err := middleware.CreateEmailToken(purpose, userID)
+		if err != nil {
+			log.Println("Error creating email token:", err)
+			return
+		}
+
+		link := mailer.BaseURL() + path + "?token=" + url.QueryEscape(token)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := mailer.Send(ctx, mailer.Message{To: email, Subject: subject, Text: text(link)}); err != nil {
+			log.Println("Error sending email:", err)
+		}
+	}()
+}
+
+// accountEmailThrottled đếm yêu cầu gửi email tài khoản theo email và IP, trả 429 khi vượt giới hạn
+func accountEmailThrottled(c *gin.Context, email string) bool {
+	retry, err := middleware.RecordAccountEmailRequest(email, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking request limit"})
+		return true
+	}
+	if retry > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+		return true
+	}
+	return false
+}
+
+// sendVerificationEmail gửi liên kết xác minh email sau khi đăng ký
+func sendVerificationEmail(user *models.User) {
+	sendAccountEmail(user, middleware.EmailTokenVerify, "/auth/verify", "Verify your Fire Watch account", func(link string) string {
+		return "Hi " + user.Username + ",\n\n" +
+			"Please verify your email address by opening the link below:\n\n" + link + "\n\n" +
+			"The link expires in " + middleware.EmailTokenLifetime(middleware.EmailTokenVerify).String() + ".\n"
+	})
+}
+
+// sendPasswordResetEmail gửi liên kết đặt lại mật khẩu
+func sendPasswordResetEmail(user *models.User) {
+	sendAccountEmail(user, middleware.EmailTokenReset, "/auth/reset", "Reset your Fire Watch password", func(link string) string {
+		return "Hi " + user.Username + ",\n\n" +
+			"We received a request to reset your password. Open the link below to choose a new one:\n\n" + link + "\n\n" +
+			"The link expires in " + middleware.EmailTokenLifetime(middleware.EmailTokenReset).String() + " and can only be used once.\n" +
+			"If you did not request this, you can ignore this email.\n"
+	})
+}
+
+// emailCollation so sánh email không phân biệt hoa thường, để tài khoản cũ lưu email có chữ hoa vẫn tìm được
+var emailCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// normalizeEmail chuẩn hóa email người dùng nhập, cùng cách với bộ đếm đăng nhập sai
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// findUserByEmail đọc người dùng theo email (không phân biệt hoa thường), trả về nil nếu không tồn tại
+func findUserByEmail(email string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	err := models.GetUserCollection().FindOne(ctx, bson.M{"email": normalizeEmail(email)}, options.FindOne().SetCollation(emailCollation)).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// renderSignIn hiển thị trang đăng nhập với form theo mode (login, forgot, reset) và thông báo
+func renderSignIn(c *gin.Context, status int, data gin.H) {
+	if _, ok := data["mode"]; !ok {
+		data["mode"] = "login"
+	}
+	data["title"] = "Sign In"
+	c.HTML(status, "sign-in.html", data)
+}
+
+// Xác minh email bằng liên kết đã gửi khi đăng ký, kích hoạt tài khoản
+func VerifyEmail(c *gin.Context) {
+	userID, err := middleware.ConsumeEmailToken(middleware.EmailTokenVerify, c.Query("token"))
+	if err != nil {
+		renderSignIn(c, http.StatusBadRequest, gin.H{"notice": "This verification link is invalid or has expired"})
+		return
+	}
+
+	user, err := findUserByID(userID)
+	if err != nil {
+		renderSignIn(c, http.StatusBadRequest, gin.H{"notice": "This verification link is invalid or has expired"})
+		return
+	}
+
+	// Chỉ kích hoạt tài khoản đang chờ xác minh, không mở lại tài khoản đã bị admin khóa
+	if user.Status == models.UserStatusPending {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err = models.GetUserCollection().UpdateOne(ctx,
+			bson.M{"_id": user.ID, "status": models.UserStatusPending},
+			bson.M{"$set": bson.M{"status": models.UserStatusActive, "update_at": time.Now()}},
+		)
+		if err != nil {
+			renderSignIn(c, http.StatusInternalServerError, gin.H{"notice": "Error verifying email"})
+			return
+		}
+	}
+
+	renderSignIn(c, http.StatusOK, gin.H{"notice": "Your email has been verified, you can sign in now", "success": true})
+}
+
+// Gửi lại email xác minh cho tài khoản chưa xác minh
+func ResendVerificationEmail(c *gin.Context) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email"})
+		return
+	}
+
+	if accountEmailThrottled(c, request.Email) {
+		return
+	}
+
+	user, err := findUserByEmail(request.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+	if user != nil && user.Status == models.UserStatusPending {
+		sendVerificationEmail(user)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": accountEmailSent})
+}
+
+// Trang quên mật khẩu
+func ForgotPasswordPage(c *gin.Context) {
+	renderSignIn(c, http.StatusOK, gin.H{"mode": "forgot"})
+}
+
+// Gửi liên kết đặt lại mật khẩu, phản hồi giống nhau dù email có tồn tại hay không
+func ForgotPassword(c *gin.Context) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email"})
+		return
+	}
+
+	if accountEmailThrottled(c, request.Email) {
+		return
+	}
+
+	user, err := findUserByEmail(request.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+	if user != nil && user.Status != models.UserStatusDisabled {
+		sendPasswordResetEmail(user)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": accountEmailSent})
+}
+
+// Trang đặt lại mật khẩu, chỉ hiển thị form khi token còn hiệu lực (token chưa bị dùng ở bước này)
+func ResetPasswordPage(c *gin.Context) {
+	token := c.Query("token")
+	valid, err := middleware.CheckEmailToken(middleware.EmailTokenReset, token)
+	if err != nil || !valid {
+		renderSignIn(c, http.StatusBadRequest, gin.H{"mode": "reset", "notice": "This reset link is invalid or has expired"})
+		return
+	}
+	renderSignIn(c, http.StatusOK, gin.H{"mode": "reset", "token": token})
+}
+
+// Đặt mật khẩu mới bằng token trong email, đăng xuất mọi thiết bị của người dùng
+func ResetPassword(c *gin.Context) {
+	var request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reset data"})
+		return
+	}
+	// Cùng quy tắc với trường Password của models.User
+	if len(request.Password) < 6 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "message": "Password must be at least 6 characters"})
+		return
+	}
+
+	userID, err := middleware.ConsumeEmailToken(middleware.EmailTokenReset, request.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This reset link is invalid or has expired"})
+		return
+	}
+
+	user, err := findUserByID(userID)
+	if err != nil || user.Status == models.UserStatusDisabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This reset link is invalid or has expired"})
+		return
+	}
+
+	hashedPassword, err := hashPassword(request.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"password": hashedPassword, "update_at": time.Now()}
+	// Mở được email đặt lại mật khẩu cũng là đã xác minh email
+	if user.Status == models.UserStatusPending {
+		update["status"] = models.UserStatusActive
+	}
+	if _, err := models.GetUserCollection().UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": update}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating password"})
+		return
+	}
+
+	// Mật khẩu cũ có thể đã bị lộ: thu hồi mọi phiên và token, xóa bộ đếm đăng nhập sai
+	if err := middleware.RevokeUser(userID); err != nil {
+		log.Println("Error revoking user tokens:", err)
+	}
+	if err := middleware.ResetLoginFailures(user.Email); err != nil {
+		log.Println("Error resetting login failures:", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Your password has been reset, please sign in"})
+}
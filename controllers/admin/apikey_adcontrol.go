@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	middleware "fire-watch/auth"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Danh sách API key của các script nhập dữ liệu, không kèm key gốc hay mã băm
+func GetAPIKeys(c *gin.Context) {
+	keys, err := middleware.APIKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load API keys"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys, "scopes": middleware.APIKeyScopes()})
+}
+
+// Tạo API key mới với các scope được chọn, key gốc chỉ trả về một lần trong phản hồi này
+func CreateAPIKey(c *gin.Context) {
+	value, _ := c.Get("identity")
+	identity, ok := value.(*middleware.Identity)
+	// API key không được tự tạo thêm key, tránh một key bị lộ sinh ra key mới
+	if !ok || identity.APIKey != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys can only be created by a signed-in user"})
+		return
+	}
+
+	var request struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"` // 0: không hết hạn
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Name == "" || request.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key data"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if request.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	plain, key, err := middleware.CreateAPIKey(request.Name, request.Scopes, identity.UserID, expiresAt)
+	if err == middleware.ErrInvalidScope {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scopes", "scopes": middleware.APIKeyScopes()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"key": plain, "api_key": key})
+}
+
+// Thu hồi API key theo prefix
+func RevokeAPIKey(c *gin.Context) {
+	deleted, err := middleware.RevokeAPIKey(c.Param("prefix"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
@@ -7,6 +7,7 @@ import (
 	"fire-watch/dbs"
 	"fire-watch/models"
 	"fire-watch/websocket"
+	"fire-watch/websocket/events"
 	"fmt"
 	"log"
 	"net/http"
@@ -87,7 +88,7 @@ func GetEpisodesByMovieID(c *gin.Context) {
 
 	// Lưu kết quả vào Redis cache để tránh truy vấn lại
 	episodesJSON, _ := json.Marshal(episodes)
-	dbs.RedisClient.Set(ctx, "episodes_"+movieID, string(episodesJSON), 30*time.Minute)
+	dbs.SetCache(ctx, "episodes_"+movieID, string(episodesJSON), 30*time.Minute, dbs.MovieTag(movieID))
 
 	// Trả về JSON danh sách episodes
 	c.JSON(http.StatusOK, gin.H{"episodes": episodes})
@@ -255,27 +256,10 @@ func AddEpisode(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 
 	// Xóa cache trong Redis nếu có sử dụng
 	dbs.RedisClient.Del(ctx, "episodes")
-	dbs.RedisClient.Del(ctx, "movies")
+	dbs.InvalidateTags(ctx, dbs.TagCatalog, dbs.MovieTag(movieID))
 
-	// Gửi thông báo cập nhật episode với movieID
-	message := map[string]interface{}{
-		"type":    "episode",
-		"message": "A new episode was updated!",
-		"movieID": movieID,
-	}
-
-	// Chuyển thông báo thành JSON
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Println("Error encoding JSON message:", err)
-		return
-	}
-
-	// Log tin nhắn trước khi gửi
-	log.Println("Broadcasting message:", string(messageJSON))
-
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	websocketServer.BroadcastMessage(messageJSON)
+	// Gửi sự kiện tới các client đang theo dõi tập của phim
+	publishEvent(websocketServer, events.NewEpisodeEvent(events.ActionCreated, episode.ID.Hex(), movieID, actorFromContext(c)), websocket.EpisodeTopic(movieID), websocket.TopicAdminCatalog)
 	// Trả về thông báo thành công
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Episode added successfully!",
@@ -428,20 +412,10 @@ func UpdateEpisode(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 
 	// Xóa cache trong Redis
 	dbs.RedisClient.Del(context.TODO(), "episodes")
+	dbs.InvalidateTags(context.TODO(), dbs.TagCatalog, dbs.MovieTag(movieID))
 
-	// Gửi thông báo cập nhật qua WebSocket
-	message := map[string]interface{}{
-		"type":    "episode",
-		"message": "An episode was updated!",
-		"movieID": movieID,
-	}
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Println("Error encoding JSON message:", err)
-		return
-	}
-	log.Println("Broadcasting message:", string(messageJSON))
-	websocketServer.BroadcastMessage(messageJSON)
+	// Gửi sự kiện tới các client đang theo dõi tập của phim
+	publishEvent(websocketServer, events.NewEpisodeEvent(events.ActionUpdated, episodeID, movieID, actorFromContext(c)), websocket.EpisodeTopic(movieID), websocket.TopicAdminCatalog)
 
 	// Trả về phản hồi thành công
 	c.JSON(http.StatusOK, gin.H{"message": "Episode updated successfully!"})
@@ -522,20 +496,10 @@ func DeleteEpisode(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 
 	// Xóa cache trong Redis nếu có sử dụng
 	dbs.RedisClient.Del(ctx, "episodes")
+	dbs.InvalidateTags(ctx, dbs.TagCatalog, dbs.MovieTag(movieID))
 
-	// Gửi thông báo cập nhật qua WebSocket
-	message := map[string]interface{}{
-		"type":    "episode",
-		"message": "An episode was updated!",
-		"movieID": movieID,
-	}
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Println("Error encoding JSON message:", err)
-		return
-	}
-	log.Println("Broadcasting message:", string(messageJSON))
-	websocketServer.BroadcastMessage(messageJSON)
+	// Gửi sự kiện tới các client đang theo dõi tập của phim
+	publishEvent(websocketServer, events.NewEpisodeEvent(events.ActionDeleted, id, movieID, actorFromContext(c)), websocket.EpisodeTopic(movieID), websocket.TopicAdminCatalog)
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Episode delete sucessfully"})
 }
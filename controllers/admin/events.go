@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"encoding/json"
+	middleware "fire-watch/auth"
+	"fire-watch/websocket"
+	"fire-watch/websocket/events"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// actorFromContext lấy người dùng đã đăng nhập mà AuthMiddleware lưu trong context
+func actorFromContext(c *gin.Context) events.Actor {
+	value, ok := c.Get("identity")
+	if !ok {
+		return events.Actor{}
+	}
+	identity, ok := value.(*middleware.Identity)
+	if !ok {
+		return events.Actor{}
+	}
+	return events.Actor{UserID: identity.UserID, Username: identity.Username}
+}
+
+// publishEvent mã hóa sự kiện và gửi tới các client đang theo dõi các topic
+func publishEvent(websocketServer *websocket.WebSocketServer, event interface{}, topics ...string) {
+	messageJSON, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Error encoding JSON message:", err)
+		return
+	}
+
+	// Log tin nhắn trước khi gửi
+	log.Println("Broadcasting message:", string(messageJSON))
+
+	websocketServer.Publish(messageJSON, topics...)
+}
@@ -7,7 +7,7 @@ import (
 	"fire-watch/dbs"
 	"fire-watch/models"
 	"fire-watch/websocket"
-	"log"
+	"fire-watch/websocket/events"
 	"net/http"
 	"time"
 
@@ -73,13 +73,10 @@ func AddGenre(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 
 	// Xóa cache trong Redis nếu có sử dụng
 	dbs.RedisClient.Del(ctx, "genres")
+	dbs.InvalidateTags(ctx, dbs.TagCatalog)
 
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	message := []byte("A new genre was updated!")
-	// Log tin nhắn trước khi gửi
-	log.Println("Broadcasting message:", string(message))
-
-	websocketServer.BroadcastMessage(message)
+	// Gửi sự kiện tới các client đang theo dõi trang admin qua WebSocket
+	publishEvent(websocketServer, events.NewCatalogEvent(events.EntityGenre, events.ActionCreated, genre.ID.Hex(), actorFromContext(c)), websocket.TopicAdminCatalog)
 	// Trả về thông báo thành công
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Genre added successfully!",
@@ -210,12 +207,9 @@ func UpdateGenre(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 
 	// Xóa cache trong Redis nếu có sử dụng
 	dbs.RedisClient.Del(ctx, "genres")
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	message := []byte("A new genre was updated!")
-	// Log tin nhắn trước khi gửi
-	log.Println("Broadcasting message:", string(message))
-
-	websocketServer.BroadcastMessage(message)
+	dbs.InvalidateTags(ctx, dbs.TagCatalog, dbs.GenreTag(id))
+	// Gửi sự kiện tới các client đang theo dõi trang admin qua WebSocket
+	publishEvent(websocketServer, events.NewCatalogEvent(events.EntityGenre, events.ActionUpdated, id, actorFromContext(c)), websocket.TopicAdminCatalog)
 	// Trả về thông báo thành công
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Genre updated successfully!",
@@ -254,13 +248,10 @@ func DeleteGenre(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 	}
 	// Xóa cache trong Redis nếu có sử dụng
 	dbs.RedisClient.Del(ctx, "genres")
+	dbs.InvalidateTags(ctx, dbs.TagCatalog, dbs.GenreTag(id))
 
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	message := []byte("A new genre was updated!")
-	// Log tin nhắn trước khi gửi
-	log.Println("Broadcasting message:", string(message))
-
-	websocketServer.BroadcastMessage(message)
+	// Gửi sự kiện tới các client đang theo dõi trang admin qua WebSocket
+	publishEvent(websocketServer, events.NewCatalogEvent(events.EntityGenre, events.ActionDeleted, id, actorFromContext(c)), websocket.TopicAdminCatalog)
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Danh mục đã được xóa"})
 }
@@ -310,12 +301,9 @@ func UpdateGenreField(c *gin.Context, websocketServer *websocket.WebSocketServer
 	}
 	// Xóa cache trong Redis nếu có sử dụng
 	dbs.RedisClient.Del(ctx, "genres")
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	message := []byte("A new genre was updated!")
-	// Log tin nhắn trước khi gửi
-	log.Println("Broadcasting message:", string(message))
-
-	websocketServer.BroadcastMessage(message)
+	dbs.InvalidateTags(ctx, dbs.TagCatalog, dbs.GenreTag(idParam))
+	// Gửi sự kiện tới các client đang theo dõi trang admin qua WebSocket
+	publishEvent(websocketServer, events.NewCatalogEvent(events.EntityGenre, events.ActionUpdated, idParam, actorFromContext(c)), websocket.TopicAdminCatalog)
 	// Trả về phản hồi thành công
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fire-watch/dbs"
 	"fire-watch/models"
+	"fire-watch/pagination"
 	"fire-watch/websocket"
+	"fire-watch/websocket/events"
 	"fmt"
 	"log"
 	"mime/multipart"
@@ -204,6 +206,7 @@ func AddMovie(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 	}
 
 	// Chèn vào cơ sở dữ liệu
+	movie.RefreshSearch()
 	_, err = collection.InsertOne(ctx, movie)
 	if err != nil {
 		log.Println("Failed to insert movie:", err)
@@ -211,17 +214,21 @@ func AddMovie(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 		return
 	}
 
-	dbs.DeleteCacheByKeyword(ctx, "movie")
-
-	_, _, _, _, _, _, err = GetAllMoviesWithOptions(c, websocketServer)
-	if err != nil {
-		log.Println("Error fetching movies data:", err)
+	// Cập nhật chỉ mục gợi ý tìm kiếm
+	if err := models.SyncMovieSuggestion(ctx, movie.ID); err != nil {
+		log.Println("Failed to update search suggestions:", err)
 	}
 
+	// Xóa các cache phụ thuộc vào danh sách phim
+	dbs.InvalidateTags(ctx, dbs.TagCatalog)
+
+	// Gửi sự kiện tới các client đang theo dõi danh sách phim
+	publishEvent(websocketServer, events.NewMovieEvent(events.ActionCreated, movie.ID.Hex(), actorFromContext(c)), websocket.MovieTopic(movie.ID.Hex()), websocket.TopicAdminCatalog)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Movie added successfully", "movie": movie})
 }
 
-func GetAllMoviesWithOptions(c *gin.Context, websocketServer *websocket.WebSocketServer) ([]models.Movie, []models.Category, []models.Genre, []models.Country, []models.Episode, []models.Server, error) {
+func GetAllMoviesWithOptions(c *gin.Context) ([]models.Movie, *pagination.Page, []models.Category, []models.Genre, []models.Country, []models.Episode, []models.Server, error) {
 	// Các collection MongoDB
 	movieCollection := models.GetMovieCollection()
 	categoryCollection := models.GetCategoryCollection()
@@ -235,19 +242,12 @@ func GetAllMoviesWithOptions(c *gin.Context, websocketServer *websocket.WebSocke
 	defer cancel()
 
 	// Lấy tham số phân trang từ query
-	pageStr := c.Query("page")
-	limit := 6 // Số lượng bản ghi trên mỗi trang
-
-	// Xử lý page
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page <= 0 {
-		page = 1 // Nếu không có hoặc không hợp lệ, mặc định là trang 1
+	params, err := pagination.Parse(c, pagination.Options{Order: pagination.ByPosition, DefaultLimit: 6})
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 
-	// Tính toán `$skip`
-	skip := (page - 1) * limit
-
-	cacheKey := fmt.Sprintf("movies_%d", page)
+	cacheKey := "movies_" + params.CacheKey()
 
 	// // Lấy nhiều keys cùng lúc từ Redis
 	// cachedData, err := dbs.RedisClient.MGet(ctx, cacheKey, "categories", "genres", "countries", "episodes", "servers").Result()
@@ -269,9 +269,6 @@ func GetAllMoviesWithOptions(c *gin.Context, websocketServer *websocket.WebSocke
 	// 		json.Unmarshal([]byte(cachedData[4].(string)), &episodes)
 	// 		json.Unmarshal([]byte(cachedData[5].(string)), &servers)
 
-	// 		// Gửi thông báo cập nhật qua WebSocket
-	// 		notifyClients(websocketServer, movies)
-
 	// 		return movies, categories, genres, countries, episodes, servers, nil
 	// 	}
 	// }
@@ -284,9 +281,8 @@ func GetAllMoviesWithOptions(c *gin.Context, websocketServer *websocket.WebSocke
 	var episodes []models.Episode
 	var servers []models.Server
 
-	// Pipeline cho movie, như code trước đây
-	pipeline := mongo.Pipeline{
-		bson.D{{"$match", bson.D{{"deleted", bson.D{{"$ne", "deleted"}}}}}},
+	// Lookup tên danh mục, thể loại, quốc gia, chỉ chạy cho các phim trong trang
+	lookups := []bson.D{
 		bson.D{{"$lookup", bson.D{
 			{"from", "categories"}, {"localField", "category"}, {"foreignField", "_id"}, {"as", "categoryDetails"},
 		}}},
@@ -323,36 +319,46 @@ func GetAllMoviesWithOptions(c *gin.Context, websocketServer *websocket.WebSocke
 				}},
 			}},
 		}}},
-		bson.D{{"$sort", bson.D{{"position", 1}}}}, // Sắp xếp theo trường position tăng dần
-		bson.D{{"$skip", skip}},                    // Bỏ qua số lượng bản ghi
-		bson.D{{"$limit", limit}},                  // Lấy số lượng bản ghi
+	}
+
+	// Pipeline cho movie: một trang phim theo position và tổng số phim
+	pipeline := mongo.Pipeline{
+		bson.D{{"$match", bson.D{{"deleted", bson.D{{"$ne", "deleted"}}}}}},
+		params.Facet(lookups...),
 	}
 
 	cursor, err := movieCollection.Aggregate(ctx, pipeline)
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var movie models.Movie
-		if err := cursor.Decode(&movie); err != nil {
-			return nil, nil, nil, nil, nil, nil, err
+	var result pagination.Result
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return nil, nil, nil, nil, nil, nil, nil, err
 		}
-		movies = append(movies, movie)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, err
+	}
+
+	page, err := params.Finish(result.Count(), result.Items, &movies)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 
 	// Lấy tất cả categories từ MongoDB
 	categoryCursor, err := categoryCollection.Find(ctx, bson.M{"deleted": bson.M{"$ne": "deleted"}})
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 	defer categoryCursor.Close(ctx)
 
 	for categoryCursor.Next(ctx) {
 		var category models.Category
 		if err := categoryCursor.Decode(&category); err != nil {
-			return nil, nil, nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, nil, err
 		}
 		categories = append(categories, category)
 	}
@@ -360,14 +366,14 @@ func GetAllMoviesWithOptions(c *gin.Context, websocketServer *websocket.WebSocke
 	// Lấy tất cả genres từ MongoDB
 	genreCursor, err := genreCollection.Find(ctx, bson.M{"deleted": bson.M{"$ne": "deleted"}})
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 	defer genreCursor.Close(ctx)
 
 	for genreCursor.Next(ctx) {
 		var genre models.Genre
 		if err := genreCursor.Decode(&genre); err != nil {
-			return nil, nil, nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, nil, err
 		}
 		genres = append(genres, genre)
 	}
@@ -375,14 +381,14 @@ func GetAllMoviesWithOptions(c *gin.Context, websocketServer *websocket.WebSocke
 	// Lấy tất cả countries từ MongoDB
 	countryCursor, err := countryCollection.Find(ctx, bson.M{"deleted": bson.M{"$ne": "deleted"}})
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 	defer countryCursor.Close(ctx)
 
 	for countryCursor.Next(ctx) {
 		var country models.Country
 		if err := countryCursor.Decode(&country); err != nil {
-			return nil, nil, nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, nil, err
 		}
 		countries = append(countries, country)
 	}
@@ -390,28 +396,28 @@ func GetAllMoviesWithOptions(c *gin.Context, websocketServer *websocket.WebSocke
 	// Lấy tất cả episodes từ MongoDB
 	episodeCursor, err := episodeCollection.Find(ctx, bson.M{"deleted": bson.M{"$ne": "deleted"}})
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 	defer episodeCursor.Close(ctx)
 
 	for episodeCursor.Next(ctx) {
 		var episode models.Episode
 		if err := episodeCursor.Decode(&episode); err != nil {
-			return nil, nil, nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, nil, err
 		}
 		episodes = append(episodes, episode)
 	}
 	// Lấy tất cả servers từ MongoDB
 	serverCursor, err := serverCollection.Find(ctx, bson.M{"deleted": bson.M{"$ne": "deleted"}})
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 	defer serverCursor.Close(ctx)
 
 	for serverCursor.Next(ctx) {
 		var server models.Server
 		if err := serverCursor.Decode(&server); err != nil {
-			return nil, nil, nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, nil, err
 		}
 		servers = append(servers, server)
 	}
@@ -425,8 +431,11 @@ func GetAllMoviesWithOptions(c *gin.Context, websocketServer *websocket.WebSocke
 	serversJSON, _ := json.Marshal(servers)
 
 	// Lưu vào Redis với TTL
+	err = dbs.SetCache(ctx, cacheKey, string(moviesJSON), 30*time.Minute, dbs.TagCatalog)
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, nil, err
+	}
 	_, err = dbs.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
-		pipe.Set(ctx, cacheKey, string(moviesJSON), 30*time.Minute)
 		pipe.Set(ctx, "categories", string(categoriesJSON), 30*time.Minute)
 		pipe.Set(ctx, "genres", string(genresJSON), 30*time.Minute)
 		pipe.Set(ctx, "countries", string(countriesJSON), 30*time.Minute)
@@ -435,35 +444,10 @@ func GetAllMoviesWithOptions(c *gin.Context, websocketServer *websocket.WebSocke
 		return nil
 	})
 	if err != nil {
-		return nil, nil, nil, nil, nil, nil, err
-	}
-
-	// Gửi thông báo cập nhật qua WebSocket
-	notifyClients(websocketServer, movies)
-
-	return movies, categories, genres, countries, episodes, servers, nil
-}
-
-// Hàm gửi thông báo cập nhật tới các client qua WebSocket
-func notifyClients(websocketServer *websocket.WebSocketServer, movies []models.Movie) {
-	message := map[string]interface{}{
-		"type":    "movie",
-		"message": "A new movie or update detected!",
-		"movies":  movies,
-	}
-
-	// Chuyển thông báo thành JSON
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Println("Error encoding JSON message:", err)
-		return
+		return nil, nil, nil, nil, nil, nil, nil, err
 	}
 
-	// Log tin nhắn trước khi gửi
-	log.Println("Broadcasting message:", string(messageJSON))
-
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	websocketServer.BroadcastMessage(messageJSON)
+	return movies, page, categories, genres, countries, episodes, servers, nil
 }
 
 // UpdateMovie cập nhật thông tin của một movie
@@ -642,6 +626,7 @@ func UpdateMovie(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	movieUpdate.RefreshSearch()
 	updateResult, err := collection.UpdateOne(ctx, bson.M{"_id": oid}, bson.M{"$set": movieUpdate})
 	if err != nil || updateResult.MatchedCount == 0 {
 		log.Println("Failed to update movie:", err) // Log khi không cập nhật được
@@ -649,15 +634,16 @@ func UpdateMovie(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 		return
 	}
 
-	dbs.DeleteCacheByKeyword(ctx, "movie")
+	// Cập nhật chỉ mục gợi ý tìm kiếm
+	if err := models.SyncMovieSuggestion(ctx, oid); err != nil {
+		log.Println("Failed to update search suggestions:", err)
+	}
 
-	// Lấy dữ liệu cập nhật cho WebSocket mà không chờ
-	go func() {
-		_, _, _, _, _, _, err := GetAllMoviesWithOptions(c, websocketServer)
-		if err != nil {
-			log.Println("Error fetching movies data:", err)
-		}
-	}()
+	// Xóa cache của phim này và các danh sách phim
+	dbs.InvalidateTags(ctx, dbs.TagCatalog, dbs.MovieTag(movieID))
+
+	// Gửi sự kiện tới các client đang theo dõi danh sách phim
+	publishEvent(websocketServer, events.NewMovieEvent(events.ActionUpdated, movieID, actorFromContext(c)), websocket.MovieTopic(movieID), websocket.TopicAdminCatalog)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Movie updated successfully", "movie": movieUpdate})
 }
@@ -717,14 +703,15 @@ func DeleteMovie(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Can not delete movie!"})
 		return
 	}
-	// Xóa cache trong Redis nếu có sử dụng
-	dbs.DeleteCacheByKeyword(ctx, "movie")
-
-	_, _, _, _, _, _, err = GetAllMoviesWithOptions(c, websocketServer)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching movies data"})
-		return
+	// Cập nhật chỉ mục gợi ý tìm kiếm
+	if err := models.SyncMovieSuggestion(ctx, objectID); err != nil {
+		log.Println("Failed to update search suggestions:", err)
 	}
+	// Xóa cache của phim này và các danh sách phim
+	dbs.InvalidateTags(ctx, dbs.TagCatalog, dbs.MovieTag(id))
+
+	// Gửi sự kiện tới các client đang theo dõi danh sách phim
+	publishEvent(websocketServer, events.NewMovieEvent(events.ActionDeleted, id, actorFromContext(c)), websocket.MovieTopic(id), websocket.TopicAdminCatalog)
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Danh mục đã được xóa"})
 }
@@ -787,6 +774,10 @@ func UpdateMovieField(c *gin.Context, websocketServer *websocket.WebSocketServer
 				field: value,
 			},
 		}
+		// Trường nằm trong tìm kiếm thì cập nhật luôn bản không dấu của nó
+		if searchField, folded, ok := models.MovieSearchFieldUpdate(field, value); ok {
+			updateData["$set"].(bson.M)[searchField] = folded
+		}
 	}
 	// Cập nhật trường trong MongoDB
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -800,15 +791,17 @@ func UpdateMovieField(c *gin.Context, websocketServer *websocket.WebSocketServer
 		return
 	}
 
-	// Xóa cache trong Redis nếu có sử dụng
-	dbs.DeleteCacheByKeyword(ctx, "movie")
-
-	_, _, _, _, _, _, err = GetAllMoviesWithOptions(c, websocketServer)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching movies data"})
-		return
+	// Cập nhật chỉ mục gợi ý tìm kiếm
+	if err := models.SyncMovieSuggestion(ctx, movieID); err != nil {
+		log.Println("Failed to update search suggestions:", err)
 	}
 
+	// Xóa cache của phim này và các danh sách phim
+	dbs.InvalidateTags(ctx, dbs.TagCatalog, dbs.MovieTag(idParam))
+
+	// Gửi sự kiện tới các client đang theo dõi danh sách phim
+	publishEvent(websocketServer, events.NewMovieEvent(events.ActionUpdated, idParam, actorFromContext(c)), websocket.MovieTopic(idParam), websocket.TopicAdminCatalog)
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Movie field updated successfully",
@@ -864,13 +857,11 @@ func DeleteMovieImage(c *gin.Context, websocketServer *websocket.WebSocketServer
 		log.Println("Failed to delete image from server:", err)
 	}
 
-	dbs.DeleteCacheByKeyword(ctx, "movie")
+	// Xóa cache của phim này và các danh sách phim
+	dbs.InvalidateTags(ctx, dbs.TagCatalog, dbs.MovieTag(movieID))
 
-	_, _, _, _, _, _, err = GetAllMoviesWithOptions(c, websocketServer)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching movies data"})
-		return
-	}
+	// Gửi sự kiện tới các client đang theo dõi danh sách phim
+	publishEvent(websocketServer, events.NewMovieEvent(events.ActionUpdated, movieID, actorFromContext(c)), websocket.MovieTopic(movieID), websocket.TopicAdminCatalog)
 
 	// Trả về kết quả thành công
 	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully", "success": true})
@@ -909,16 +900,16 @@ func UpdateMoviePosition(c *gin.Context, websocketServer *websocket.WebSocketSer
 		}
 	}
 
-	// Xóa cache Redis nếu có
-	err := dbs.RedisClient.Del(ctx, "movies").Err()
+	// Thứ tự phim thay đổi nên xóa toàn bộ cache danh sách phim
+	err := dbs.InvalidateTags(ctx, dbs.TagCatalog)
 	if err != nil {
 		log.Println("Failed to clear Redis cache:", err)
 	}
 
-	_, _, _, _, _, _, err = GetAllMoviesWithOptions(c, websocketServer)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching movies data"})
-		return
+	// Gửi sự kiện cho từng phim đổi vị trí
+	actor := actorFromContext(c)
+	for _, movie := range movies {
+		publishEvent(websocketServer, events.NewMovieEvent(events.ActionUpdated, movie.ID, actor), websocket.MovieTopic(movie.ID), websocket.TopicAdminCatalog)
 	}
 
 	// Trả về phản hồi thành công
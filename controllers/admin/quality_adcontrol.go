@@ -7,6 +7,7 @@ import (
 	"fire-watch/dbs"
 	"fire-watch/models"
 	"fire-watch/websocket"
+	"fire-watch/websocket/events"
 	"log"
 	"net/http"
 	"strconv"
@@ -89,7 +90,7 @@ func GetQualityByMovieEpisodeServer(c *gin.Context) {
 	// Lưu kết quả vào Redis cache để tránh truy vấn lại
 	cacheKey := "qualities_" + movieID + "_" + episodeID + "_" + serverID
 	qualitiesJSON, _ := json.Marshal(qualities)
-	dbs.RedisClient.Set(ctx, cacheKey, string(qualitiesJSON), 30*time.Minute)
+	dbs.SetCache(ctx, cacheKey, string(qualitiesJSON), 30*time.Minute, dbs.MovieTag(movieID))
 
 	// Trả về JSON danh sách qualities
 	c.JSON(http.StatusOK, gin.H{"qualities": qualities})
@@ -202,31 +203,11 @@ func AddQuality(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 		return
 	}
 
-	cacheKey := "qualities_" + movieID + "_" + episodeID + "_" + serverID
-	// Xóa cache trong Redis nếu có sử dụng
-	dbs.RedisClient.Del(ctx, cacheKey)
-
-	// Gửi thông báo cập nhật qua WebSocket
-	message := map[string]interface{}{
-		"type":      "quality",
-		"message":   "An quality was updated!",
-		"movieID":   movieID,
-		"episodeID": episodeID,
-		"serverID":  serverID,
-	}
-
-	// Chuyển thông báo thành JSON
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Println("Error encoding JSON message:", err)
-		return
-	}
-
-	// Log tin nhắn trước khi gửi
-	// log.Println("Broadcasting message:", string(messageJSON))
+	// Xóa cache qualities và chi tiết của phim liên quan
+	dbs.InvalidateTags(ctx, dbs.MovieTag(movieID))
 
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	websocketServer.BroadcastMessage(messageJSON)
+	// Gửi sự kiện tới các client đang theo dõi phim
+	publishEvent(websocketServer, events.NewQualityEvent(events.ActionCreated, quality.ID.Hex(), movieID, episodeID, serverID, actorFromContext(c)), websocket.MovieTopic(movieID), websocket.TopicAdminCatalog)
 	// Trả về thông báo thành công
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Quality added successfully!",
@@ -286,26 +267,11 @@ func DeleteQuality(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 		log.Printf("Failed to remove quality ID from server %s: %v", quality.ServerID.Hex(), err)
 	}
 
-	// Xóa cache trong Redis nếu có sử dụng
-	cacheKey := "qualities_" + movieID + "_" + episodeID + "_" + serverID
-	// Xóa cache trong Redis nếu có sử dụng
-	dbs.RedisClient.Del(ctx, cacheKey)
-
-	// Gửi thông báo cập nhật qua WebSocket
-	message := map[string]interface{}{
-		"type":      "quality",
-		"message":   "An quality was updated!",
-		"movieID":   movieID,
-		"episodeID": episodeID,
-		"serverID":  serverID,
-	}
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Println("Error encoding JSON message:", err)
-		return
-	}
-	log.Println("Broadcasting message:", string(messageJSON))
-	websocketServer.BroadcastMessage(messageJSON)
+	// Xóa cache qualities và chi tiết của phim liên quan
+	dbs.InvalidateTags(ctx, dbs.MovieTag(movieID))
+
+	// Gửi sự kiện tới các client đang theo dõi phim
+	publishEvent(websocketServer, events.NewQualityEvent(events.ActionDeleted, id, movieID, episodeID, serverID, actorFromContext(c)), websocket.MovieTopic(movieID), websocket.TopicAdminCatalog)
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Quality delete sucessfully"})
 }
@@ -391,31 +357,11 @@ func UpdateQualityField(c *gin.Context, websocketServer *websocket.WebSocketServ
 		return
 	}
 
-	// Tạo cacheKey trực tiếp từ chuỗi hex của movieID, episodeID và serverID
-	cacheKey := "qualities_" + movieIDStr + "_" + episodeIDStr + "_" + serverIDStr
-	dbs.RedisClient.Del(ctx, cacheKey)
-
-	// Gửi thông báo cập nhật qua WebSocket
-	message := map[string]interface{}{
-		"type":      "quality",
-		"message":   "An quality was updated!",
-		"movieID":   movieIDStr,
-		"episodeID": episodeIDStr,
-		"serverID":  serverIDStr,
-	}
-
-	// Chuyển thông báo thành JSON
-	messageJSON, err := json.Marshal(message)
-	if err != nil {
-		log.Println("Error encoding JSON message:", err)
-		return
-	}
-
-	// Log tin nhắn trước khi gửi
-	log.Println("Broadcasting message:", string(messageJSON))
+	// Xóa cache qualities và chi tiết của phim liên quan
+	dbs.InvalidateTags(ctx, dbs.MovieTag(movieIDStr))
 
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	websocketServer.BroadcastMessage(messageJSON)
+	// Gửi sự kiện tới các client đang theo dõi phim
+	publishEvent(websocketServer, events.NewQualityEvent(events.ActionUpdated, idParam, movieIDStr, episodeIDStr, serverIDStr, actorFromContext(c)), websocket.MovieTopic(movieIDStr), websocket.TopicAdminCatalog)
 
 	// Trả về phản hồi thành công
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"context"
+	"fire-watch/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Dựng lại chỉ mục gợi ý tìm kiếm từ collection movies, dùng khi chỉ mục lệch với dữ liệu (Redis bị xóa, nhập dữ liệu trực tiếp)
+func RebuildSearchSuggestions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	count, err := models.RebuildMovieSuggestions(ctx)
+	if err != nil {
+		log.Println("Failed to rebuild search suggestions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rebuild search suggestions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Search suggestions rebuilt", "movies": count})
+}
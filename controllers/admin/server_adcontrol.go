@@ -7,7 +7,7 @@ import (
 	"fire-watch/dbs"
 	"fire-watch/models"
 	"fire-watch/websocket"
-	"log"
+	"fire-watch/websocket/events"
 	"net/http"
 	"time"
 
@@ -77,12 +77,8 @@ func AddServer(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 	// Xóa cache trong Redis nếu có sử dụng
 	dbs.RedisClient.Del(ctx, "servers")
 
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	message := []byte("A new server was updated!")
-	// Log tin nhắn trước khi gửi
-	log.Println("Broadcasting message:", string(message))
-
-	websocketServer.BroadcastMessage(message)
+	// Gửi sự kiện tới các client đang theo dõi trang admin qua WebSocket
+	publishEvent(websocketServer, events.NewCatalogEvent(events.EntityServer, events.ActionCreated, server.ID.Hex(), actorFromContext(c)), websocket.TopicAdminCatalog)
 	// Trả về thông báo thành công
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Server added successfully!",
@@ -213,12 +209,9 @@ func UpdateServer(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 
 	// Xóa cache trong Redis nếu có sử dụng
 	dbs.RedisClient.Del(ctx, "servers")
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	message := []byte("A new server was updated!")
-	// Log tin nhắn trước khi gửi
-	log.Println("Broadcasting message:", string(message))
-
-	websocketServer.BroadcastMessage(message)
+	dbs.InvalidateTags(ctx, dbs.ServerTag(id))
+	// Gửi sự kiện tới các client đang theo dõi trang admin qua WebSocket
+	publishEvent(websocketServer, events.NewCatalogEvent(events.EntityServer, events.ActionUpdated, id, actorFromContext(c)), websocket.TopicAdminCatalog)
 	// Trả về thông báo thành công
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Server updated successfully!",
@@ -257,13 +250,10 @@ func DeleteServer(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 	}
 	// Xóa cache trong Redis nếu có sử dụng
 	dbs.RedisClient.Del(ctx, "servers")
+	dbs.InvalidateTags(ctx, dbs.ServerTag(id))
 
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	message := []byte("A new server was updated!")
-	// Log tin nhắn trước khi gửi
-	log.Println("Broadcasting message:", string(message))
-
-	websocketServer.BroadcastMessage(message)
+	// Gửi sự kiện tới các client đang theo dõi trang admin qua WebSocket
+	publishEvent(websocketServer, events.NewCatalogEvent(events.EntityServer, events.ActionDeleted, id, actorFromContext(c)), websocket.TopicAdminCatalog)
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Danh mục đã được xóa"})
 }
@@ -313,12 +303,9 @@ func UpdateServerField(c *gin.Context, websocketServer *websocket.WebSocketServe
 	}
 	// Xóa cache trong Redis nếu có sử dụng
 	dbs.RedisClient.Del(ctx, "servers")
-	// Gửi thông điệp tới tất cả các client qua WebSocket
-	message := []byte("A new server was updated!")
-	// Log tin nhắn trước khi gửi
-	log.Println("Broadcasting message:", string(message))
-
-	websocketServer.BroadcastMessage(message)
+	dbs.InvalidateTags(ctx, dbs.ServerTag(idParam))
+	// Gửi sự kiện tới các client đang theo dõi trang admin qua WebSocket
+	publishEvent(websocketServer, events.NewCatalogEvent(events.EntityServer, events.ActionUpdated, idParam, actorFromContext(c)), websocket.TopicAdminCatalog)
 	// Trả về phản hồi thành công
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -0,0 +1,496 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fire-watch/dbs"
+	"fire-watch/models"
+	"fire-watch/pagination"
+	"fire-watch/search"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrInvalidFilter được trả về khi tham số lọc trên URL không hợp lệ
+var ErrInvalidFilter = errors.New("invalid movie filter")
+
+// Số phim trên mỗi trang kết quả lọc
+const filterPageSize = 24
+
+// Số giá trị tối đa cho mỗi tham số lọc, tránh truy vấn quá lớn
+const maxFilterValues = 20
+
+// Số giá trị lọc tối đa (mọi nhóm cộng lại) để kết quả được cache. Các tổ hợp lớn hơn hiếm khi lặp lại,
+// cache chúng chỉ làm Redis đầy các key dùng một lần
+const maxCachedFilterValues = 4
+
+// Các kiểu sắp xếp kết quả lọc
+const (
+	SortRelevance = "relevance" // Theo độ liên quan, chỉ có khi tìm theo từ khóa
+	SortPosition  = "position"
+	SortViews     = "views"
+	SortYear      = "year"
+	SortNewest    = "newest"
+)
+
+var filterSorts = map[string]bson.D{
+	SortPosition: {{"position", 1}},
+	SortViews:    {{"views", -1}, {"position", 1}},
+	SortYear:     {{"year", -1}, {"position", 1}},
+	SortNewest:   {{"created_at", -1}},
+}
+
+// Nhãn hiển thị của từng mức chất lượng, cũng là danh sách giá trị hợp lệ
+var qualityLabels = map[int]string{1: "CAM", 720: "HD", 1080: "FHD", 1440: "2K", 2160: "4K"}
+
+// MovieFilter là các điều kiện lọc đọc từ URL của /search và /movies
+type MovieFilter struct {
+	Search     string               `json:"search,omitempty"`
+	Genres     []primitive.ObjectID `json:"genre,omitempty"`
+	Countries  []primitive.ObjectID `json:"country,omitempty"`
+	Categories []primitive.ObjectID `json:"category,omitempty"`
+	Years      []int                `json:"year,omitempty"`
+	Qualities  []int                `json:"quality,omitempty"`
+	Subs       []string             `json:"sub,omitempty"`
+	Hot        bool                 `json:"hot,omitempty"`
+	Sort       string               `json:"sort"`
+}
+
+// FacetCount là số phim khớp với một giá trị của bộ lọc
+type FacetCount struct {
+	Value    string `bson:"value" json:"value"`
+	Label    string `bson:"label" json:"label"`
+	Count    int    `bson:"count" json:"count"`
+	Selected bool   `bson:"-" json:"selected"`
+}
+
+// MovieFacets là số phim theo từng giá trị của mỗi bộ lọc. Số đếm của một bộ lọc
+// tính trên các điều kiện còn lại, nên chọn thêm giá trị cùng nhóm vẫn thấy được số phim
+type MovieFacets struct {
+	Genres     []FacetCount `bson:"genres" json:"genres"`
+	Countries  []FacetCount `bson:"countries" json:"countries"`
+	Categories []FacetCount `bson:"categories" json:"categories"`
+	Years      []FacetCount `bson:"years" json:"years"`
+	Qualities  []FacetCount `bson:"qualities" json:"qualities"`
+	Subs       []FacetCount `bson:"subs" json:"subs"`
+	Hot        []FacetCount `bson:"hot" json:"hot"`
+}
+
+// MovieListing là một trang kết quả lọc kèm số đếm của các bộ lọc
+type MovieListing struct {
+	Movies           []models.Movie `json:"movies"`
+	*pagination.Page                // Tổng số phim và thông tin trang, nằm cùng cấp với movies trong JSON
+	Facets           MovieFacets    `json:"facets"`
+	Filter           *MovieFilter   `json:"filter"`
+	DidYouMean       []search.Match `json:"did_you_mean,omitempty"` // Tên phim gần giống khi tìm theo từ khóa không có kết quả
+}
+
+// Các nhóm bộ lọc, dùng làm tên facet và để bỏ điều kiện của chính nhóm đó khi đếm
+const (
+	facetGenre    = "genre"
+	facetCountry  = "country"
+	facetCategory = "category"
+	facetYear     = "year"
+	facetQuality  = "quality"
+	facetSub      = "sub"
+	facetHot      = "hot"
+)
+
+func parseObjectIDs(values []string) ([]primitive.ObjectID, error) {
+	var ids []primitive.ObjectID
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return nil, ErrInvalidFilter
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) > maxFilterValues {
+		return nil, ErrInvalidFilter
+	}
+	return ids, nil
+}
+
+func parseInts(values []string, valid func(int) bool) ([]int, error) {
+	var numbers []int
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || !valid(number) {
+			return nil, ErrInvalidFilter
+		}
+		numbers = append(numbers, number)
+	}
+	if len(numbers) > maxFilterValues {
+		return nil, ErrInvalidFilter
+	}
+	return numbers, nil
+}
+
+// ParseMovieFilter đọc các tham số lọc từ URL, tham số lặp lại (genre=a&genre=b) nghĩa là "một trong các giá trị"
+func ParseMovieFilter(c *gin.Context) (*MovieFilter, error) {
+	filter := &MovieFilter{Search: search.Query(c.Query("search"))}
+
+	var err error
+	if filter.Genres, err = parseObjectIDs(c.QueryArray("genre")); err != nil {
+		return nil, err
+	}
+	if filter.Countries, err = parseObjectIDs(c.QueryArray("country")); err != nil {
+		return nil, err
+	}
+	if filter.Categories, err = parseObjectIDs(c.QueryArray("category")); err != nil {
+		return nil, err
+	}
+	if filter.Years, err = parseInts(c.QueryArray("year"), func(year int) bool { return year > 0 }); err != nil {
+		return nil, err
+	}
+	if filter.Qualities, err = parseInts(c.QueryArray("quality"), func(quality int) bool { return qualityLabels[quality] != "" }); err != nil {
+		return nil, err
+	}
+
+	for _, sub := range c.QueryArray("sub") {
+		if sub != "" {
+			filter.Subs = append(filter.Subs, sub)
+		}
+	}
+	if len(filter.Subs) > maxFilterValues {
+		return nil, ErrInvalidFilter
+	}
+
+	switch c.Query("hot") {
+	case "", "0", "false":
+	case "1", "true":
+		filter.Hot = true
+	default:
+		return nil, ErrInvalidFilter
+	}
+
+	filter.Sort = c.Query("sort")
+	switch {
+	case filter.Sort == "" && filter.Search != "":
+		filter.Sort = SortRelevance
+	case filter.Sort == "", filter.Sort == SortRelevance && filter.Search == "":
+		filter.Sort = SortPosition
+	case filter.Sort != SortRelevance && filterSorts[filter.Sort] == nil:
+		return nil, ErrInvalidFilter
+	}
+	return filter, nil
+}
+
+// Values trả về bộ lọc dưới dạng tham số URL (không gồm phân trang), giá trị đã sắp xếp để cùng bộ lọc luôn cho cùng chuỗi
+func (filter *MovieFilter) Values() url.Values {
+	values := url.Values{}
+	if filter.Search != "" {
+		values.Set("search", filter.Search)
+	}
+	for _, id := range filter.Genres {
+		values.Add("genre", id.Hex())
+	}
+	for _, id := range filter.Countries {
+		values.Add("country", id.Hex())
+	}
+	for _, id := range filter.Categories {
+		values.Add("category", id.Hex())
+	}
+	for _, year := range filter.Years {
+		values.Add("year", strconv.Itoa(year))
+	}
+	for _, quality := range filter.Qualities {
+		values.Add("quality", strconv.Itoa(quality))
+	}
+	for _, sub := range filter.Subs {
+		values.Add("sub", sub)
+	}
+	if filter.Hot {
+		values.Set("hot", "1")
+	}
+	values.Set("sort", filter.Sort)
+	for key := range values {
+		sort.Strings(values[key])
+	}
+	return values
+}
+
+// match tạo điều kiện lọc theo các nhóm, trừ nhóm except (dùng khi đếm facet của chính nhóm đó)
+func (filter *MovieFilter) match(except string) bson.D {
+	match := bson.D{}
+	if len(filter.Genres) > 0 && except != facetGenre {
+		match = append(match, bson.E{"genre", bson.D{{"$in", filter.Genres}}})
+	}
+	if len(filter.Countries) > 0 && except != facetCountry {
+		match = append(match, bson.E{"country", bson.D{{"$in", filter.Countries}}})
+	}
+	if len(filter.Categories) > 0 && except != facetCategory {
+		match = append(match, bson.E{"category", bson.D{{"$in", filter.Categories}}})
+	}
+	if len(filter.Years) > 0 && except != facetYear {
+		match = append(match, bson.E{"year", bson.D{{"$in", filter.Years}}})
+	}
+	if len(filter.Qualities) > 0 && except != facetQuality {
+		match = append(match, bson.E{"maxquality", bson.D{{"$in", filter.Qualities}}})
+	}
+	if len(filter.Subs) > 0 && except != facetSub {
+		match = append(match, bson.E{"sub", bson.D{{"$in", filter.Subs}}})
+	}
+	if filter.Hot && except != facetHot {
+		match = append(match, bson.E{"hotmovie", 1})
+	}
+	return match
+}
+
+// facetPipeline đếm số phim theo từng giá trị của field. lookup là collection chứa tên hiển thị
+// (genres, countries...), rỗng thì dùng chính giá trị làm nhãn
+func (filter *MovieFilter) facetPipeline(name string, field string, lookup string, sortBy bson.D) bson.A {
+	pipeline := bson.A{}
+	if match := filter.match(name); len(match) > 0 {
+		pipeline = append(pipeline, bson.D{{"$match", match}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{"$unwind", "$" + field}}, // Trường đơn (không phải mảng) giữ nguyên
+		bson.D{{"$group", bson.D{{"_id", "$" + field}, {"count", bson.D{{"$sum", 1}}}}}},
+		bson.D{{"$match", bson.D{{"_id", bson.D{{"$ne", nil}}}}}},
+	)
+
+	label := bson.D{{"$toString", "$_id"}}
+	if lookup != "" {
+		pipeline = append(pipeline,
+			bson.D{{"$lookup", bson.D{
+				{"from", lookup},
+				{"localField", "_id"},
+				{"foreignField", "_id"},
+				{"as", "details"},
+			}}},
+			// Bỏ các giá trị đã bị xóa
+			bson.D{{"$match", bson.D{{"details.deleted", bson.D{{"$ne", "deleted"}}}, {"details.0", bson.D{{"$exists", true}}}}}},
+		)
+		label = bson.D{{"$arrayElemAt", bson.A{"$details.title", 0}}}
+	}
+
+	return append(pipeline,
+		bson.D{{"$sort", sortBy}},
+		bson.D{{"$project", bson.D{
+			{"_id", 0},
+			{"value", bson.D{{"$toString", "$_id"}}},
+			{"label", label},
+			{"count", 1},
+		}}},
+	)
+}
+
+// Pagination đọc tham số phân trang của kết quả lọc. Chỉ sắp xếp theo position mới dùng được cursor,
+// các kiểu sắp xếp khác phân trang theo số trang
+func (filter *MovieFilter) Pagination(c *gin.Context) (pagination.Params, error) {
+	options := pagination.Options{DefaultLimit: filterPageSize}
+	if filter.Sort == SortPosition {
+		options.Order = pagination.ByPosition
+	}
+	params, err := pagination.Parse(c, options)
+	if err != nil {
+		return params, ErrInvalidFilter
+	}
+	return params, nil
+}
+
+// Pipeline tạo aggregation trả về một trang phim, tổng số phim và số đếm của các bộ lọc trong một lần truy vấn
+func (filter *MovieFilter) Pipeline(params pagination.Params) mongo.Pipeline {
+	// $text phải nằm ở stage đầu tiên
+	base := bson.D{}
+	if filter.Search != "" {
+		base = append(base, bson.E{"$text", bson.D{{"$search", filter.Search}}})
+	}
+	base = append(base,
+		bson.E{"deleted", bson.D{{"$ne", "deleted"}}}, // Bỏ qua các phim bị xóa
+		bson.E{"status", bson.D{{"$ne", 2}}},          // Bỏ qua các phim không hoạt động
+	)
+	pipeline := mongo.Pipeline{bson.D{{"$match", base}}}
+
+	sortBy := append(bson.D{}, filterSorts[filter.Sort]...)
+	if filter.Sort == SortRelevance {
+		pipeline = append(pipeline, bson.D{{"$addFields", bson.D{{"score", bson.D{{"$meta", "textScore"}}}}}})
+		sortBy = bson.D{{"score", -1}, {"position", 1}}
+	}
+	// _id giữ thứ tự ổn định giữa các trang khi các phim có cùng giá trị sắp xếp
+	sortBy = append(sortBy, bson.E{"_id", 1})
+
+	movies := bson.A{}
+	if match := filter.match(""); len(match) > 0 {
+		movies = append(movies, bson.D{{"$match", match}})
+	}
+	total := append(bson.A{}, movies...)
+	if seek := params.Seek(); seek != nil {
+		movies = append(movies, bson.D{{"$match", seek}})
+	}
+	movies = append(movies, bson.D{{"$sort", sortBy}})
+	for _, stage := range params.Window() {
+		movies = append(movies, stage)
+	}
+	total = append(total, bson.D{{"$count", "count"}})
+
+	byCount := bson.D{{"count", -1}, {"_id", 1}}
+	byValue := bson.D{{"_id", -1}}
+	return append(pipeline, bson.D{{"$facet", bson.D{
+		{"movies", movies},
+		{"total", total},
+		{"genres", filter.facetPipeline(facetGenre, "genre", "genres", byCount)},
+		{"countries", filter.facetPipeline(facetCountry, "country", "countries", byCount)},
+		{"categories", filter.facetPipeline(facetCategory, "category", "categories", byCount)},
+		{"years", filter.facetPipeline(facetYear, "year", "", byValue)},
+		{"qualities", filter.facetPipeline(facetQuality, "maxquality", "", byValue)},
+		{"subs", filter.facetPipeline(facetSub, "sub", "", byCount)},
+		{"hot", filter.facetPipeline(facetHot, "hotmovie", "", byValue)},
+	}}})
+}
+
+// markSelected đánh dấu các giá trị đang được chọn, selected là danh sách giá trị dạng chuỗi
+func markSelected(counts []FacetCount, selected []string) {
+	for i := range counts {
+		for _, value := range selected {
+			if counts[i].Value == value {
+				counts[i].Selected = true
+				break
+			}
+		}
+	}
+}
+
+// decorate gắn nhãn hiển thị và trạng thái được chọn, phần này không lưu vào cache
+func (listing *MovieListing) decorate() {
+	facets := &listing.Facets
+	values := listing.Filter.Values()
+	markSelected(facets.Genres, values["genre"])
+	markSelected(facets.Countries, values["country"])
+	markSelected(facets.Categories, values["category"])
+	markSelected(facets.Years, values["year"])
+	markSelected(facets.Qualities, values["quality"])
+	markSelected(facets.Subs, values["sub"])
+
+	for i := range facets.Qualities {
+		quality, _ := strconv.Atoi(facets.Qualities[i].Value)
+		facets.Qualities[i].Label = qualityLabels[quality]
+	}
+
+	// Chỉ giữ nhóm phim hot (hotmovie = 1)
+	var hot []FacetCount
+	for _, count := range facets.Hot {
+		if count.Value == "1" {
+			count.Label = "Hot"
+			count.Selected = listing.Filter.Hot
+			hot = append(hot, count)
+		}
+	}
+	facets.Hot = hot
+}
+
+// cacheable cho biết kết quả lọc được cache. Tìm theo từ khóa, cursor (vị trí tùy ý) và tổ hợp nhiều giá trị
+// thì không, để số key trong cache giới hạn theo số bộ lọc thật sự được dùng
+func (filter *MovieFilter) cacheable(params pagination.Params) bool {
+	if filter.Search != "" || params.Cursor != nil {
+		return false
+	}
+	count := len(filter.Genres) + len(filter.Countries) + len(filter.Categories) +
+		len(filter.Years) + len(filter.Qualities) + len(filter.Subs)
+	return count <= maxCachedFilterValues
+}
+
+// loadListing chạy aggregation của bộ lọc, trả về JSON của MovieListing và tag của các phim trong trang
+func loadListing(ctx context.Context, filter *MovieFilter, params pagination.Params) ([]byte, []string, error) {
+	cursor, err := models.GetMovieCollection().Aggregate(ctx, filter.Pipeline(params))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		MovieFacets `bson:",inline"`
+		Movies      []bson.Raw `bson:"movies"`
+		Total       []struct {
+			Count int `bson:"count"`
+		} `bson:"total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	total := 0
+	if len(result.Total) > 0 {
+		total = result.Total[0].Count
+	}
+	listing := MovieListing{Facets: result.MovieFacets}
+	if listing.Page, err = params.Finish(total, result.Movies, &listing.Movies); err != nil {
+		return nil, nil, err
+	}
+
+	// Gắn tag của từng phim để cập nhật một phim cũng làm mới kết quả này
+	tags := make([]string, 0, len(listing.Movies))
+	for _, movie := range listing.Movies {
+		tags = append(tags, dbs.MovieTag(movie.ID.Hex()))
+	}
+
+	listingJSON, err := json.Marshal(listing)
+	return listingJSON, tags, err
+}
+
+// FilterMovies lọc, sắp xếp và đếm phim theo tham số URL, dùng chung cho trang /search và API /movies
+func FilterMovies(c *gin.Context) (*MovieListing, error) {
+	filter, err := ParseMovieFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	params, err := filter.Pagination(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Context với timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Cache theo bộ lọc đã chuẩn hóa, mã băm để key không quá dài
+	var listingJSON []byte
+	if filter.cacheable(params) {
+		sum := sha1.Sum([]byte(filter.Values().Encode() + "&" + params.CacheKey()))
+		cacheKey := "moviesfilter_" + hex.EncodeToString(sum[:])
+		listingJSON, err = dbs.ReadThrough(ctx, cacheKey, catalogCacheOptions, func(ctx context.Context) ([]byte, []string, error) {
+			return loadListing(ctx, filter, params)
+		})
+	} else {
+		listingJSON, _, err = loadListing(ctx, filter, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var listing MovieListing
+	if err := json.Unmarshal(listingJSON, &listing); err != nil {
+		return nil, err
+	}
+	listing.Filter = filter
+	listing.Page.WithParams(params)
+	listing.decorate()
+
+	// Không có kết quả thường do gõ sai tên phim, gợi ý các tên gần giống
+	if listing.Total == 0 && filter.Search != "" {
+		listing.DidYouMean = search.DidYouMean(filter.Search)
+	}
+	return &listing, nil
+}
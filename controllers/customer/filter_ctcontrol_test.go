@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"fire-watch/pagination"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func parseFilter(t *testing.T, query string) (*MovieFilter, pagination.Params, error) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/movies?"+query, nil)
+
+	filter, err := ParseMovieFilter(c)
+	if err != nil {
+		return nil, pagination.Params{}, err
+	}
+	params, err := filter.Pagination(c)
+	return filter, params, err
+}
+
+// repeat tạo tham số lặp lại n lần, ví dụ repeat("year", "2020", 2) -> "year=2020&year=2020"
+func repeat(name string, value string, n int) string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = name + "=" + value
+	}
+	return strings.Join(values, "&")
+}
+
+func TestParseMovieFilterRejectsInvalidValues(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	cases := map[string]string{
+		"bad genre id":        "genre=not-an-id",
+		"short country id":    "country=64b0",
+		"bad category id":     "category=" + id + "&category=zz",
+		"too many genres":     repeat("genre", id, maxFilterValues+1),
+		"too many subs":       repeat("sub", "vietsub", maxFilterValues+1),
+		"too many years":      repeat("year", "2020", maxFilterValues+1),
+		"year not a number":   "year=abc",
+		"year not positive":   "year=0",
+		"unknown quality":     "quality=480",
+		"invalid hot":         "hot=maybe",
+		"unknown sort":        "sort=random",
+		"page too large":      "page=1001",
+		"cursor without sort": "sort=views&cursor=abc",
+	}
+	for name, query := range cases {
+		_, _, err := parseFilter(t, query)
+		assert.Equal(t, ErrInvalidFilter, err, name)
+	}
+}
+
+func TestParseMovieFilterChoosesSort(t *testing.T) {
+	cases := []struct {
+		query string
+		sort  string
+	}{
+		{"", SortPosition},
+		{"search=Iron+Man", SortRelevance},
+		{"sort=relevance", SortPosition}, // Không có từ khóa thì không sắp xếp theo độ liên quan được
+		{"search=iron&sort=relevance", SortRelevance},
+		{"search=iron&sort=views", SortViews},
+		{"sort=newest", SortNewest},
+		{"search=%20%21%21", SortPosition}, // Từ khóa chỉ có dấu câu coi như không tìm
+	}
+	for _, tc := range cases {
+		filter, _, err := parseFilter(t, tc.query)
+		assert.NoError(t, err, tc.query)
+		assert.Equal(t, tc.sort, filter.Sort, tc.query)
+	}
+}
+
+func TestParseMovieFilterNormalizesValues(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	filter, params, err := parseFilter(t, "search=Người+Nhện&genre="+second.Hex()+"&genre=&genre="+first.Hex()+"&year=2021&year=2019&hot=true&limit=500")
+	assert.NoError(t, err)
+	assert.Equal(t, "nguoi nhen", filter.Search)
+	assert.Equal(t, []primitive.ObjectID{second, first}, filter.Genres)
+	assert.True(t, filter.Hot)
+	assert.Equal(t, pagination.MaxLimit, params.Limit)
+
+	// Cùng bộ lọc theo thứ tự khác cho cùng chuỗi tham số
+	values := filter.Values()
+	assert.Equal(t, []string{"2019", "2021"}, values["year"])
+	assert.Len(t, values["genre"], 2)
+	assert.Equal(t, "relevance", values.Get("sort"))
+}
+
+// facetStages trả về các pipeline con trong stage $facet cuối cùng
+func facetStages(t *testing.T, filter *MovieFilter, params pagination.Params) map[string]bson.A {
+	pipeline := filter.Pipeline(params)
+	last := pipeline[len(pipeline)-1]
+	assert.Equal(t, "$facet", last[0].Key)
+
+	stages := map[string]bson.A{}
+	for _, element := range last[0].Value.(bson.D) {
+		stages[element.Key] = element.Value.(bson.A)
+	}
+	return stages
+}
+
+// matchKeys trả về các trường trong stage $match đầu tiên của pipeline con, nil nếu không có
+func matchKeys(stages bson.A) []string {
+	if len(stages) == 0 {
+		return nil
+	}
+	stage := stages[0].(bson.D)
+	if stage[0].Key != "$match" {
+		return nil
+	}
+	var keys []string
+	for _, element := range stage[0].Value.(bson.D) {
+		keys = append(keys, element.Key)
+	}
+	return keys
+}
+
+func TestPipelineFacetsExcludeOwnGroup(t *testing.T) {
+	filter, params, err := parseFilter(t, "genre="+primitive.NewObjectID().Hex()+"&year=2020&hot=1")
+	assert.NoError(t, err)
+	stages := facetStages(t, filter, params)
+
+	// Mỗi facet đếm trên các điều kiện của nhóm khác, danh sách phim dùng mọi điều kiện
+	cases := map[string][]string{
+		"movies":     {"genre", "year", "hotmovie"},
+		"total":      {"genre", "year", "hotmovie"},
+		"genres":     {"year", "hotmovie"},
+		"years":      {"genre", "hotmovie"},
+		"hot":        {"genre", "year"},
+		"countries":  {"genre", "year", "hotmovie"},
+		"categories": {"genre", "year", "hotmovie"},
+		"qualities":  {"genre", "year", "hotmovie"},
+		"subs":       {"genre", "year", "hotmovie"},
+	}
+	assert.Len(t, stages, len(cases))
+	for name, keys := range cases {
+		assert.Equal(t, keys, matchKeys(stages[name]), name)
+	}
+
+	total := stages["total"]
+	assert.Equal(t, bson.D{{Key: "$count", Value: "count"}}, total[len(total)-1])
+
+	// Facet có collection tên hiển thị thì lookup tên, facet khác dùng chính giá trị
+	assert.Contains(t, stages["genres"], bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "genres"},
+		{Key: "localField", Value: "_id"},
+		{Key: "foreignField", Value: "_id"},
+		{Key: "as", Value: "details"},
+	}}})
+	for _, stage := range stages["years"] {
+		assert.NotEqual(t, "$lookup", stage.(bson.D)[0].Key)
+	}
+}
+
+func TestPipelineWithoutFiltersHasNoMatch(t *testing.T) {
+	filter, params, err := parseFilter(t, "page=3&limit=10")
+	assert.NoError(t, err)
+	stages := facetStages(t, filter, params)
+
+	assert.Nil(t, matchKeys(stages["movies"]))
+	assert.Nil(t, matchKeys(stages["genres"]))
+	assert.Equal(t, bson.A{
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "position", Value: 1}, {Key: "_id", Value: 1}}}},
+		bson.M{"$skip": 20},
+		bson.M{"$limit": 11},
+	}, stages["movies"])
+}
+
+func TestPipelineSearchAndCursor(t *testing.T) {
+	filter, params, err := parseFilter(t, "search=iron+man")
+	assert.NoError(t, err)
+	pipeline := filter.Pipeline(params)
+
+	// $text phải nằm ở stage đầu tiên, sắp xếp theo độ liên quan
+	first := pipeline[0][0].Value.(bson.D)
+	assert.Equal(t, "$text", first[0].Key)
+	assert.Equal(t, "$addFields", pipeline[1][0].Key)
+	movies := facetStages(t, filter, params)["movies"]
+	assert.Equal(t, bson.D{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "position", Value: 1}, {Key: "_id", Value: 1}}}}, movies[0])
+
+	// Sắp xếp theo position dùng được cursor: điều kiện seek đứng trước $sort và không có $skip
+	position := int64(5)
+	cursor := &pagination.Cursor{Field: "position", Value: &position, ID: primitive.NewObjectID()}
+	filter, params, err = parseFilter(t, "year=2020&cursor="+cursor.Encode())
+	assert.NoError(t, err)
+	movies = facetStages(t, filter, params)["movies"]
+	assert.Equal(t, []string{"year"}, matchKeys(movies))
+	assert.Equal(t, bson.D{{Key: "$match", Value: params.Seek()}}, movies[1])
+	assert.Equal(t, bson.M{"$limit": filterPageSize + 1}, movies[len(movies)-1])
+}
+
+func TestFilterCacheSkipsSearchesCursorsAndLargeCombinations(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	position := int64(5)
+	cursor := (&pagination.Cursor{Field: "position", Value: &position, ID: primitive.NewObjectID()}).Encode()
+
+	cases := map[string]bool{
+		"":                 true,
+		"genre=" + id:      true,
+		"page=2&year=2020": true,
+		"search=iron":      false,
+		"cursor=" + cursor: false,
+		repeat("year", "2020", maxCachedFilterValues+1): false,
+	}
+	for query, cacheable := range cases {
+		filter, params, err := parseFilter(t, query)
+		assert.NoError(t, err, query)
+		assert.Equal(t, cacheable, filter.cacheable(params), query)
+	}
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fire-watch/models"
+	"fire-watch/search"
+	"fire-watch/websocket"
+	"fire-watch/websocket/events"
+	"log"
+	"time"
+)
+
+// Chu kỳ làm mới dự phòng cho các thay đổi không phát sự kiện (API /movies, sửa trực tiếp trong MongoDB)
+const titleIndexInterval = 10 * time.Minute
+
+// Gộp các sự kiện liên tiếp (sắp xếp lại vị trí, thêm nhiều phim) thành một lần làm mới
+const titleIndexDebounce = 2 * time.Second
+
+// refreshTitleIndex nạp lại tên các phim đang hiển thị vào chỉ mục gợi ý khi gõ sai
+func refreshTitleIndex() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	titles, err := models.ActiveMovieTitles(ctx)
+	if err != nil {
+		log.Println("Error loading movie titles for search:", err)
+		return
+	}
+	search.ReplaceTitles(titles)
+}
+
+// isMovieEvent cho biết frame là sự kiện thêm, sửa hoặc xóa phim
+func isMovieEvent(frame []byte) bool {
+	var envelope struct {
+		Entity events.Entity `json:"entity"`
+	}
+	if err := json.Unmarshal(websocket.EventData(frame), &envelope); err != nil {
+		return false
+	}
+	return envelope.Entity == events.EntityMovie
+}
+
+// WatchTitleIndex dựng chỉ mục gợi ý khi gõ sai rồi làm mới nó mỗi khi có sự kiện phim trên hub
+// (kể cả từ instance khác qua Redis). Chạy trong goroutine riêng và không bao giờ trả về
+func WatchTitleIndex(websocketServer *websocket.WebSocketServer) {
+	refreshTitleIndex()
+
+	// Làm mới chạy trong goroutine riêng để vòng nhận không bị chặn lúc truy vấn MongoDB và
+	// listener không bị hub loại khi buffer đầy. Yêu cầu đến lúc đang làm mới được gộp thành một lần
+	refresh := make(chan struct{}, 1)
+	go func() {
+		for range refresh {
+			refreshTitleIndex()
+		}
+	}()
+	requestRefresh := func() {
+		select {
+		case refresh <- struct{}{}:
+		default:
+		}
+	}
+
+	ticker := time.NewTicker(titleIndexInterval)
+	defer ticker.Stop()
+	debounce := time.NewTimer(titleIndexDebounce)
+	debounce.Stop()
+
+	for {
+		listener := websocketServer.Listen(websocket.TopicAdminCatalog)
+		for open := true; open; {
+			select {
+			case frame, ok := <-listener.Events:
+				if !ok {
+					open = false
+				} else if isMovieEvent(frame) {
+					debounce.Reset(titleIndexDebounce)
+				}
+			case <-debounce.C:
+				requestRefresh()
+			case <-ticker.C:
+				requestRefresh()
+			}
+		}
+
+		// Hub đã loại listener vì nhận quá chậm, có thể đã bỏ lỡ sự kiện nên nạp lại toàn bộ
+		listener.Close()
+		requestRefresh()
+	}
+}
@@ -6,17 +6,32 @@ import (
 	"encoding/json"
 	"fire-watch/dbs"
 	"fire-watch/models"
+	"fire-watch/pagination"
+	"fire-watch/search"
 	"fmt"
-	"log"
-	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func GetAllMovies(c *gin.Context) ([]models.Movie, error) {
+// Cấu hình cache cho các trang danh sách phim của khách hàng
+var catalogCacheOptions = dbs.CacheOptions{
+	TTL:      30 * time.Minute,
+	StaleTTL: 5 * time.Minute,
+	Tags:     []string{dbs.TagCatalog},
+}
+
+// Số phim trên mỗi trang của danh sách phim và số danh mục trên mỗi trang ở trang chủ
+const homePageSize = 6
+
+// Số phim hiển thị trong mỗi danh mục ở trang chủ
+const categoryMoviesLimit = 6
+
+// GetAllMovies trả về một trang phim đang hoạt động theo position, phân trang theo ?page hoặc ?cursor
+func GetAllMovies(c *gin.Context) ([]models.Movie, *pagination.Page, error) {
 	// Lấy collection Movie từ MongoDB
 	movieCollection := models.GetMovieCollection()
 
@@ -25,65 +40,82 @@ func GetAllMovies(c *gin.Context) ([]models.Movie, error) {
 	defer cancel()
 
 	// Lấy tham số phân trang từ query
-	pageStr := c.Query("page")
-	limit := 6 // Số lượng bản ghi trên mỗi trang
-
-	// Xử lý page
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page <= 0 {
-		page = 1 // Nếu không có hoặc không hợp lệ, mặc định là trang 1
+	params, err := pagination.Parse(c, pagination.Options{Order: pagination.ByPosition, DefaultLimit: homePageSize})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Tính toán `$skip`
-	skip := (page - 1) * limit
+	// Đọc qua cache, chỉ một caller truy vấn MongoDB khi cache hết hạn
+	cacheKey := "movieshome_" + params.CacheKey()
+	moviesJSON, err := readPage(ctx, cacheKey, params, func(ctx context.Context) ([]byte, []string, error) {
+		pipeline := mongo.Pipeline{
+			bson.D{{"$match", bson.D{{"deleted", bson.D{{"$ne", "deleted"}}}}}},
+			bson.D{{"$match", bson.D{{"status", bson.D{{"$ne", 2}}}}}},
+			params.Facet(), // Một trang phim và tổng số phim
+		}
+
+		cursor, err := movieCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer cursor.Close(ctx)
+
+		var result pagination.Result
+		if cursor.Next(ctx) {
+			if err := cursor.Decode(&result); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			return nil, nil, err
+		}
 
-	// Kiểm tra cache từ Redis
-	cacheKey := fmt.Sprintf("movieshome_page_%d", page)
-	cachedMovies, err := dbs.RedisClient.Get(ctx, cacheKey).Result()
-	if err == nil && cachedMovies != "" {
 		var movies []models.Movie
-		if err := json.Unmarshal([]byte(cachedMovies), &movies); err == nil {
-			return movies, nil
+		page, err := params.Finish(result.Count(), result.Items, &movies)
+		if err != nil {
+			return nil, nil, err
 		}
-	}
 
-	// Trường hợp cache không có, lấy dữ liệu từ MongoDB
-	var movies []models.Movie
-	pipeline := mongo.Pipeline{
-		bson.D{{"$match", bson.D{{"deleted", bson.D{{"$ne", "deleted"}}}}}},
-		bson.D{{"$match", bson.D{{"status", bson.D{{"$ne", 2}}}}}},
-		bson.D{{"$sort", bson.D{{"position", 1}}}}, // Sắp xếp theo trường `position`
-		bson.D{{"$skip", skip}},                    // Bỏ qua số lượng bản ghi tương ứng với `skip`
-		bson.D{{"$limit", limit}},                  // Lấy tối đa `limit` bản ghi
-	}
+		// Gắn tag của từng phim để cập nhật một phim cũng làm mới trang này
+		tags := make([]string, 0, len(movies))
+		for _, movie := range movies {
+			tags = append(tags, dbs.MovieTag(movie.ID.Hex()))
+		}
 
-	cursor, err := movieCollection.Aggregate(ctx, pipeline)
+		moviesJSON, err := json.Marshal(moviePage{Movies: movies, Page: page})
+		return moviesJSON, tags, err
+	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var movie models.Movie
-		if err := cursor.Decode(&movie); err != nil {
-			return nil, err
-		}
-		movies = append(movies, movie)
+	var cached moviePage
+	if err := json.Unmarshal(moviesJSON, &cached); err != nil {
+		return nil, nil, err
 	}
 
-	// Serialize dữ liệu movies để lưu cache
-	moviesJSON, _ := json.Marshal(movies)
+	return cached.Movies, cached.Page.WithParams(params), nil
+}
 
-	// Lưu cache vào Redis với TTL 30 phút
-	err = dbs.RedisClient.Set(ctx, cacheKey, string(moviesJSON), 30*time.Minute).Err()
-	if err != nil {
-		log.Printf("Error caching movies data: %v", err)
+// readPage đọc một trang danh sách qua cache. Trang theo cursor thì truy vấn trực tiếp: cursor do client
+// gửi lên nên không được đưa vào key cache, tránh tạo số key tùy ý trong Redis
+func readPage(ctx context.Context, cacheKey string, params pagination.Params, load dbs.CacheLoader) ([]byte, error) {
+	if params.Cursor != nil {
+		data, _, err := load(ctx)
+		return data, err
 	}
+	return dbs.ReadThrough(ctx, cacheKey, catalogCacheOptions, load)
+}
 
-	return movies, nil
+// moviePage là một trang phim lưu trong cache
+type moviePage struct {
+	Movies []models.Movie   `json:"movies"`
+	Page   *pagination.Page `json:"page"`
 }
 
-func GetCategoriesWithMovies(c *gin.Context) ([]bson.M, error) {
+// GetCategoriesWithMovies trả về một trang danh mục, mới tạo đứng trước, mỗi danh mục kèm vài phim đang hoạt động.
+// Tham số phân trang có tiền tố category_ để không lẫn với danh sách phim trên cùng trang chủ
+func GetCategoriesWithMovies(c *gin.Context) ([]bson.M, *pagination.Page, error) {
 	// Lấy collection Category từ MongoDB
 	categoryCollection := models.GetCategoryCollection()
 
@@ -92,86 +124,99 @@ func GetCategoriesWithMovies(c *gin.Context) ([]bson.M, error) {
 	defer cancel()
 
 	// Lấy tham số phân trang từ query
-	pageStr := c.Query("page")
-	limit := 6 // Số lượng bản ghi trên mỗi trang
+	params, err := pagination.Parse(c, pagination.Options{Order: pagination.NewestFirst, DefaultLimit: homePageSize, Prefix: "category_"})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Đọc qua cache, chỉ một caller chạy aggregation khi cache hết hạn
+	cacheKey := "categorieswithmovie_" + params.CacheKey()
+	categoriesJSON, err := readPage(ctx, cacheKey, params, func(ctx context.Context) ([]byte, []string, error) {
+		// Pipeline Aggregation
+		pipeline := mongo.Pipeline{
+			// Lọc các danh mục chưa bị xóa
+			bson.D{{"$match", bson.D{{"deleted", bson.D{{"$ne", "deleted"}}}}}},
+			// Một trang danh mục và tổng số danh mục, chỉ lookup phim cho các danh mục trong trang
+			params.Facet(
+				// Lookup để lấy danh sách phim
+				bson.D{{"$lookup", bson.D{
+					{"from", "movies"},           // Collection liên kết (movies)
+					{"localField", "_id"},        // Trường `_id` từ `categories`
+					{"foreignField", "category"}, // Trường `category` từ `movies`
+					{"as", "movies"},             // Kết quả sẽ được gắn vào `movies`
+				}}},
+				// Lọc các phim bị xóa hoặc không hoạt động
+				bson.D{{"$addFields", bson.D{
+					{"movies", bson.D{{"$filter", bson.D{
+						{"input", "$movies"},
+						{"as", "movie"},
+						{"cond", bson.D{
+							{"$and", bson.A{
+								bson.D{{"$ne", bson.A{"$$movie.deleted", "deleted"}}},
+								bson.D{{"$eq", bson.A{"$$movie.status", 1}}},
+							}},
+						}},
+					}}}},
+				}}},
+				// Giới hạn số lượng phim trong mỗi danh mục
+				bson.D{{"$addFields", bson.D{
+					{"movies", bson.D{{"$slice", bson.A{"$movies", categoryMoviesLimit}}}},
+				}}},
+			),
+		}
 
-	// Xử lý page
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page <= 0 {
-		page = 1 // Nếu không có hoặc không hợp lệ, mặc định là trang 1
-	}
+		// Thực thi aggregation
+		cursor, err := categoryCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer cursor.Close(ctx)
 
-	// Tính toán `$skip`
-	skip := (page - 1) * limit
+		var result pagination.Result
+		if cursor.Next(ctx) {
+			if err := cursor.Decode(&result); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err := cursor.Err(); err != nil {
+			return nil, nil, err
+		}
 
-	// Kiểm tra cache từ Redis
-	cacheKey := fmt.Sprintf("categorieswithmovie_%d", page)
-	cachedData, err := dbs.RedisClient.Get(ctx, cacheKey).Result()
-	if err == nil && cachedData != "" {
+		// Lấy kết quả và decode thành danh sách
 		var categorieswithmovie []bson.M
-		// Giải mã cache thành danh sách danh mục với phim
-		if err := json.Unmarshal([]byte(cachedData), &categorieswithmovie); err == nil {
-			// Trả về từ cache
-			return categorieswithmovie, nil
+		page, err := params.Finish(result.Count(), result.Items, &categorieswithmovie)
+		if err != nil {
+			return nil, nil, err
 		}
-	}
 
-	// Pipeline Aggregation
-	pipeline := mongo.Pipeline{
-		// Lọc các danh mục chưa bị xóa
-		bson.D{{"$match", bson.D{{"deleted", bson.D{{"$ne", "deleted"}}}}}},
-		// Lookup để lấy danh sách phim
-		bson.D{{"$lookup", bson.D{
-			{"from", "movies"},           // Collection liên kết (movies)
-			{"localField", "_id"},        // Trường `_id` từ `categories`
-			{"foreignField", "category"}, // Trường `category` từ `movies`
-			{"as", "movies"},             // Kết quả sẽ được gắn vào `movies`
-		}}},
-		// Lọc các phim bị xóa hoặc không hoạt động
-		bson.D{{"$addFields", bson.D{
-			{"movies", bson.D{{"$filter", bson.D{
-				{"input", "$movies"},
-				{"as", "movie"},
-				{"cond", bson.D{
-					{"$and", bson.A{
-						bson.D{{"$ne", bson.A{"$$movie.deleted", "deleted"}}},
-						bson.D{{"$eq", bson.A{"$$movie.status", 1}}},
-					}},
-				}},
-			}}}},
-		}}},
-		// Giới hạn số lượng phim trong mỗi danh mục
-		bson.D{{"$addFields", bson.D{
-			{"movies", bson.D{{"$slice", bson.A{"$movies", skip, limit}}}}, // Lấy phim từ vị trí `skip` đến `limit`
-		}}},
-		// Sắp xếp danh mục theo `created_at`
-		bson.D{{"$sort", bson.D{{"created_at", -1}}}},
-	}
+		// Gắn tag của từng danh mục
+		tags := make([]string, 0, len(categorieswithmovie))
+		for _, category := range categorieswithmovie {
+			if categoryID, ok := category["_id"].(primitive.ObjectID); ok {
+				tags = append(tags, dbs.CategoryTag(categoryID.Hex()))
+			}
+		}
 
-	// Thực thi aggregation
-	cursor, err := categoryCollection.Aggregate(ctx, pipeline)
+		categoriesJSON, err := json.Marshal(categoryPage{Categories: categorieswithmovie, Page: page})
+		return categoriesJSON, tags, err
+	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer cursor.Close(ctx)
 
-	// Lấy kết quả và decode thành danh sách
-	var categorieswithmovie []bson.M
-	if err := cursor.All(ctx, &categorieswithmovie); err != nil {
-		return nil, err
-	}
-
-	// Serialize dữ liệu categories để lưu cache
-	categoriesJSON, _ := json.Marshal(categorieswithmovie)
-
-	// Lưu vào Redis với TTL 30 phút
-	err = dbs.RedisClient.Set(ctx, cacheKey, string(categoriesJSON), 30*time.Minute).Err()
-	if err != nil {
-		log.Printf("Error caching categories with movies: %v", err)
+	var cached categoryPage
+	if err := json.Unmarshal(categoriesJSON, &cached); err != nil {
+		return nil, nil, err
 	}
 
 	// Trả về danh mục với phim
-	return categorieswithmovie, nil
+	return cached.Categories, cached.Page.WithParams(params), nil
+}
+
+// categoryPage là một trang danh mục kèm phim lưu trong cache
+type categoryPage struct {
+	Categories []bson.M         `json:"categories"`
+	Page       *pagination.Page `json:"page"`
 }
 
 func GetUserFromRedis(c *gin.Context) (map[string]interface{}, error) {
@@ -197,49 +242,10 @@ func GetUserFromRedis(c *gin.Context) (map[string]interface{}, error) {
 	return user, nil
 }
 
-func SearchMovies(c *gin.Context) ([]models.Movie, error) {
-	// Lấy collection Movie từ MongoDB
-	movieCollection := models.GetMovieCollection()
-
-	// Context với timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// SuggestMovies trả về gợi ý tên phim cho ô tìm kiếm từ chỉ mục trong Redis, không truy vấn MongoDB
+func SuggestMovies(c *gin.Context) ([]*search.Suggestion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	// Lấy từ khóa tìm kiếm từ query parameter
-	searchQuery := c.Query("search")
-	if searchQuery == "" {
-		return nil, fmt.Errorf("Search query is empty")
-	}
-
-	// Tạo pipeline để tìm kiếm trong MongoDB
-	pipeline := mongo.Pipeline{
-		bson.D{{"$match", bson.D{
-			{"deleted", bson.D{{"$ne", "deleted"}}},                       // Bỏ qua các phim bị xóa
-			{"status", bson.D{{"$ne", 2}}},                                // Bỏ qua các phim không hoạt động
-			{"title", bson.D{{"$regex", searchQuery}, {"$options", "i"}}}, // Tìm kiếm không phân biệt chữ hoa/thường
-		}}},
-		bson.D{{"$sort", bson.D{{"position", 1}}}}, // Sắp xếp theo vị trí tăng dần
-	}
-
-	// Lấy kết quả từ MongoDB
-	cursor, err := movieCollection.Aggregate(ctx, pipeline)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var movies []models.Movie
-	for cursor.Next(ctx) {
-		var movie models.Movie
-		if err := cursor.Decode(&movie); err != nil {
-			return nil, err
-		}
-		movies = append(movies, movie)
-	}
-
-	if err := cursor.Err(); err != nil {
-		return nil, err
-	}
-
-	return movies, nil
+	return search.Suggest(ctx, c.Query("q"))
 }
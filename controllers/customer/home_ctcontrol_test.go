@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"context"
+	"fire-watch/dbs"
+	"fire-watch/pagination"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReadPageSkipsCacheForCursors(t *testing.T) {
+	mr := miniredis.RunT(t)
+	dbs.RedisClient = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { dbs.RedisClient.Close() })
+	ctx := context.Background()
+
+	var calls int
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		calls++
+		return []byte(`{"movies":[]}`), nil, nil
+	}
+
+	// Cursor tùy ý do client gửi lên không tạo key trong Redis
+	position := int64(5)
+	params := pagination.Params{Order: pagination.ByPosition, Limit: homePageSize,
+		Cursor: &pagination.Cursor{Field: "position", Value: &position, ID: primitive.NewObjectID()}}
+	data, err := readPage(ctx, "movieshome_"+params.CacheKey(), params, load)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"movies":[]}`, string(data))
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, mr.Keys())
+
+	// Trang theo số trang vẫn đọc qua cache
+	params = pagination.Params{Order: pagination.ByPosition, Limit: homePageSize, Page: 2}
+	_, err = readPage(ctx, "movieshome_"+params.CacheKey(), params, load)
+	assert.NoError(t, err)
+	assert.True(t, mr.Exists("movieshome_"+params.CacheKey()))
+}
@@ -7,16 +7,20 @@ import (
 	"fire-watch/dbs"
 	"fire-watch/models"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// Cấu hình cache cho trang chi tiết phim
+var movieDetailCacheOptions = dbs.CacheOptions{
+	TTL:      10 * time.Minute,
+	StaleTTL: 2 * time.Minute,
+}
+
 func GetMoviesDetail(c *gin.Context) (*models.Movie, error) {
 	// Lấy collection Movie từ MongoDB
 	movieCollection := models.GetMovieCollection()
@@ -32,13 +36,10 @@ func GetMoviesDetail(c *gin.Context) (*models.Movie, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Khóa cache Redis
+	// Đọc qua cache, chỉ một caller chạy aggregation khi cache hết hạn
 	cacheKey := "movie_detail_" + id
-
-	// Kiểm tra dữ liệu trong Redis cache
-	cachedMovie, err := dbs.RedisClient.Get(ctx, cacheKey).Result()
-	if err == redis.Nil {
-		// Cache không tồn tại, lấy dữ liệu từ MongoDB qua Aggregation Pipeline
+	movieJSON, err := dbs.ReadThrough(ctx, cacheKey, movieDetailCacheOptions, func(ctx context.Context) ([]byte, []string, error) {
+		// Lấy dữ liệu từ MongoDB qua Aggregation Pipeline
 		pipeline := mongo.Pipeline{
 			// Match movie by ID and exclude deleted
 			bson.D{{"$match", bson.D{{"_id", movieID}, {"deleted", bson.D{{"$ne", "deleted"}}}}}},
@@ -230,46 +231,51 @@ func GetMoviesDetail(c *gin.Context) (*models.Movie, error) {
 		// Thực thi pipeline
 		cursor, err := movieCollection.Aggregate(ctx, pipeline)
 		if err != nil {
-			return nil, fmt.Errorf("Error running aggregation: %v", err)
+			return nil, nil, fmt.Errorf("Error running aggregation: %v", err)
 		}
 		defer cursor.Close(ctx)
 
 		// Giải mã kết quả
 		var movies []models.Movie
 		if err := cursor.All(ctx, &movies); err != nil {
-			return nil, fmt.Errorf("Error decoding aggregation result: %v", err)
+			return nil, nil, fmt.Errorf("Error decoding aggregation result: %v", err)
 		}
 		if len(movies) == 0 {
-			return nil, fmt.Errorf("Movie not found")
-		}
-		movie := movies[0]
-
-		// Serialize dữ liệu để lưu vào Redis cache
-		jsonData, err := json.Marshal(movie)
-		if err != nil {
-			log.Printf("Error serializing movie data for cache: %v", err)
-		} else {
-			// Lưu vào Redis với TTL 10 phút
-			cacheErr := dbs.RedisClient.Set(ctx, cacheKey, jsonData, 10*time.Minute).Err()
-			if cacheErr != nil {
-				log.Printf("Error caching movie data: %v", cacheErr)
-			}
+			return nil, nil, fmt.Errorf("Movie not found")
 		}
 
-		// Trả về dữ liệu phim
-		return &movie, nil
-	} else if err != nil {
-		// Lỗi khi truy cập Redis
-		return nil, fmt.Errorf("Error fetching cache: %v", err)
+		// Gắn tag của phim, thể loại và server liên quan
+		movieJSON, err := json.Marshal(movies[0])
+		return movieJSON, movieDetailTags(&movies[0]), err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Redis cache tồn tại, giải mã JSON thành kiểu models.Movie
+	// Giải mã JSON thành kiểu models.Movie
 	var movie models.Movie
-	err = json.Unmarshal([]byte(cachedMovie), &movie)
-	if err != nil {
+	if err := json.Unmarshal(movieJSON, &movie); err != nil {
 		return nil, fmt.Errorf("Error decoding cached movie data: %v", err)
 	}
 
-	// Trả về dữ liệu phim từ cache
+	// Trả về dữ liệu phim
 	return &movie, nil
 }
+
+// movieDetailTags trả về các tag mà cache chi tiết phim phụ thuộc vào
+func movieDetailTags(movie *models.Movie) []string {
+	tags := []string{dbs.MovieTag(movie.ID.Hex())}
+	for _, genreID := range movie.Genre {
+		tags = append(tags, dbs.GenreTag(genreID.Hex()))
+	}
+	seen := make(map[primitive.ObjectID]bool)
+	for _, episode := range movie.EpisodeDetails {
+		for _, serverID := range episode.Server {
+			if !seen[serverID] {
+				seen[serverID] = true
+				tags = append(tags, dbs.ServerTag(serverID.Hex()))
+			}
+		}
+	}
+	return tags
+}
@@ -32,6 +32,7 @@ func AddMovie(c *gin.Context) {
 	// Gán ngày giờ hiện tại cho trường Createat
 	movie.CreatedAt = time.Now()
 	movie.UpdatedAt = time.Now()
+	movie.RefreshSearch()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -42,6 +43,11 @@ func AddMovie(c *gin.Context) {
 		return
 	}
 
+	// Cập nhật chỉ mục gợi ý tìm kiếm
+	if err := models.SyncMovieSuggestion(ctx, movie.ID); err != nil {
+		log.Printf("Error updating search suggestions: %v", err)
+	}
+
 	// Xóa cache tổng thể của danh sách movies
 	err = dbs.RedisClient.Del(ctx, "movies_cache").Err()
 	if err != nil {
@@ -150,6 +156,7 @@ func UpdateMovie(c *gin.Context) {
 
 	// Gán ngày giờ hiện tại cho trường Updateat
 	movie.UpdatedAt = time.Now()
+	movie.RefreshSearch()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -162,6 +169,11 @@ func UpdateMovie(c *gin.Context) {
 		return
 	}
 
+	// Cập nhật chỉ mục gợi ý tìm kiếm
+	if err := models.SyncMovieSuggestion(ctx, movie.ID); err != nil {
+		log.Printf("Error updating search suggestions: %v", err)
+	}
+
 	// Xóa cache liên quan đến movie đã được cập nhật
 	cacheKey := "movie_cache_" + movie.ID.Hex()
 	err = dbs.RedisClient.Del(ctx, cacheKey).Err()
@@ -197,6 +209,11 @@ func DeleteMovie(c *gin.Context) {
 		return
 	}
 
+	// Cập nhật chỉ mục gợi ý tìm kiếm
+	if err := models.SyncMovieSuggestion(ctx, movieID); err != nil {
+		log.Printf("Error updating search suggestions: %v", err)
+	}
+
 	// Xóa cache liên quan đến movie đã xóa
 	cacheKey := "movie_cache_" + id
 	err = dbs.RedisClient.Del(ctx, cacheKey).Err()
@@ -305,6 +322,7 @@ func CreateMoviesBulk(c *gin.Context) {
 		movie.ID = primitive.NewObjectID()
 		movie.CreatedAt = time.Now()
 		movie.UpdatedAt = time.Now()
+		movie.RefreshSearch()
 		movies = append(movies, movie)
 	}
 
@@ -314,5 +332,12 @@ func CreateMoviesBulk(c *gin.Context) {
 		return
 	}
 
+	// Cập nhật chỉ mục gợi ý tìm kiếm
+	for _, movie := range movies {
+		if err := models.SyncMovieSuggestion(ctx, movie.(models.Movie).ID); err != nil {
+			log.Printf("Error updating search suggestions: %v", err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Movies created successfully"})
 }
@@ -0,0 +1,385 @@
+// controller/profile_controller.go
+package controllers
+
+import (
+	"context"
+	middleware "fire-watch/auth"
+	"fire-watch/mailer"
+	"fire-watch/models"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Ảnh đại diện lưu trong views/uploads/avatars, phục vụ qua đường dẫn tĩnh /uploads
+const (
+	avatarDir     = "views/uploads/avatars"
+	avatarURL     = "/uploads/avatars/"
+	maxAvatarSize = 2 * 1024 * 1024 // 2MB
+)
+
+// Định dạng ảnh đại diện được chấp nhận, kiểm tra theo nội dung file thay vì header của client
+var avatarFormats = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// currentUser đọc người dùng đang đăng nhập mà RequireAuth lưu trong context
+func currentUser(c *gin.Context) (*models.User, bool) {
+	value, _ := c.Get("identity")
+	identity, ok := value.(*middleware.Identity)
+	if !ok || identity.APIKey != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	user, err := findUserByID(identity.UserID)
+	if err != nil || user.Status == models.UserStatusDisabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+	return user, true
+}
+
+// validUsername dùng cùng quy tắc với trường Username của models.User
+func validUsername(username string) bool {
+	length := utf8.RuneCountInString(username)
+	return length >= 3 && length <= 50
+}
+
+// updateCurrentUser ghi các trường thay đổi của người dùng
+func updateCurrentUser(user *models.User, update bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := models.GetUserCollection().UpdateOne(ctx, bson.M{"_id": user.ID}, update)
+	return err
+}
+
+// Thông tin tài khoản của người dùng đang đăng nhập
+func GetProfile(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, user.Redacted())
+}
+
+// Đổi tên người dùng, các trường khác (vai trò, trạng thái, mật khẩu) không đổi được ở đây
+func UpdateProfile(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Username string `json:"username"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile data"})
+		return
+	}
+	request.Username = strings.TrimSpace(request.Username)
+	if !validUsername(request.Username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "message": "Username must be between 3 and 50 characters"})
+		return
+	}
+
+	if err := updateCurrentUser(user, bson.M{"$set": bson.M{"username": request.Username, "update_at": time.Now()}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating profile"})
+		return
+	}
+
+	user.Username = request.Username
+	c.JSON(http.StatusOK, user.Redacted())
+}
+
+// Tải ảnh đại diện mới (form field "avatar"), ảnh cũ bị xóa
+func UploadAvatar(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar file is required"})
+		return
+	}
+	if file.Size > maxAvatarSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Avatar is too large, the maximum size is 2MB"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid avatar file"})
+		return
+	}
+	header := make([]byte, 512)
+	n, _ := src.Read(header)
+	src.Close()
+
+	extension, ok := avatarFormats[http.DetectContentType(header[:n])]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid avatar format, only JPEG, PNG and WEBP are allowed"})
+		return
+	}
+
+	if err := os.MkdirAll(avatarDir, 0o755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save avatar"})
+		return
+	}
+	// Tên file do server đặt, không dùng tên file của client
+	name := fmt.Sprintf("%s-%d%s", user.ID.Hex(), time.Now().UnixNano(), extension)
+	if err := c.SaveUploadedFile(file, filepath.Join(avatarDir, name)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save avatar"})
+		return
+	}
+
+	if err := updateCurrentUser(user, bson.M{"$set": bson.M{"avatar": avatarURL + name, "update_at": time.Now()}}); err != nil {
+		os.Remove(filepath.Join(avatarDir, name))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating profile"})
+		return
+	}
+	removeAvatar(user.Avatar)
+
+	user.Avatar = avatarURL + name
+	c.JSON(http.StatusOK, user.Redacted())
+}
+
+// removeAvatar xóa file ảnh đại diện cũ
+func removeAvatar(avatar string) {
+	if !strings.HasPrefix(avatar, avatarURL) {
+		return
+	}
+	if err := os.Remove(filepath.Join(avatarDir, filepath.Base(avatar))); err != nil && !os.IsNotExist(err) {
+		log.Println("Error removing avatar:", err)
+	}
+}
+
+// Đổi mật khẩu, cần mật khẩu hiện tại. Mọi phiên và token bị thu hồi, người dùng đăng nhập lại.
+func ChangePassword(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password data"})
+		return
+	}
+	if !checkPasswordHash(request.CurrentPassword, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	// Cùng quy tắc với trường Password của models.User
+	if len(request.NewPassword) < 6 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "message": "Password must be at least 6 characters"})
+		return
+	}
+
+	hashedPassword, err := hashPassword(request.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
+		return
+	}
+	if err := updateCurrentUser(user, bson.M{"$set": bson.M{"password": hashedPassword, "update_at": time.Now()}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating password"})
+		return
+	}
+
+	if err := middleware.RevokeUser(user.ID.Hex()); err != nil {
+		log.Println("Error revoking user tokens:", err)
+	}
+	middleware.ClearSessionCookie(c.Writer)
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed, please sign in again"})
+}
+
+// Đổi email: gửi liên kết xác minh tới địa chỉ mới, email chỉ thay khi người dùng mở liên kết
+func ChangeEmail(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email data"})
+		return
+	}
+	if !checkPasswordHash(request.CurrentPassword, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	address, err := mail.ParseAddress(request.Email)
+	if err != nil || address.Address != request.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "message": "Email must be a valid email address"})
+		return
+	}
+	request.Email = normalizeEmail(request.Email)
+	if request.Email == normalizeEmail(user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This is already your email"})
+		return
+	}
+
+	exists, err := isUserExists(request.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking user existence"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use"})
+		return
+	}
+
+	if err := updateCurrentUser(user, bson.M{"$set": bson.M{"pending_email": request.Email}}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating email"})
+		return
+	}
+
+	// Gửi tới địa chỉ mới: mở được liên kết nghĩa là người dùng sở hữu địa chỉ đó
+	pending := *user
+	pending.Email = request.Email
+	sendAccountEmail(&pending, middleware.EmailTokenChange, "/auth/verify-email", "Confirm your new Fire Watch email", func(link string) string {
+		return "Hi " + user.Username + ",\n\n" +
+			"Open the link below to use this address for your Fire Watch account:\n\n" + link + "\n\n" +
+			"The link expires in " + middleware.EmailTokenLifetime(middleware.EmailTokenChange).String() + ".\n"
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "We have sent a confirmation link to your new email"})
+}
+
+// Xác nhận email mới bằng liên kết đã gửi khi đổi email
+func ConfirmEmailChange(c *gin.Context) {
+	invalid := gin.H{"notice": "This confirmation link is invalid or has expired"}
+	userID, err := middleware.ConsumeEmailToken(middleware.EmailTokenChange, c.Query("token"))
+	if err != nil {
+		renderSignIn(c, http.StatusBadRequest, invalid)
+		return
+	}
+
+	user, err := findUserByID(userID)
+	if err != nil || user.PendingEmail == "" || user.Status == models.UserStatusDisabled {
+		renderSignIn(c, http.StatusBadRequest, invalid)
+		return
+	}
+
+	// Địa chỉ có thể đã được tài khoản khác đăng ký trong lúc chờ xác nhận
+	exists, err := isUserExists(user.PendingEmail)
+	if err != nil {
+		renderSignIn(c, http.StatusInternalServerError, gin.H{"notice": "Error updating email"})
+		return
+	}
+	if exists {
+		renderSignIn(c, http.StatusConflict, gin.H{"notice": "This email is already in use"})
+		return
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"email": user.PendingEmail, "update_at": time.Now()},
+		"$unset": bson.M{"pending_email": ""},
+	}
+	if err := updateCurrentUser(user, update); err != nil {
+		renderSignIn(c, http.StatusInternalServerError, gin.H{"notice": "Error updating email"})
+		return
+	}
+
+	// Báo cho địa chỉ cũ để chủ tài khoản phát hiện nếu không phải họ đổi
+	previous := user.Email
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		err := mailer.Send(ctx, mailer.Message{
+			To:      previous,
+			Subject: "Your Fire Watch email was changed",
+			Text: "Hi " + user.Username + ",\n\n" +
+				"The email of your Fire Watch account was changed to " + user.PendingEmail + ".\n" +
+				"If you did not make this change, please reset your password and contact us.\n",
+		})
+		if err != nil {
+			log.Println("Error sending email:", err)
+		}
+	}()
+
+	// Phiên và token cũ còn mang email cũ
+	if err := middleware.RevokeUser(userID); err != nil {
+		log.Println("Error revoking user tokens:", err)
+	}
+	renderSignIn(c, http.StatusOK, gin.H{"notice": "Your email has been changed, please sign in with your new email", "success": true})
+}
+
+// Xóa tài khoản của chính mình: ẩn danh dữ liệu cá nhân thay vì xóa bản ghi,
+// để các dữ liệu khác tham chiếu tới user ID không bị hỏng
+func DeleteAccount(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account data"})
+		return
+	}
+	if !checkPasswordHash(request.CurrentPassword, user.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if err := anonymizeUser(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting account"})
+		return
+	}
+	if err := middleware.RevokeUser(user.ID.Hex()); err != nil {
+		log.Println("Error revoking user tokens:", err)
+	}
+
+	middleware.ClearSessionCookie(c.Writer)
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// anonymizeUser xóa thông tin cá nhân và khóa tài khoản, email không còn đăng nhập hay khôi phục được
+func anonymizeUser(user *models.User) error {
+	update := bson.M{
+		"$set": bson.M{
+			"username":           "deleted-user-" + user.ID.Hex()[18:],
+			"email":              "deleted-" + user.ID.Hex() + "@users.invalid",
+			"password":           "",
+			"status":             models.UserStatusDisabled,
+			"deleted":            "deleted",
+			"two_factor_enabled": false,
+			"update_at":          time.Now(),
+		},
+		"$unset": bson.M{
+			"avatar":            "",
+			"pending_email":     "",
+			"two_factor_secret": "",
+			"recovery_codes":    "",
+		},
+	}
+	if err := updateCurrentUser(user, update); err != nil {
+		return err
+	}
+	removeAvatar(user.Avatar)
+	return nil
+}
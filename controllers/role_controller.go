@@ -4,6 +4,7 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	middleware "fire-watch/auth"
 	"fire-watch/dbs"
 	"fire-watch/models"
 	"github.com/gin-gonic/gin"
@@ -26,13 +27,86 @@ func InitializeroleCollection() {
 	roleCollection = dbs.DB.Collection("roles")
 }
 
+// LoadRolePermissions đọc quyền của vai trò đang hoạt động theo tên, dùng cho middleware.RequirePermission
+func LoadRolePermissions(ctx context.Context, name string) ([]string, error) {
+	var role models.Role
+	err := roleCollection.FindOne(ctx, bson.M{"name": name, "status": 1}).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return role.Permissions, nil
+}
+
+// Vai trò có sẵn, không cần bản ghi trong collection roles
+var builtinRoles = []string{"admin", "customer"}
+
+// roleAllowed cho biết vai trò có thể gán cho người dùng: vai trò có sẵn hoặc vai trò đang hoạt động
+func roleAllowed(ctx context.Context, name string) (bool, error) {
+	for _, value := range builtinRoles {
+		if name == value {
+			return true, nil
+		}
+	}
+
+	count, err := roleCollection.CountDocuments(ctx, bson.M{"name": name, "status": 1})
+	return count > 0, err
+}
+
+// validPermissions kiểm tra các quyền của vai trò đều là quyền đã định nghĩa
+func validPermissions(permissions []string) bool {
+	for _, permission := range permissions {
+		known := false
+		for _, value := range middleware.Permissions {
+			if permission == value {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return false
+		}
+	}
+	return true
+}
+
+// callerHolds cho biết người gọi có đủ các quyền, không ai được cấp cho vai trò hay người dùng khác
+// quyền mà chính mình không có
+func callerHolds(c *gin.Context, permissions []string) (bool, error) {
+	value, _ := c.Get("identity")
+	identity, ok := value.(*middleware.Identity)
+	if !ok {
+		return false, nil
+	}
+	return identity.Can(permissions...)
+}
+
+// checkGrantable trả lỗi cho client và false nếu người gọi không được cấp các quyền này
+func checkGrantable(c *gin.Context, permissions []string) bool {
+	allowed, err := callerHolds(c, permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot grant permissions you do not hold"})
+		return false
+	}
+	return true
+}
+
 // Thêm role mới
 func AddRole(c *gin.Context) {
 	var role models.Role
-	if err := c.ShouldBindJSON(&role); err != nil {
+	if err := c.ShouldBindJSON(&role); err != nil || !validPermissions(role.Permissions) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role data"})
 		return
 	}
+	if !checkGrantable(c, role.Permissions) {
+		return
+	}
 
 	role.ID = primitive.NewObjectID()
 	role.Status = 1 
@@ -48,6 +122,7 @@ func AddRole(c *gin.Context) {
 
 	// Xóa cache Redis sau khi thêm role mới
 	dbs.RedisClient.Del(ctx, "roles")
+	middleware.InvalidateRolePermissions()
 
 	c.JSON(http.StatusOK, role)
 }
@@ -136,10 +211,13 @@ func GetRoleByID(c *gin.Context) {
 // Cập nhật role
 func UpdateRole(c *gin.Context) {
 	var role models.Role
-	if err := c.ShouldBindJSON(&role); err != nil {
+	if err := c.ShouldBindJSON(&role); err != nil || !validPermissions(role.Permissions) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role data"})
 		return
 	}
+	if !checkGrantable(c, role.Permissions) {
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -156,6 +234,7 @@ func UpdateRole(c *gin.Context) {
 	// Xóa cache Redis sau khi cập nhật
 	dbs.RedisClient.Del(ctx, "role_"+role.ID.Hex())
 	dbs.RedisClient.Del(ctx, "roles")
+	middleware.InvalidateRolePermissions()
 
 	c.JSON(http.StatusOK, gin.H{"message": "role updated successfully"})
 }
@@ -181,6 +260,7 @@ func DeleteRole(c *gin.Context) {
 	// Xóa cache Redis sau khi xóa
 	dbs.RedisClient.Del(ctx, "role_"+id)
 	dbs.RedisClient.Del(ctx, "roles")
+	middleware.InvalidateRolePermissions()
 
 	c.JSON(http.StatusOK, gin.H{"message": "role deleted successfully"})
 }
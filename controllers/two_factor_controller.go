@@ -0,0 +1,355 @@
+// controller/two_factor_controller.go
+package controllers
+
+import (
+	"context"
+	middleware "fire-watch/auth"
+	"fire-watch/models"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Header chứa pre-auth token khi đăng ký TOTP trong lúc đăng nhập (vai trò bắt buộc 2FA)
+const preAuthHeader = "X-Pre-Auth-Token"
+
+// findUserByID đọc người dùng theo ID dạng hex
+func findUserByID(id string) (*models.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var user models.User
+	if err := models.GetUserCollection().FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// twoFactorUser xác định người dùng đang đăng ký TOTP: đã đăng nhập, hoặc có pre-auth token
+// khi lần đăng nhập bị từ chối vì vai trò bắt buộc 2FA
+func twoFactorUser(c *gin.Context) (*models.User, bool) {
+	userID := ""
+	if identity, err := middleware.Authenticate(c.Request); err == nil {
+		userID = identity.UserID
+	} else if id, err := middleware.PreAuthUser(c.GetHeader(preAuthHeader)); err == nil {
+		userID = id
+	} else {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	user, err := findUserByID(userID)
+	if err != nil || user.Status == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+	return user, true
+}
+
+// verifySecondFactor kiểm tra mã TOTP hoặc recovery code, recovery code bị xóa ngay khi dùng
+func verifySecondFactor(user *models.User, code string, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// $pull có điều kiện là thao tác nguyên tử, hai request cùng một mã chỉ một request thành công
+		hash := middleware.HashRecoveryCode(recoveryCode)
+		result, err := models.GetUserCollection().UpdateOne(ctx,
+			bson.M{"_id": user.ID, "recovery_codes": hash},
+			bson.M{"$pull": bson.M{"recovery_codes": hash}, "$set": bson.M{"update_at": time.Now()}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return result.ModifiedCount == 1, nil
+	}
+	return middleware.VerifyTOTP(user.ID.Hex(), user.TwoFactorSecret, code)
+}
+
+// checkSecondFactor kiểm tra mã bằng verify với giới hạn nhập sai theo người dùng (chung cho đăng nhập,
+// tắt 2FA và tạo lại recovery code), tự trả phản hồi lỗi khi mã sai hoặc đang bị chặn
+func checkSecondFactor(c *gin.Context, user *models.User, verify func() (bool, error)) bool {
+	retry, err := middleware.TwoFactorRetryAfter(user.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying two-factor code"})
+		return false
+	}
+	if retry > 0 {
+		tooManyTwoFactorAttempts(c, retry)
+		return false
+	}
+
+	valid, err := verify()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying two-factor code"})
+		return false
+	}
+	if !valid {
+		retry, err := middleware.RecordTwoFactorFailure(user.ID.Hex())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying two-factor code"})
+			return false
+		}
+		if retry > 0 {
+			tooManyTwoFactorAttempts(c, retry)
+			return false
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return false
+	}
+
+	if err := middleware.ResetTwoFactorFailures(user.ID.Hex()); err != nil {
+		log.Println("Error resetting two-factor failures:", err)
+	}
+	return true
+}
+
+// tooManyTwoFactorAttempts trả 429 kèm Retry-After khi người dùng nhập sai mã quá nhiều lần
+func tooManyTwoFactorAttempts(c *gin.Context, retry time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many two-factor attempts, please try again later"})
+}
+
+// Bước thứ hai của đăng nhập: đổi pre-auth token và mã TOTP (hoặc recovery code) lấy token đăng nhập
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var request struct {
+		PreAuthToken string `json:"pre_auth_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || (request.Code == "" && request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor data"})
+		return
+	}
+
+	userID, err := middleware.PreAuthUser(request.PreAuthToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login session expired, please sign in again"})
+		return
+	}
+
+	user, err := findUserByID(userID)
+	if err != nil || user.Status == 0 || !user.TwoFactorEnabled {
+		middleware.DeletePreAuthToken(request.PreAuthToken)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login session expired, please sign in again"})
+		return
+	}
+
+	// Mã sai được đếm theo cả pre-auth token và người dùng
+	verified := checkSecondFactor(c, user, func() (bool, error) {
+		ok, err := verifySecondFactor(user, request.Code, request.RecoveryCode)
+		if err == nil && !ok {
+			err = middleware.RecordPreAuthFailure(request.PreAuthToken)
+		}
+		return ok, err
+	})
+	if !verified {
+		return
+	}
+
+	// Pre-auth token chỉ dùng một lần
+	if err := middleware.DeletePreAuthToken(request.PreAuthToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	completeLogin(c, user)
+}
+
+// Bắt đầu đăng ký TOTP: sinh secret mới, trả về URI otpauth:// để hiển thị mã QR
+func SetupTwoFactor(c *gin.Context) {
+	user, ok := twoFactorUser(c)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := middleware.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	if err := middleware.SetPendingTOTPSecret(user.ID.Hex(), secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": middleware.TOTPProvisioningURI(secret, user.Email),
+	})
+}
+
+// Xác nhận đăng ký TOTP bằng một mã đúng, bật 2FA và trả về recovery code (chỉ hiển thị một lần)
+func EnableTwoFactor(c *gin.Context) {
+	user, ok := twoFactorUser(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor data"})
+		return
+	}
+
+	secret, err := middleware.PendingTOTPSecret(user.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading secret"})
+		return
+	}
+	if secret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor setup expired, please start again"})
+		return
+	}
+
+	valid, err := middleware.VerifyTOTP(user.ID.Hex(), secret, request.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying two-factor code"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, err := middleware.GenerateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = models.GetUserCollection().UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+		"two_factor_enabled": true,
+		"two_factor_secret":  secret,
+		"recovery_codes":     hashes,
+		"update_at":          time.Now(),
+	}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error enabling two-factor authentication"})
+		return
+	}
+	middleware.ClearPendingTOTPSecret(user.ID.Hex())
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// Tắt xác thực hai bước, cần mã TOTP hoặc recovery code hiện tại
+func DisableTwoFactor(c *gin.Context) {
+	user, ok := twoFactorUser(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || (request.Code == "" && request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor data"})
+		return
+	}
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	required, err := middleware.TwoFactorRequired(user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for this account"})
+		return
+	}
+
+	verified := checkSecondFactor(c, user, func() (bool, error) {
+		return verifySecondFactor(user, request.Code, request.RecoveryCode)
+	})
+	if !verified {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = models.GetUserCollection().UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set":   bson.M{"two_factor_enabled": false, "update_at": time.Now()},
+		"$unset": bson.M{"two_factor_secret": "", "recovery_codes": ""},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error disabling two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// Tạo bộ recovery code mới, các mã cũ không dùng được nữa
+func RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := twoFactorUser(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor data"})
+		return
+	}
+	if !user.TwoFactorEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	verified := checkSecondFactor(c, user, func() (bool, error) {
+		return middleware.VerifyTOTP(user.ID.Hex(), user.TwoFactorSecret, request.Code)
+	})
+	if !verified {
+		return
+	}
+
+	codes, hashes, err := middleware.GenerateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = models.GetUserCollection().UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+		"recovery_codes": hashes,
+		"update_at":      time.Now(),
+	}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
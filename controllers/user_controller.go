@@ -7,7 +7,12 @@ import (
 	middleware "fire-watch/auth"
 	"fire-watch/dbs"
 	"fire-watch/models"
+	"fire-watch/websocket"
+	"fire-watch/websocket/events"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -25,19 +30,8 @@ func hashPassword(password string) (string, error) {
 
 // Kiểm tra người dùng đã tồn tại hay chưa bằng email
 func isUserExists(email string) (bool, error) {
-	userCollection := models.GetUserCollection()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	var user models.User
-	err := userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return false, nil
-		}
-		return false, err
-	}
-	return true, nil
+	user, err := findUserByEmail(email)
+	return user != nil, err
 }
 
 // Đăng ký người dùng mới
@@ -60,6 +54,7 @@ func RegisterUser(c *gin.Context) {
 	}
 
 	// Kiểm tra người dùng đã tồn tại
+	user.Email = normalizeEmail(user.Email)
 	exists, err := isUserExists(user.Email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking user existence"})
@@ -80,9 +75,9 @@ func RegisterUser(c *gin.Context) {
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 	user.Password = hashedPassword
-	user.ID = primitive.NewObjectID() // Tạo ObjectID mới cho người dùng
-	user.Status = 1                   // Mặc định trạng thái là hoạt động
-	user.Role = "customer"            // Mặc định vai trò là customer
+	user.ID = primitive.NewObjectID()      // Tạo ObjectID mới cho người dùng
+	user.Status = models.UserStatusPending // Hoạt động sau khi xác minh email
+	user.Role = "customer"                 // Mặc định vai trò là customer
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -93,12 +88,13 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	sendVerificationEmail(&user)
+
+	c.JSON(http.StatusOK, user.Redacted())
 }
 
 // Đăng nhập người dùng
-func LoginUser(c *gin.Context) {
-	userCollection := models.GetUserCollection()
+func LoginUser(c *gin.Context, websocketServer *websocket.WebSocketServer) {
 	var credentials struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -109,28 +105,119 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// Bộ đếm đăng nhập sai và tìm tài khoản dùng cùng một email đã chuẩn hóa
+	email := normalizeEmail(credentials.Email)
 
-	err := userCollection.FindOne(ctx, bson.M{"email": credentials.Email}).Decode(&user)
+	// Tài khoản hoặc IP đang bị khóa tạm thời vì đăng nhập sai nhiều lần
+	ip := c.ClientIP()
+	retry, err := middleware.LoginRetryAfter(email, ip)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking login attempts"})
+		return
+	}
+	if retry > 0 {
+		tooManyLoginAttempts(c, retry)
+		return
+	}
+
+	var user models.User
+	account, err := findUserByEmail(email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+		return
+	}
+	found := account != nil
+	if found {
+		user = *account
+	}
+
+	// Email không tồn tại vẫn so sánh với hash giả để thời gian phản hồi giống nhau
+	passwordHash := dummyPasswordHash
+	if found {
+		passwordHash = user.Password
+	}
+
+	// Kiểm tra mật khẩu, cùng một thông báo lỗi cho email sai và mật khẩu sai
+	if !checkPasswordHash(credentials.Password, passwordHash) || !found {
+		failure, err := middleware.RecordLoginFailure(email, ip)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error recording login attempt"})
+			return
+		}
+		if failure.Locked && found {
+			notifyAccountLocked(websocketServer, &user, ip, failure)
+		}
+		if failure.Retry > 0 {
+			tooManyLoginAttempts(c, failure.Retry)
+			return
 		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	if err := middleware.ResetLoginFailures(email); err != nil {
+		log.Println("Error resetting login failures:", err)
+	}
+
+	// Tài khoản bị khóa không được đăng nhập
+	if user.Status == models.UserStatusDisabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+	if user.Status == models.UserStatusPending {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email before signing in", "email_unverified": true})
 		return
 	}
 
-	// Kiểm tra mật khẩu
-	if !checkPasswordHash(credentials.Password, user.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	// Đã bật xác thực hai bước: chỉ cấp pre-auth token, đăng nhập hoàn tất ở /auth/login/2fa
+	required, err := middleware.TwoFactorRequired(user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
 		return
 	}
+	if user.TwoFactorEnabled || required {
+		preAuthToken, err := middleware.CreatePreAuthToken(user.ID.Hex())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+			return
+		}
+
+		// Vai trò bắt buộc 2FA nhưng chưa đăng ký: pre-auth token chỉ dùng để đăng ký TOTP
+		if !user.TwoFactorEnabled {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                     "Two-factor authentication must be enabled for this account",
+				"two_factor_setup_required": true,
+				"pre_auth_token":            preAuthToken,
+				"expires_in":                int(middleware.PreAuthTokenLifetime.Seconds()),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"pre_auth_token":      preAuthToken,
+			"expires_in":          int(middleware.PreAuthTokenLifetime.Seconds()),
+		})
+		return
+	}
+
+	completeLogin(c, &user)
+}
+
+// completeLogin cấp token, tạo phiên đăng nhập và trả phản hồi sau khi người dùng đã xác thực đủ các bước
+func completeLogin(c *gin.Context, user *models.User) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	identity := &middleware.Identity{
+		UserID:   user.ID.Hex(),
+		Email:    user.Email,
+		Username: user.Username,
+		Role:     user.Role,
+	}
 
-	// Tạo JWT token
-	tokenString, err := middleware.CreateToken(user.ID.Hex(), user.Email, user.Username, user.Password, user.Role, user.Status)
+	// Tạo access token ngắn hạn và refresh token
+	tokens, err := middleware.IssueTokens(identity, user.Status, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
 		return
@@ -150,19 +237,109 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
+	// Tạo phiên đăng nhập, cookie chỉ chứa ID phiên ngẫu nhiên
+	session, err := middleware.CreateSession(identity)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	middleware.SetSessionCookie(c.Writer, session)
+
 	// Phản hồi đăng nhập thành công với token
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   tokenString,
-		"user_id": user.ID.Hex(),
-		"role":    user.Role,
+		"message":       "Login successful",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"user_id":       user.ID.Hex(),
+		"role":          user.Role,
 	})
 }
 
+// Hash bcrypt của một mật khẩu ngẫu nhiên, dùng khi email không tồn tại
+var dummyPasswordHash = func() string {
+	hash, _ := hashPassword(primitive.NewObjectID().Hex())
+	return hash
+}()
+
+// tooManyLoginAttempts trả 429 kèm header Retry-After (giây)
+func tooManyLoginAttempts(c *gin.Context, retry time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many login attempts, please try again later"})
+}
+
+// notifyAccountLocked báo cho admin qua WebSocket khi một tài khoản quản trị bị khóa
+func notifyAccountLocked(websocketServer *websocket.WebSocketServer, user *models.User, ip string, failure *middleware.LoginFailure) {
+	staff, err := middleware.IsStaff(user.Role)
+	if err != nil || !staff {
+		return
+	}
+
+	event := events.NewAccountLockedEvent(user.ID.Hex(), user.Email, ip, failure.Failures, time.Now().Add(failure.Retry))
+	messageJSON, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Error encoding JSON message:", err)
+		return
+	}
+	websocketServer.Publish(messageJSON, websocket.TopicAdminSecurity)
+}
+
+// Đổi refresh token lấy cặp token mới, refresh token cũ không dùng lại được
+func RefreshToken(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refresh data"})
+		return
+	}
+
+	userID, family, err := middleware.UseRefreshToken(request.RefreshToken)
+	switch err {
+	case nil:
+	case middleware.ErrInvalidRefreshToken, middleware.ErrRefreshTokenReused:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	// Đọc lại người dùng để token mới mang vai trò hiện tại và chặn tài khoản đã bị khóa
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	var user models.User
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := models.GetUserCollection().FindOne(ctx, bson.M{"_id": objectID}).Decode(&user); err != nil || user.Status == 0 {
+		middleware.RevokeFamily(family)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	tokens, err := middleware.IssueTokens(&middleware.Identity{
+		UserID:   user.ID.Hex(),
+		Email:    user.Email,
+		Username: user.Username,
+		Role:     user.Role,
+	}, user.Status, family)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
 // Lấy tất cả người dùng
 func GetAllUsers(c *gin.Context) {
 	userCollection := models.GetUserCollection()
-	var users []models.User
+	users := []models.UserResponse{}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -179,7 +356,7 @@ func GetAllUsers(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding user"})
 			return
 		}
-		users = append(users, user)
+		users = append(users, user.Redacted())
 	}
 
 	c.JSON(http.StatusOK, users)
@@ -209,10 +386,11 @@ func GetUserByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, user.Redacted())
 }
 
-// Cập nhật thông tin người dùng
+// Admin cập nhật người dùng: chỉ đổi được tên, vai trò (phải là vai trò hợp lệ, không nhiều quyền hơn người gọi) và trạng thái.
+// Mật khẩu và email do chính người dùng đổi qua /me.
 func UpdateUser(c *gin.Context) {
 	userCollection := models.GetUserCollection()
 	id := c.Param("id")
@@ -222,25 +400,67 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
-	var updatedUser models.User
-	if err := c.ShouldBindJSON(&updatedUser); err != nil {
+	var request struct {
+		Username *string `json:"username"`
+		Role     *string `json:"role"`
+		Status   *int    `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user data"})
 		return
 	}
-	updatedUser.UpdatedAt = time.Now()
+
+	// Không ai tự đổi vai trò hay khóa chính mình: tránh mất quyền quản trị và tự nâng quyền
+	value, _ := c.Get("identity")
+	if identity, ok := value.(*middleware.Identity); ok && identity.UserID == id && (request.Role != nil || request.Status != nil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot change your own role or status"})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	update := bson.M{
-		"$set": bson.M{
-			"email":    updatedUser.Email,
-			"username": updatedUser.Username,
-			"status":   updatedUser.Status,
-			"role":     updatedUser.Role,
-		},
+	fields := bson.M{"update_at": time.Now()}
+	if request.Username != nil {
+		if !validUsername(*request.Username) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "message": "Username must be between 3 and 50 characters"})
+			return
+		}
+		fields["username"] = *request.Username
 	}
+	if request.Role != nil {
+		allowed, err := roleAllowed(ctx, *request.Role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking role"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "message": "Role does not exist"})
+			return
+		}
 
-	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+		// Chỉ gán được vai trò có quyền nằm trong quyền của người gọi, nên user:manage không đủ để gán admin
+		permissions, err := middleware.RolePermissions(*request.Role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking role"})
+			return
+		}
+		if !checkGrantable(c, permissions) {
+			return
+		}
+		fields["role"] = *request.Role
+	}
+	if request.Status != nil {
+		switch *request.Status {
+		case models.UserStatusDisabled, models.UserStatusActive, models.UserStatusPending:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "message": "Status must be 0, 1 or 2"})
+			return
+		}
+		fields["status"] = *request.Status
+	}
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": fields})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
 		return
@@ -251,6 +471,14 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// Vai trò mới hoặc tài khoản bị khóa có hiệu lực ngay, không chờ token hết hạn
+	if request.Role != nil || request.Status != nil {
+		if err := middleware.RevokeUser(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking user tokens"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 }
 
@@ -273,9 +501,61 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	if err := middleware.RevokeUser(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking user tokens"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
+// Đăng xuất thiết bị hiện tại: xóa phiên cookie, thu hồi access token và refresh token gửi kèm
+func LogoutUser(c *gin.Context) {
+	identity, err := middleware.Authenticate(c.Request)
+	if err == nil && identity.Session != nil {
+		if err := middleware.DeleteSession(identity.Session.ID, identity.UserID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete session"})
+			return
+		}
+	}
+	if err == nil && identity.TokenID != "" {
+		if err := middleware.RevokeToken(identity.TokenID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+			return
+		}
+	}
+
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if c.ShouldBindJSON(&request) == nil {
+		if err := middleware.RevokeRefreshToken(request.RefreshToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+			return
+		}
+	}
+
+	middleware.ClearSessionCookie(c.Writer)
+	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
+}
+
+// Đăng xuất khỏi tất cả thiết bị của người dùng
+func LogoutAllDevices(c *gin.Context) {
+	identity, err := middleware.Authenticate(c.Request)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := middleware.RevokeUser(identity.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sessions"})
+		return
+	}
+
+	middleware.ClearSessionCookie(c.Writer)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices"})
+}
+
 // Kiểm tra mật khẩu
 func checkPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
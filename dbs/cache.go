@@ -0,0 +1,97 @@
+// dbs/cache.go
+package dbs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Tiền tố cho các Redis set lưu danh sách key theo tag
+const cacheTagPrefix = "cachetag:"
+
+// Thời gian sống của một tag set, luôn dài hơn TTL của mọi key được đăng ký vào nó
+const cacheTagTTL = 24 * time.Hour
+
+// TagCatalog gắn cho mọi cache phụ thuộc vào danh sách phim (trang chủ, danh sách admin, danh mục kèm phim)
+const TagCatalog = "catalog"
+
+// MovieTag trả về tag của một bộ phim, dùng cho chi tiết phim, episodes và qualities của phim đó
+func MovieTag(movieID string) string {
+	return "movie:" + movieID
+}
+
+// CategoryTag trả về tag của một danh mục
+func CategoryTag(categoryID string) string {
+	return "category:" + categoryID
+}
+
+// GenreTag trả về tag của một thể loại
+func GenreTag(genreID string) string {
+	return "genre:" + genreID
+}
+
+// ServerTag trả về tag của một server, gắn cho chi tiết phim có episode dùng server đó
+func ServerTag(serverID string) string {
+	return "server:" + serverID
+}
+
+func cacheTagKey(tag string) string {
+	return cacheTagPrefix + tag
+}
+
+// SetCache lưu value vào key với TTL và đăng ký key vào từng tag
+func SetCache(ctx context.Context, key string, value interface{}, ttl time.Duration, tags ...string) error {
+	_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, value, ttl)
+		for _, tag := range tags {
+			tagKey := cacheTagKey(tag)
+			pipe.SAdd(ctx, tagKey, key)
+			pipe.Expire(ctx, tagKey, cacheTagTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error caching key %s: %v", key, err)
+	}
+	return nil
+}
+
+// InvalidateTags xóa mọi key đã đăng ký dưới các tag, không dùng KEYS
+func InvalidateTags(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	tagKeys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tagKeys = append(tagKeys, cacheTagKey(tag))
+	}
+
+	// Đọc và xóa các tag set trong cùng một transaction để không mất key được đăng ký xen giữa
+	var members *redis.StringSliceCmd
+	_, err := RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members = pipe.SUnion(ctx, tagKeys...)
+		pipe.Unlink(ctx, tagKeys...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error reading cache tags: %v", err)
+	}
+
+	keys := members.Val()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// UNLINK giải phóng bộ nhớ ở background nên không chặn Redis như DEL
+	if err := RedisClient.Unlink(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("Error deleting cached keys: %v", err)
+	}
+
+	log.Printf("Invalidated %d cached keys for tags %v", len(keys), tags)
+	return nil
+}
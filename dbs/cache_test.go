@@ -0,0 +1,89 @@
+package dbs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupTestRedis trỏ RedisClient tới một Redis in-memory cho từng test
+func setupTestRedis(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	RedisClient = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { RedisClient.Close() })
+	return mr
+}
+
+func TestSetCacheRegistersKeyUnderTags(t *testing.T) {
+	mr := setupTestRedis(t)
+	ctx := context.Background()
+
+	err := SetCache(ctx, "movieshome_page_1", "[]", 30*time.Minute, TagCatalog, MovieTag("m1"))
+	assert.NoError(t, err)
+
+	value, err := mr.Get("movieshome_page_1")
+	assert.NoError(t, err)
+	assert.Equal(t, "[]", value)
+	assert.Equal(t, 30*time.Minute, mr.TTL("movieshome_page_1"))
+
+	members, err := mr.Members(cacheTagKey(TagCatalog))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"movieshome_page_1"}, members)
+
+	members, err = mr.Members(cacheTagKey(MovieTag("m1")))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"movieshome_page_1"}, members)
+	assert.Equal(t, cacheTagTTL, mr.TTL(cacheTagKey(MovieTag("m1"))))
+}
+
+func TestInvalidateTagsDeletesOnlyTaggedKeys(t *testing.T) {
+	mr := setupTestRedis(t)
+	ctx := context.Background()
+
+	assert.NoError(t, SetCache(ctx, "movieshome_page_1", "[]", time.Minute, TagCatalog, MovieTag("m1")))
+	assert.NoError(t, SetCache(ctx, "categorieswithmovie_1", "[]", time.Minute, TagCatalog, CategoryTag("c1")))
+	assert.NoError(t, SetCache(ctx, "movie_detail_m1", "{}", time.Minute, MovieTag("m1")))
+	assert.NoError(t, SetCache(ctx, "movie_detail_m2", "{}", time.Minute, MovieTag("m2")))
+	assert.NoError(t, SetCache(ctx, "qualities_m2_e1_s1", "[]", time.Minute, MovieTag("m2")))
+
+	assert.NoError(t, InvalidateTags(ctx, MovieTag("m1")))
+
+	assert.False(t, mr.Exists("movieshome_page_1"))
+	assert.False(t, mr.Exists("movie_detail_m1"))
+	assert.False(t, mr.Exists(cacheTagKey(MovieTag("m1"))))
+	assert.True(t, mr.Exists("categorieswithmovie_1"))
+	assert.True(t, mr.Exists("movie_detail_m2"))
+	assert.True(t, mr.Exists("qualities_m2_e1_s1"))
+
+	assert.NoError(t, InvalidateTags(ctx, TagCatalog, MovieTag("m2")))
+
+	assert.False(t, mr.Exists("categorieswithmovie_1"))
+	assert.False(t, mr.Exists("movie_detail_m2"))
+	assert.False(t, mr.Exists("qualities_m2_e1_s1"))
+	assert.False(t, mr.Exists(cacheTagKey(TagCatalog)))
+}
+
+func TestInvalidateTagsWithoutMembers(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+
+	assert.NoError(t, InvalidateTags(ctx))
+	assert.NoError(t, InvalidateTags(ctx, CategoryTag("missing")))
+}
+
+func TestInvalidateTagsKeepsUntaggedKeys(t *testing.T) {
+	mr := setupTestRedis(t)
+	ctx := context.Background()
+
+	assert.NoError(t, SetCache(ctx, "movies_1", "[]", time.Minute, TagCatalog))
+	assert.NoError(t, mr.Set("unrelated_movie_key", "keep"))
+
+	assert.NoError(t, InvalidateTags(ctx, TagCatalog))
+
+	assert.False(t, mr.Exists("movies_1"))
+	assert.True(t, mr.Exists("unrelated_movie_key"))
+}
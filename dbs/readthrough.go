@@ -0,0 +1,197 @@
+// dbs/readthrough.go
+package dbs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+// Thời gian giữ khóa rebuild giữa các instance, đủ cho một aggregation nặng
+const cacheLockTTL = 10 * time.Second
+
+// Thời gian tối đa chờ instance khác rebuild xong trước khi tự truy vấn
+const cacheLockWait = 2 * time.Second
+
+// Khoảng cách giữa các lần kiểm tra cache khi đang chờ
+const cacheLockPoll = 50 * time.Millisecond
+
+// Timeout cho việc làm mới cache ở background, không phụ thuộc vào request
+const cacheRefreshTimeout = 15 * time.Second
+
+// errCacheBusy được trả về khi instance khác đang rebuild key và caller không chờ
+var errCacheBusy = errors.New("cache rebuild in progress")
+
+// CacheOptions cấu hình một lần đọc qua cache
+type CacheOptions struct {
+	TTL      time.Duration // Thời gian dữ liệu được coi là mới
+	StaleTTL time.Duration // Thời gian được phép trả dữ liệu cũ trong khi một caller làm mới
+	Tags     []string      // Các tag cố định của key, cộng thêm với tag do loader trả về
+}
+
+// CacheLoader tải dữ liệu từ nguồn gốc, trả về JSON và các tag phụ thuộc vào dữ liệu
+type CacheLoader func(ctx context.Context) ([]byte, []string, error)
+
+// cacheEntry là dữ liệu lưu trong Redis, kèm thời điểm hết hạn mềm
+type cacheEntry struct {
+	Data       json.RawMessage `json:"data"`
+	FreshUntil time.Time       `json:"fresh_until"`
+}
+
+// Gom các lần rebuild cùng key trong một process
+var cacheGroup singleflight.Group
+
+// Chỉ xóa khóa nếu vẫn đang được giữ bởi đúng token
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func cacheLockKey(key string) string {
+	return "cachelock:" + key
+}
+
+// ReadThrough đọc key từ cache, nếu thiếu thì chỉ một caller tải lại từ loader.
+// Khi dữ liệu đã quá TTL nhưng còn trong StaleTTL, trả dữ liệu cũ và làm mới ở background.
+func ReadThrough(ctx context.Context, key string, opts CacheOptions, load CacheLoader) ([]byte, error) {
+	entry, err := readCacheEntry(ctx, key)
+	if err != nil && err != redis.Nil {
+		log.Printf("Error reading cache %s: %v", key, err)
+	}
+
+	if entry != nil {
+		if time.Now().Before(entry.FreshUntil) {
+			return entry.Data, nil
+		}
+
+		// Dữ liệu cũ: trả ngay và để một caller làm mới
+		go refreshCache(key, opts, load)
+		return entry.Data, nil
+	}
+
+	data, err := loadShared(ctx, key, opts, load)
+	if err == errCacheBusy {
+		// Đã nhập vào lần làm mới background không chờ khóa, tự rebuild và chờ instance kia
+		data, err = loadShared(ctx, key, opts, load)
+	}
+	return data, err
+}
+
+// loadShared rebuild key qua singleflight với context tách khỏi request: caller đầu tiên
+// hủy request thì các caller khác đang nhập vào vẫn nhận được kết quả
+func loadShared(ctx context.Context, key string, opts CacheOptions, load CacheLoader) ([]byte, error) {
+	results := cacheGroup.DoChan(key, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cacheRefreshTimeout)
+		defer cancel()
+		return rebuildCache(loadCtx, key, opts, load, true)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.([]byte), nil
+	}
+}
+
+func readCacheEntry(ctx context.Context, key string) (*cacheEntry, error) {
+	cached, err := RedisClient.Get(ctx, key).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(cached, &entry); err != nil {
+		return nil, fmt.Errorf("Error decoding cache entry: %v", err)
+	}
+	return &entry, nil
+}
+
+// refreshCache làm mới một key đã cũ, bỏ qua nếu instance khác đang làm việc này
+func refreshCache(key string, opts CacheOptions, load CacheLoader) {
+	ctx, cancel := context.WithTimeout(context.Background(), cacheRefreshTimeout)
+	defer cancel()
+
+	_, err, _ := cacheGroup.Do(key, func() (interface{}, error) {
+		return rebuildCache(ctx, key, opts, load, false)
+	})
+	if err != nil && err != errCacheBusy {
+		log.Printf("Error refreshing cache %s: %v", key, err)
+	}
+}
+
+// rebuildCache giữ khóa Redis trong lúc gọi loader để các instance khác không rebuild cùng lúc.
+// Nếu wait là true và khóa đang bị giữ, chờ instance kia ghi cache rồi dùng lại kết quả,
+// ngược lại trả errCacheBusy.
+func rebuildCache(ctx context.Context, key string, opts CacheOptions, load CacheLoader, wait bool) ([]byte, error) {
+	token, acquired := acquireCacheLock(ctx, key)
+	if acquired {
+		defer releaseLockScript.Run(context.Background(), RedisClient, []string{cacheLockKey(key)}, token)
+	} else if !wait {
+		return nil, errCacheBusy
+	} else if entry := waitForCache(ctx, key); entry != nil {
+		return entry.Data, nil
+	}
+
+	data, tags, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entryJSON, err := json.Marshal(cacheEntry{Data: data, FreshUntil: time.Now().Add(opts.TTL)})
+	if err != nil {
+		return nil, err
+	}
+
+	allTags := append(append([]string{}, opts.Tags...), tags...)
+	if err := SetCache(ctx, key, entryJSON, opts.TTL+opts.StaleTTL, allTags...); err != nil {
+		log.Println(err)
+	}
+
+	return data, nil
+}
+
+func acquireCacheLock(ctx context.Context, key string) (string, bool) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", false
+	}
+	token := hex.EncodeToString(buf)
+
+	ok, err := RedisClient.SetNX(ctx, cacheLockKey(key), token, cacheLockTTL).Result()
+	if err != nil {
+		// Redis lỗi thì vẫn cho phép tải trực tiếp từ database
+		log.Printf("Error acquiring cache lock %s: %v", key, err)
+		return "", true
+	}
+	return token, ok
+}
+
+func waitForCache(ctx context.Context, key string) *cacheEntry {
+	deadline := time.Now().Add(cacheLockWait)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(cacheLockPoll):
+		}
+
+		if entry, err := readCacheEntry(ctx, key); err == nil {
+			return entry
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package dbs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadThroughLoadsOnceForConcurrentMisses(t *testing.T) {
+	setupTestRedis(t)
+	ctx := context.Background()
+
+	var calls int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return []byte(`["m1"]`), []string{MovieTag("m1")}, nil
+	}
+
+	opts := CacheOptions{TTL: time.Minute, StaleTTL: time.Minute, Tags: []string{TagCatalog}}
+
+	var wg sync.WaitGroup
+	results := make([][]byte, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, err := ReadThrough(ctx, "movieshome_page_1", opts, load)
+			assert.NoError(t, err)
+			results[i] = data
+		}(i)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, data := range results {
+		assert.Equal(t, `["m1"]`, string(data))
+	}
+
+	// Key được đăng ký vào cả tag cố định và tag do loader trả về
+	assert.NoError(t, InvalidateTags(ctx, MovieTag("m1")))
+	exists, err := RedisClient.Exists(ctx, "movieshome_page_1").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+}
+
+func TestReadThroughServesStaleWhileRefreshing(t *testing.T) {
+	mr := setupTestRedis(t)
+	ctx := context.Background()
+
+	stale, _ := json.Marshal(cacheEntry{Data: []byte(`"old"`), FreshUntil: time.Now().Add(-time.Second)})
+	assert.NoError(t, mr.Set("movie_detail_m1", string(stale)))
+
+	refreshed := make(chan struct{})
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		defer close(refreshed)
+		return []byte(`"new"`), nil, nil
+	}
+
+	data, err := ReadThrough(ctx, "movie_detail_m1", CacheOptions{TTL: time.Minute}, load)
+	assert.NoError(t, err)
+	assert.Equal(t, `"old"`, string(data))
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("stale entry was not refreshed")
+	}
+
+	assert.Eventually(t, func() bool {
+		data, err := ReadThrough(ctx, "movie_detail_m1", CacheOptions{TTL: time.Minute}, load)
+		return err == nil && string(data) == `"new"`
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestReadThroughSkipsRefreshWhenLockHeld(t *testing.T) {
+	mr := setupTestRedis(t)
+	ctx := context.Background()
+
+	stale, _ := json.Marshal(cacheEntry{Data: []byte(`"old"`), FreshUntil: time.Now().Add(-time.Second)})
+	assert.NoError(t, mr.Set("movie_detail_m1", string(stale)))
+	assert.NoError(t, mr.Set(cacheLockKey("movie_detail_m1"), "other-instance"))
+
+	var calls int32
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		atomic.AddInt32(&calls, 1)
+		return []byte(`"new"`), nil, nil
+	}
+
+	data, err := ReadThrough(ctx, "movie_detail_m1", CacheOptions{TTL: time.Minute}, load)
+	assert.NoError(t, err)
+	assert.Equal(t, `"old"`, string(data))
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestReadThroughDoesNotCacheErrors(t *testing.T) {
+	mr := setupTestRedis(t)
+	ctx := context.Background()
+
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		return nil, nil, errors.New("Movie not found")
+	}
+
+	_, err := ReadThrough(ctx, "movie_detail_missing", CacheOptions{TTL: time.Minute}, load)
+	assert.EqualError(t, err, "Movie not found")
+	assert.False(t, mr.Exists("movie_detail_missing"))
+	assert.False(t, mr.Exists(cacheLockKey("movie_detail_missing")))
+}
+
+func TestReadThroughRetriesAfterJoiningBusyRefresh(t *testing.T) {
+	mr := setupTestRedis(t)
+	ctx := context.Background()
+	assert.NoError(t, mr.Set(cacheLockKey("movie_detail_m1"), "other-instance"))
+
+	// Giả lập một lần làm mới background đang chạy trong khi key đã bị xóa khỏi cache
+	refreshing := make(chan struct{})
+	release := make(chan struct{})
+	go cacheGroup.Do("movie_detail_m1", func() (interface{}, error) {
+		close(refreshing)
+		<-release
+		return nil, errCacheBusy
+	})
+	<-refreshing
+
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		return []byte(`"db"`), nil, nil
+	}
+	done := make(chan []byte)
+	go func() {
+		data, err := ReadThrough(ctx, "movie_detail_m1", CacheOptions{TTL: time.Minute}, load)
+		assert.NoError(t, err)
+		done <- data
+	}()
+
+	// Instance giữ khóa ghi cache xong, caller nhận dữ liệu đó thay vì nil
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	entry, _ := json.Marshal(cacheEntry{Data: []byte(`"other"`), FreshUntil: time.Now().Add(time.Minute)})
+	assert.NoError(t, mr.Set("movie_detail_m1", string(entry)))
+
+	select {
+	case data := <-done:
+		assert.Equal(t, `"other"`, string(data))
+	case <-time.After(time.Second):
+		t.Fatal("read through did not return")
+	}
+}
+
+func TestReadThroughLoadSurvivesFirstCallerCancel(t *testing.T) {
+	setupTestRedis(t)
+
+	release := make(chan struct{})
+	load := func(ctx context.Context) ([]byte, []string, error) {
+		<-release
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return []byte(`"new"`), nil, nil
+	}
+	opts := CacheOptions{TTL: time.Minute}
+
+	first, cancel := context.WithCancel(context.Background())
+	firstDone := make(chan error)
+	go func() {
+		_, err := ReadThrough(first, "movie_detail_m1", opts, load)
+		firstDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	second := make(chan []byte)
+	go func() {
+		data, err := ReadThrough(context.Background(), "movie_detail_m1", opts, load)
+		assert.NoError(t, err)
+		second <- data
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Caller đầu hủy request thì chỉ nó nhận lỗi, loader vẫn chạy cho caller còn lại
+	cancel()
+	assert.Equal(t, context.Canceled, <-firstDone)
+	close(release)
+	assert.Equal(t, `"new"`, string(<-second))
+}
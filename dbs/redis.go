@@ -3,7 +3,6 @@ package dbs
 
 import (
 	"context"
-	"fmt"
 	"log"
 
 	"github.com/go-redis/redis/v8"
@@ -28,26 +27,3 @@ func InitializeRedis() {
 
 	log.Println("Kết nối thành công tới Redis")
 }
-
-func DeleteCacheByKeyword(ctx context.Context, keyword string) error {
-	// Tìm tất cả các key phù hợp với từ khóa
-	pattern := fmt.Sprintf("*%s*", keyword) // Tìm các key chứa từ khóa
-	keys, err := RedisClient.Keys(ctx, pattern).Result()
-	if err != nil {
-		return fmt.Errorf("Error fetching keys: %v", err)
-	}
-
-	if len(keys) == 0 {
-		log.Printf("No keys found matching pattern: %s", pattern)
-		return nil
-	}
-
-	// Xóa tất cả các key phù hợp
-	_, err = RedisClient.Del(ctx, keys...).Result()
-	if err != nil {
-		return fmt.Errorf("Error deleting keys: %v", err)
-	}
-
-	log.Printf("Deleted %d keys matching pattern: %s", len(keys), pattern)
-	return nil
-}
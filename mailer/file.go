@@ -0,0 +1,34 @@
+// mailer/file.go
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileMailer dùng khi phát triển: ghi email thành file .eml trong Dir, hoặc ra log nếu Dir rỗng
+type FileMailer struct {
+	Dir string
+}
+
+// Send ghi email, không gửi đi đâu cả
+func (mailer *FileMailer) Send(ctx context.Context, message Message) error {
+	if mailer.Dir == "" {
+		log.Printf("Email to %s: %s\n%s", message.To, message.Subject, message.Text)
+		return nil
+	}
+
+	if err := os.MkdirAll(mailer.Dir, 0o755); err != nil {
+		return err
+	}
+
+	// Tên file theo thời gian gửi để dễ tìm email mới nhất
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(message.To)
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + recipient + ".eml"
+	return os.WriteFile(filepath.Join(mailer.Dir, name), buildMessage("no-reply@localhost", message), 0o644)
+}
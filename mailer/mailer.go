@@ -0,0 +1,74 @@
+// mailer/mailer.go
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+)
+
+// Message là một email gửi cho người dùng
+type Message struct {
+	To      string
+	Subject string
+	Text    string // Nội dung dạng văn bản thuần
+}
+
+// Mailer gửi email, có bản SMTP cho môi trường chạy thật và bản ghi file/log khi phát triển
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Mailer đang dùng, mặc định chỉ ghi email ra log
+var current Mailer = &FileMailer{}
+
+// Use đặt mailer dùng cho toàn ứng dụng, gọi khi khởi động
+func Use(mailer Mailer) {
+	current = mailer
+}
+
+// Send gửi email bằng mailer đang dùng
+func Send(ctx context.Context, message Message) error {
+	return current.Send(ctx, message)
+}
+
+// FromEnv tạo mailer theo biến môi trường MAILER:
+//   - smtp: gửi qua SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, người gửi MAIL_FROM
+//   - file: ghi từng email thành file .eml trong MAIL_DIR
+//   - log (mặc định): ghi email ra log
+func FromEnv() Mailer {
+	switch strings.ToLower(os.Getenv("MAILER")) {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return &FileMailer{Dir: dir}
+	case "", "log":
+		return &FileMailer{}
+	default:
+		log.Printf("Unknown MAILER %q, emails are written to the log", os.Getenv("MAILER"))
+		return &FileMailer{}
+	}
+}
+
+// BaseURL là địa chỉ gốc của ứng dụng dùng trong liên kết gửi qua email (APP_URL)
+func BaseURL() string {
+	if url := os.Getenv("APP_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:8080"
+}
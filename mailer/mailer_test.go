@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &FileMailer{Dir: dir}
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Xác minh email",
+		Text:    "Line one\nLine two",
+	})
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.True(t, strings.HasSuffix(entries[0].Name(), "user_at_example.com.eml"))
+
+	data, err := os.ReadFile(dir + "/" + entries[0].Name())
+	assert.NoError(t, err)
+	content := string(data)
+	assert.Contains(t, content, "To: user@example.com\r\n")
+	assert.Contains(t, content, "Subject: =?utf-8?q?")
+	assert.Contains(t, content, "\r\n\r\nLine one\r\nLine two")
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("MAILER", "smtp")
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("MAIL_FROM", "no-reply@example.com")
+	assert.Equal(t, &SMTPMailer{Host: "smtp.example.com", Port: "587", From: "no-reply@example.com"}, FromEnv())
+
+	t.Setenv("MAILER", "file")
+	t.Setenv("MAIL_DIR", "/tmp/mail")
+	assert.Equal(t, &FileMailer{Dir: "/tmp/mail"}, FromEnv())
+
+	t.Setenv("MAILER", "")
+	assert.Equal(t, &FileMailer{}, FromEnv())
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	mailer := &SMTPMailer{Host: "127.0.0.1", Port: "1"}
+	err := mailer.Send(context.Background(), Message{To: "user@example.com\r\nBcc: other@example.com"})
+	assert.Error(t, err)
+}
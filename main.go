@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
+	middleware "fire-watch/auth"
 	"fire-watch/controllers"
+	customer "fire-watch/controllers/customer"
 	"fire-watch/dbs"
+	"fire-watch/mailer"
 	"fire-watch/models"
 	"fire-watch/routes"
+	"fire-watch/search"
 	"fire-watch/websocket"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -23,6 +31,12 @@ func main() {
 	}
 
 	router.Use(gin.RecoveryWithWriter(log.Writer()))
+
+	// c.ClientIP() (giới hạn đăng nhập sai theo IP) chỉ đọc X-Forwarded-For từ các proxy trong
+	// TRUSTED_PROXIES="10.0.0.1,10.0.0.0/8", không cấu hình thì dùng địa chỉ kết nối trực tiếp
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("TRUSTED_PROXIES không hợp lệ: ", err)
+	}
 	// Khởi tạo WebSocket server
 	websocketServer := websocket.NewWebSocketServer()
 
@@ -46,6 +60,23 @@ func main() {
 	// Khởi tạo kết nối Redis
 	dbs.InitializeRedis()
 
+	// Dùng chung khóa ký JWT giữa các instance, cho phép thay khóa không cần khởi động lại
+	if err := middleware.EnableKeyRotation(dbs.RedisClient); err != nil {
+		log.Fatal("Không thể nạp khóa ký JWT từ Redis: ", err)
+	}
+
+	// Phiên đăng nhập, refresh token và token bị thu hồi lưu trong Redis, cookie chỉ chứa ID phiên
+	middleware.EnableRedisStore(dbs.RedisClient)
+
+	// Email xác minh và đặt lại mật khẩu: SMTP khi chạy thật, ghi file hoặc log khi phát triển (biến MAILER)
+	mailer.Use(mailer.FromEnv())
+
+	// Chuyển sự kiện WebSocket giữa các instance qua Redis
+	websocketServer.EnableRedisRelay(dbs.RedisClient)
+
+	// Chỉ mục gợi ý tìm kiếm (/search/suggest) lưu trong Redis
+	search.EnableSuggestions(dbs.RedisClient)
+
 	// Khởi tạo collections cho các bảng cần thiết
 	models.InitializeMovieCollection()
 	models.InitializeCategoryCollection()
@@ -58,9 +89,52 @@ func main() {
 	models.InitializeGenreCollection()     // Khởi tạo collection cho genres
 	controllers.InitializeroleCollection() // Khởi tạo collection cho roles
 
+	// Text index cho tìm kiếm phim, tính trường tìm kiếm cho các phim cũ chưa có
+	indexCtx, cancelIndex := context.WithTimeout(context.Background(), time.Minute)
+	if err := models.EnsureMovieIndexes(indexCtx); err != nil {
+		log.Fatal("Không thể tạo index cho movies: ", err)
+	}
+	if count, err := models.BackfillMovieSearch(indexCtx); err != nil {
+		log.Println("Error backfilling movie search fields:", err)
+	} else if count > 0 {
+		log.Printf("Backfilled search fields for %d movies", count)
+	}
+
+	// Dựng chỉ mục gợi ý lần đầu khi Redis chưa có
+	if built, err := search.SuggestionsBuilt(indexCtx); err == nil && !built {
+		if count, err := models.RebuildMovieSuggestions(indexCtx); err != nil {
+			log.Println("Error building search suggestions:", err)
+		} else {
+			log.Printf("Built search suggestions for %d movies", count)
+		}
+	}
+	cancelIndex()
+
+	// Chỉ mục gợi ý "có phải bạn muốn tìm" khi tìm kiếm không có kết quả, làm mới theo sự kiện phim trên hub
+	go customer.WatchTitleIndex(websocketServer)
+
+	// Quyền của từng vai trò đọc từ collection roles, cache trong Redis
+	middleware.SetPermissionLoader(controllers.LoadRolePermissions)
+
 	// Đăng ký WebSocket route
 	router.GET("/ws", func(c *gin.Context) {
-		websocketServer.HandleConnections(c.Writer, c.Request)
+		// Dùng chung cách xác thực với AuthMiddleware (cookie phiên hoặc Bearer token)
+		identity, err := middleware.Authenticate(c.Request)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		websocketServer.HandleConnections(c.Writer, c.Request, identity.UserID, identity.Role)
+	})
+
+	// Luồng sự kiện SSE cho client không giữ được WebSocket, dùng chung hub và cách xác thực
+	router.GET("/events", func(c *gin.Context) {
+		identity, err := middleware.Authenticate(c.Request)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		websocketServer.HandleSSE(c, identity.UserID, identity.Role)
 	})
 
 	// Đăng ký các routes
@@ -69,7 +143,7 @@ func main() {
 	routes.RegisterCountryRoutes(router)
 	routes.RegisterGenreRoutes(router)
 	routes.RegisterRoleRoutes(router)
-	routes.RegisterAuthRoutes(router)
+	routes.RegisterAuthRoutes(router, websocketServer)
 	routes.RegisterEpisodeRoutes(router)
 
 	// Đăng ký các route và truyền websocketServer vào
@@ -86,3 +160,14 @@ func main() {
 	fmt.Printf("Server is running on port %s\n", port)
 	router.Run(":" + port) // Khởi động Gin server
 }
+
+// trustedProxies đọc danh sách IP hoặc CIDR của reverse proxy, nil khi không tin proxy nào
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	middleware "fire-watch/auth"
 	"fire-watch/dbs"
 	"fire-watch/models"
 	"fire-watch/routes"
@@ -24,6 +25,15 @@ import (
 
 // Khởi tạo movieCollection
 
+// adminToken tạo access token admin cho các route ghi, vốn yêu cầu đăng nhập
+func adminToken(t *testing.T) string {
+	token, err := middleware.CreateToken("test-admin", "admin@example.com", "admin", "admin", 1)
+	if err != nil {
+		t.Fatalf("Error creating admin token: %v", err)
+	}
+	return "Bearer " + token
+}
+
 // Mock Redis client
 // setupMockRedis khởi tạo Redis client cho mục đích test
 func TestCreateMovie(t *testing.T) {
@@ -79,6 +89,7 @@ func TestCreateMovie(t *testing.T) {
 
 	// Create request
 	req, _ := http.NewRequest("POST", "/movies/addmovie", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", adminToken(t))
 	req.Header.Set("Content-Type", "application/json")
 
 	// Record response
@@ -235,6 +246,7 @@ func TestUpdateMovie(t *testing.T) {
 
 	// Create PUT request với đúng ID trong URL
 	req, _ := http.NewRequest("PUT", "/movies/updatemovie/"+mockMovie.ID.Hex(), bytes.NewBuffer(body))
+	req.Header.Set("Authorization", adminToken(t))
 	req.Header.Set("Content-Type", "application/json")
 
 	// Record response
@@ -290,6 +302,7 @@ func TestDeleteMovie(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create DELETE request: %v", err)
 	}
+	req.Header.Set("Authorization", adminToken(t))
 
 	// Record response
 	rr := httptest.NewRecorder()
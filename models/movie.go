@@ -2,15 +2,19 @@
 package models
 
 import (
+	"context"
 	"errors"
 	"fire-watch/dbs" // Điều chỉnh đường dẫn tùy thuộc vào cấu trúc dự án của bạn
+	"fire-watch/search"
 	"log"
 	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10" // Thêm validator
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Movie struct mô phỏng bảng movies
@@ -47,8 +51,30 @@ type Movie struct {
 	GenreDetails    []Genre              `bson:"genreDetails,omitempty"`
 	CountryDetails  []Country            `bson:"countryDetails,omitempty"`
 	EpisodeDetails  []Episode            `bson:"episodeDetails,omitempty"`
+	Search          *MovieSearch         `bson:"search,omitempty" json:"-"` // Bản không dấu của các trường tìm kiếm
 }
 
+// MovieSearch chứa các trường tìm kiếm đã bỏ dấu, chữ thường, được đánh text index
+type MovieSearch struct {
+	Title       string `bson:"title"`
+	NameEng     string `bson:"name_eng"`
+	Tags        string `bson:"tags"`
+	Description string `bson:"description"`
+}
+
+// Tên text index trên các trường tìm kiếm và trọng số của từng trường
+const movieSearchIndex = "movie_search"
+
+var movieSearchWeights = bson.D{
+	{Key: "search.title", Value: 10},
+	{Key: "search.name_eng", Value: 8},
+	{Key: "search.tags", Value: 5},
+	{Key: "search.description", Value: 1},
+}
+
+// Các trường của Movie được đưa vào tìm kiếm, theo tên trường trong MongoDB
+var movieSearchFields = map[string]bool{"title": true, "name_eng": true, "tags": true, "description": true}
+
 // Khai báo biến collection cho movie
 var movieCollection *mongo.Collection
 
@@ -65,6 +91,160 @@ func GetMovieCollection() *mongo.Collection {
 	return movieCollection
 }
 
+// RefreshSearch tính lại các trường tìm kiếm, gọi trước mỗi lần ghi phim vào MongoDB
+func (movie *Movie) RefreshSearch() {
+	movie.Search = &MovieSearch{
+		Title:       search.Fold(movie.Title),
+		NameEng:     search.Fold(movie.NameEng),
+		Tags:        search.Fold(movie.Tags),
+		Description: search.Fold(movie.Description),
+	}
+}
+
+// MovieSearchFieldUpdate trả về cặp trường tìm kiếm cần $set cùng khi cập nhật riêng một trường của phim,
+// ok = false nếu trường đó không nằm trong tìm kiếm
+func MovieSearchFieldUpdate(field string, value interface{}) (string, string, bool) {
+	text, isString := value.(string)
+	if !movieSearchFields[field] || !isString {
+		return "", "", false
+	}
+	return "search." + field, search.Fold(text), true
+}
+
+// EnsureMovieIndexes tạo text index cho tìm kiếm và index theo position, gọi khi khởi động
+func EnsureMovieIndexes(ctx context.Context) error {
+	_, err := movieCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "search.title", Value: "text"},
+				{Key: "search.name_eng", Value: "text"},
+				{Key: "search.tags", Value: "text"},
+				{Key: "search.description", Value: "text"},
+			},
+			// Dữ liệu đã bỏ dấu nên không dùng stemming/stop word của ngôn ngữ nào
+			Options: options.Index().
+				SetName(movieSearchIndex).
+				SetWeights(movieSearchWeights).
+				SetDefaultLanguage("none"),
+		},
+		{Keys: bson.D{{Key: "position", Value: 1}}},
+	})
+	return err
+}
+
+// BackfillMovieSearch tính trường tìm kiếm cho các phim tạo trước khi có tìm kiếm toàn văn
+func BackfillMovieSearch(ctx context.Context) (int, error) {
+	cursor, err := movieCollection.Find(ctx, bson.M{"search": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"title": 1, "name_eng": 1, "tags": 1, "description": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	updated := 0
+	for cursor.Next(ctx) {
+		var movie Movie
+		if err := cursor.Decode(&movie); err != nil {
+			return updated, err
+		}
+		movie.RefreshSearch()
+		if _, err := movieCollection.UpdateByID(ctx, movie.ID, bson.M{"$set": bson.M{"search": movie.Search}}); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, cursor.Err()
+}
+
+// Visible cho biết phim hiển thị với khách hàng (chưa bị xóa và đang hoạt động)
+func (movie *Movie) Visible() bool {
+	return movie.Deleted != "deleted" && movie.Status != 2
+}
+
+// Suggestion trả về thông tin phim cho chỉ mục gợi ý tìm kiếm
+func (movie *Movie) Suggestion() *search.Suggestion {
+	suggestion := &search.Suggestion{
+		ID:       movie.ID.Hex(),
+		Title:    movie.Title,
+		NameEng:  movie.NameEng,
+		Slug:     movie.Slug,
+		Year:     movie.Year,
+		Views:    movie.Views,
+		Position: movie.Position,
+	}
+	if movie.Image != "" {
+		suggestion.Thumbnail = "/uploads/images/" + movie.Image
+	}
+	return suggestion
+}
+
+// Các trường cần cho chỉ mục gợi ý
+var movieSuggestionProjection = bson.M{
+	"title": 1, "name_eng": 1, "slug": 1, "year": 1, "image": 1,
+	"views": 1, "position": 1, "status": 1, "deleted": 1,
+}
+
+// SyncMovieSuggestion đọc lại phim và cập nhật chỉ mục gợi ý, phim không còn hiển thị thì bị xóa khỏi chỉ mục
+func SyncMovieSuggestion(ctx context.Context, movieID primitive.ObjectID) error {
+	var movie Movie
+	err := movieCollection.FindOne(ctx, bson.M{"_id": movieID}, options.FindOne().SetProjection(movieSuggestionProjection)).Decode(&movie)
+	if err == mongo.ErrNoDocuments || (err == nil && !movie.Visible()) {
+		return search.RemoveSuggestion(ctx, movieID.Hex())
+	}
+	if err != nil {
+		return err
+	}
+	return search.IndexSuggestion(ctx, movie.Suggestion())
+}
+
+// RebuildMovieSuggestions dựng lại chỉ mục gợi ý từ toàn bộ phim đang hiển thị, trả về số phim đã đưa vào
+func RebuildMovieSuggestions(ctx context.Context) (int, error) {
+	cursor, err := movieCollection.Find(ctx, bson.M{
+		"deleted": bson.M{"$ne": "deleted"},
+		"status":  bson.M{"$ne": 2},
+	}, options.Find().SetProjection(movieSuggestionProjection))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var suggestions []*search.Suggestion
+	for cursor.Next(ctx) {
+		var movie Movie
+		if err := cursor.Decode(&movie); err != nil {
+			return 0, err
+		}
+		suggestions = append(suggestions, movie.Suggestion())
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+
+	return len(suggestions), search.RebuildSuggestions(ctx, suggestions)
+}
+
+// ActiveMovieTitles trả về tên của các phim đang hiển thị, dùng cho chỉ mục gợi ý khi gõ sai
+func ActiveMovieTitles(ctx context.Context) ([]search.Title, error) {
+	cursor, err := movieCollection.Find(ctx, bson.M{
+		"deleted": bson.M{"$ne": "deleted"},
+		"status":  bson.M{"$ne": 2},
+	}, options.Find().SetProjection(bson.M{"title": 1, "name_eng": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var titles []search.Title
+	for cursor.Next(ctx) {
+		var movie Movie
+		if err := cursor.Decode(&movie); err != nil {
+			return nil, err
+		}
+		titles = append(titles, search.Title{ID: movie.ID.Hex(), Title: movie.Title, NameEng: movie.NameEng})
+	}
+	return titles, cursor.Err()
+}
+
 // Khởi tạo validator
 var validatemovie = validator.New()
 
@@ -7,7 +7,8 @@ import (
 
 // Định nghĩa struct Role
 type Role struct {
-	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"` // ID của role
-	Name   string             `bson:"name" json:"name"`        // Tên của vai trò (admin, customer, v.v.)
-	Status int                `bson:"status"`
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`        // ID của role
+	Name        string             `bson:"name" json:"name"`               // Tên của vai trò (admin, customer, v.v.)
+	Permissions []string           `bson:"permissions" json:"permissions"` // Quyền của vai trò, ví dụ "movie:write"
+	Status      int                `bson:"status"`
 }
@@ -19,12 +19,28 @@ import (
 		Email     string             `bson:"email" form:"email" json:"email" validate:"required,email"`                   // Địa chỉ email, yêu cầu định dạng email hợp lệ
 		Password  string             `bson:"password" form:"password" json:"password" validate:"required,min=6"`          // Mật khẩu, yêu cầu tối thiểu 6 ký tự
 		Role      string             `bson:"role" form:"role" json:"role"`                                                // Role phải là 'admin' hoặc 'user'
-		Status    int                `bson:"status" form:"status" json:"status"`                                          // Trạng thái (1: hoạt động, 0: không hoạt động)
+		Status    int                `bson:"status" form:"status" json:"status"`                                          // Trạng thái (1: hoạt động, 0: không hoạt động, 2: chưa xác minh email)
+		Avatar    string             `bson:"avatar,omitempty" json:"-"`                                                  // Đường dẫn ảnh đại diện trong /uploads/avatars
 		Deleted   string             `bson:"deleted, omitempty" form:"deleted"`
 		CreatedAt time.Time          `bson:"create_at"` // Thời gian tạo
 		UpdatedAt time.Time          `bson:"update_at"` // Thời gian cập nhật
+
+		// Xác thực hai bước (TOTP), secret và recovery code không bao giờ trả về client
+		TwoFactorEnabled bool     `bson:"two_factor_enabled" json:"-"`
+		TwoFactorSecret  string   `bson:"two_factor_secret,omitempty" json:"-"`
+		RecoveryCodes    []string `bson:"recovery_codes,omitempty" json:"-"` // Mã băm SHA-256 của các recovery code chưa dùng
+
+		// Email mới đang chờ xác minh, chỉ thay email khi người dùng mở liên kết gửi tới địa chỉ mới
+		PendingEmail string `bson:"pending_email,omitempty" json:"-"`
 	}
 
+// Trạng thái tài khoản (trường Status)
+const (
+	UserStatusDisabled = 0 // Bị khóa
+	UserStatusActive   = 1 // Hoạt động
+	UserStatusPending  = 2 // Đã đăng ký, chưa xác minh email
+)
+
 // Khai báo biến collection cho user
 var userCollection *mongo.Collection
 
@@ -82,3 +98,31 @@ func (user *User) Validate() error {
 func joinErrorsUser(errors []string) string {
 	return strings.Join(errors, ", ")
 }
+
+// UserResponse là thông tin người dùng trả về qua API, không bao giờ kèm mật khẩu
+type UserResponse struct {
+	ID        primitive.ObjectID `json:"id"`
+	Username  string             `json:"username"`
+	Email     string             `json:"email"`
+	Role      string             `json:"role"`
+	Status    int                `json:"status"`
+	Avatar    string             `json:"avatar,omitempty"`
+	TwoFactor bool               `json:"two_factor_enabled"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// Redacted bỏ các trường nhạy cảm (mật khẩu đã mã hóa) trước khi trả về client
+func (user *User) Redacted() UserResponse {
+	return UserResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role,
+		Status:    user.Status,
+		Avatar:    user.Avatar,
+		TwoFactor: user.TwoFactorEnabled,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
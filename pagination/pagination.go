@@ -0,0 +1,387 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Phân trang dùng chung cho các API danh sách. Hỗ trợ hai cách:
+//   - theo số trang (?page=2&limit=20), dùng cho pager trên trang HTML
+//   - theo cursor (?cursor=...&limit=20), cursor lấy từ next_cursor của trang trước.
+//     Cursor chứa giá trị sắp xếp của phần tử cuối nên trang sau không bị lệch khi dữ liệu thay đổi
+//     và không phải $skip qua các trang trước
+
+// Số phần tử mặc định và tối đa trên một trang, số trang lớn nhất đọc theo số trang
+// (trang xa hơn phải $skip quá nhiều phần tử, dùng cursor thay thế)
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+	MaxPage      = 1000
+)
+
+// Các lỗi tham số phân trang, đều bọc ErrInvalid để route trả 400 bằng một lần kiểm tra errors.Is
+var (
+	ErrInvalid = errors.New("invalid pagination parameters")
+	// ErrInvalidCursor được trả về khi cursor trên URL không đọc được hoặc không dùng được cho danh sách này
+	ErrInvalidCursor = fmt.Errorf("%w: cursor", ErrInvalid)
+	// ErrInvalidPage được trả về khi số trang lớn hơn MaxPage
+	ErrInvalidPage = fmt.Errorf("%w: page", ErrInvalid)
+)
+
+// Order là thứ tự của danh sách. Cursor được tạo theo một thứ tự chỉ dùng được với đúng thứ tự đó.
+// _id luôn được dùng để phân biệt các phần tử cùng giá trị Field
+type Order struct {
+	Field      string // "position" hoặc "_id", rỗng nếu danh sách không hỗ trợ cursor
+	Descending bool
+}
+
+var (
+	// ByPosition sắp xếp theo position tăng dần, phần tử chưa có position đứng đầu như cách MongoDB sắp xếp null
+	ByPosition = Order{Field: "position"}
+	// NewestFirst sắp xếp theo _id giảm dần, tức phần tử tạo sau đứng trước
+	NewestFirst = Order{Field: "_id", Descending: true}
+)
+
+func (order Order) direction() int {
+	if order.Descending {
+		return -1
+	}
+	return 1
+}
+
+// Sort trả về điều kiện $sort của thứ tự
+func (order Order) Sort() bson.D {
+	if order.Field == "_id" {
+		return bson.D{{Key: "_id", Value: order.direction()}}
+	}
+	return bson.D{{Key: order.Field, Value: order.direction()}, {Key: "_id", Value: order.direction()}}
+}
+
+// Cursor là vị trí của phần tử cuối trang trước
+type Cursor struct {
+	Field string             `json:"f"`
+	Value *int64             `json:"v,omitempty"` // nil nếu phần tử không có giá trị Field
+	ID    primitive.ObjectID `json:"id"`
+}
+
+// Encode trả về cursor dưới dạng chuỗi dùng trên URL
+func (cursor *Cursor) Encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor đọc cursor từ URL, cursor phải được tạo theo thứ tự order
+func DecodeCursor(value string, order Order) (*Cursor, error) {
+	if order.Field == "" {
+		return nil, ErrInvalidCursor
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Field != order.Field || cursor.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// Options là cấu hình phân trang của một danh sách
+type Options struct {
+	Order        Order
+	DefaultLimit int    // 0 thì dùng DefaultLimit
+	Prefix       string // Tiền tố tên tham số khi một trang có nhiều danh sách, ví dụ "category_" -> category_page
+}
+
+// Params là tham số phân trang của một request
+type Params struct {
+	Limit  int
+	Page   int     // Luôn là 1 khi dùng cursor
+	Cursor *Cursor // nil nếu phân trang theo số trang
+	Order  Order
+	Prefix string
+	Query  url.Values // Tham số URL của request, dùng để tạo link của pager
+}
+
+// Parse đọc tham số phân trang từ URL. limit và page sai được thay bằng giá trị mặc định,
+// limit lớn hơn MaxLimit bị giới hạn lại. Cursor sai trả về ErrInvalidCursor, page lớn hơn MaxPage
+// trả về ErrInvalidPage
+func Parse(c *gin.Context, options Options) (Params, error) {
+	params := Params{Order: options.Order, Prefix: options.Prefix, Query: c.Request.URL.Query()}
+
+	params.Limit = options.DefaultLimit
+	if params.Limit <= 0 {
+		params.Limit = DefaultLimit
+	}
+	if limit, err := strconv.Atoi(c.Query(options.Prefix + "limit")); err == nil && limit > 0 {
+		params.Limit = limit
+	}
+	if params.Limit > MaxLimit {
+		params.Limit = MaxLimit
+	}
+
+	if value := c.Query(options.Prefix + "cursor"); value != "" {
+		cursor, err := DecodeCursor(value, options.Order)
+		if err != nil {
+			return params, err
+		}
+		params.Cursor = cursor
+		params.Page = 1
+		return params, nil
+	}
+
+	page, err := strconv.Atoi(c.Query(options.Prefix + "page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	params.Page = page
+	if page > MaxPage {
+		return params, ErrInvalidPage
+	}
+	return params, nil
+}
+
+// CacheKey phân biệt các trang của cùng một danh sách trong cache
+func (params Params) CacheKey() string {
+	key := "l" + strconv.Itoa(params.Limit)
+	if params.Cursor != nil {
+		return key + "_c" + params.Cursor.Encode()
+	}
+	return key + "_p" + strconv.Itoa(params.Page)
+}
+
+// Seek trả về điều kiện $match bỏ qua các phần tử đến hết cursor, nil khi không dùng cursor
+func (params Params) Seek() bson.M {
+	cursor := params.Cursor
+	if cursor == nil {
+		return nil
+	}
+
+	after := "$gt"
+	if params.Order.Descending {
+		after = "$lt"
+	}
+	if cursor.Field == "_id" {
+		return bson.M{"_id": bson.M{after: cursor.ID}}
+	}
+
+	field := cursor.Field
+	if cursor.Value == nil {
+		// MongoDB xếp null trước mọi số khi tăng dần và sau mọi số khi giảm dần
+		conditions := bson.A{bson.M{field: nil, "_id": bson.M{after: cursor.ID}}}
+		if !params.Order.Descending {
+			conditions = append(conditions, bson.M{field: bson.M{"$ne": nil}})
+		}
+		return bson.M{"$or": conditions}
+	}
+
+	conditions := bson.A{
+		bson.M{field: bson.M{after: *cursor.Value}},
+		bson.M{field: *cursor.Value, "_id": bson.M{after: cursor.ID}},
+	}
+	if params.Order.Descending {
+		conditions = append(conditions, bson.M{field: nil})
+	}
+	return bson.M{"$or": conditions}
+}
+
+// Window trả về các stage lấy một trang đã sắp xếp, lấy thừa một phần tử để biết còn trang sau
+func (params Params) Window() []bson.M {
+	if params.Cursor != nil {
+		return []bson.M{{"$limit": params.Limit + 1}}
+	}
+	return []bson.M{
+		{"$skip": (params.Page - 1) * params.Limit},
+		{"$limit": params.Limit + 1},
+	}
+}
+
+// Stages trả về các stage lấy một trang theo Order, after chạy trên các phần tử của trang (ví dụ $lookup)
+func (params Params) Stages(after ...bson.D) bson.A {
+	stages := bson.A{}
+	if seek := params.Seek(); seek != nil {
+		stages = append(stages, bson.M{"$match": seek})
+	}
+	stages = append(stages, bson.M{"$sort": params.Order.Sort()})
+	for _, stage := range params.Window() {
+		stages = append(stages, stage)
+	}
+	for _, stage := range after {
+		stages = append(stages, stage)
+	}
+	return stages
+}
+
+// Facet trả về stage $facet gồm một trang phần tử (items) và tổng số phần tử (total), đọc bằng Result
+func (params Params) Facet(after ...bson.D) bson.D {
+	return bson.D{{Key: "$facet", Value: bson.M{
+		"items": params.Stages(after...),
+		"total": bson.A{bson.M{"$count": "count"}},
+	}}}
+}
+
+// Result là kết quả của stage Facet
+type Result struct {
+	Items []bson.Raw `bson:"items"`
+	Total []struct {
+		Count int `bson:"count"`
+	} `bson:"total"`
+}
+
+// Count trả về tổng số phần tử
+func (result *Result) Count() int {
+	if len(result.Total) == 0 {
+		return 0
+	}
+	return result.Total[0].Count
+}
+
+// cursorAt tạo cursor trỏ tới phần tử item
+func (params Params) cursorAt(item bson.Raw) *Cursor {
+	id, ok := item.Lookup("_id").ObjectIDOK()
+	if !ok || params.Order.Field == "" {
+		return nil
+	}
+	cursor := &Cursor{Field: params.Order.Field, ID: id}
+	if cursor.Field != "_id" {
+		value, err := item.LookupErr(cursor.Field)
+		if err == nil && value.Type != bsontype.Null {
+			number, ok := value.AsInt64OK()
+			if !ok {
+				return nil
+			}
+			cursor.Value = &number
+		}
+	}
+	return cursor
+}
+
+// Finish cắt phần tử lấy thừa, giải mã items vào results (con trỏ tới slice, như mongo.Cursor.All)
+// và trả về thông tin trang. items là kết quả của các stage Window
+func (params Params) Finish(total int, items []bson.Raw, results interface{}) (*Page, error) {
+	page := &Page{Total: total, Limit: params.Limit, Page: params.Page, prefix: params.Prefix, query: params.Query}
+	if params.Cursor != nil {
+		page.Page = 0
+	}
+	page.TotalPages = (total + params.Limit - 1) / params.Limit
+
+	if len(items) > params.Limit {
+		items = items[:params.Limit]
+		page.HasNext = true
+		if cursor := params.cursorAt(items[len(items)-1]); cursor != nil {
+			page.NextCursor = cursor.Encode()
+		}
+	}
+
+	slice := reflect.ValueOf(results).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, len(items)))
+	for _, item := range items {
+		element := reflect.New(slice.Type().Elem())
+		if err := bson.Unmarshal(item, element.Interface()); err != nil {
+			return nil, err
+		}
+		slice.Set(reflect.Append(slice, element.Elem()))
+	}
+	return page, nil
+}
+
+// Page là thông tin phân trang trả về cùng danh sách
+type Page struct {
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Page       int    `json:"page,omitempty"` // 0 khi phân trang theo cursor
+	TotalPages int    `json:"total_pages"`
+	HasNext    bool   `json:"has_next"`
+	NextCursor string `json:"next_cursor,omitempty"`
+
+	prefix string
+	query  url.Values
+}
+
+// WithParams gắn tham số URL của request để tạo link của pager, dùng khi Page được đọc lại từ cache
+func (page *Page) WithParams(params Params) *Page {
+	page.prefix, page.query = params.Prefix, params.Query
+	return page
+}
+
+// Merge thêm thông tin phân trang vào response JSON
+func (page *Page) Merge(response gin.H) gin.H {
+	response["total"] = page.Total
+	response["limit"] = page.Limit
+	response["total_pages"] = page.TotalPages
+	response["has_next"] = page.HasNext
+	if page.Page > 0 {
+		response["page"] = page.Page
+	}
+	if page.NextCursor != "" {
+		response["next_cursor"] = page.NextCursor
+	}
+	return response
+}
+
+// HasPrev cho biết có trang trước, chỉ khi phân trang theo số trang
+func (page *Page) HasPrev() bool {
+	return page.Page > 1
+}
+
+// PrevPage trả về số trang trước
+func (page *Page) PrevPage() int {
+	return page.Page - 1
+}
+
+// pagerWindow là số trang hiển thị ở mỗi bên trang hiện tại
+const pagerWindow = 2
+
+// Pages trả về các số trang hiển thị trên pager: trang đầu, trang cuối và các trang quanh trang hiện tại.
+// 0 đánh dấu chỗ bị lược bớt ("...")
+func (page *Page) Pages() []int {
+	if page.Page == 0 || page.TotalPages <= 1 {
+		return nil
+	}
+
+	var pages []int
+	for number := 1; number <= page.TotalPages; number++ {
+		if number == 1 || number == page.TotalPages || (number >= page.Page-pagerWindow && number <= page.Page+pagerWindow) {
+			pages = append(pages, number)
+		} else if pages[len(pages)-1] != 0 {
+			pages = append(pages, 0)
+		}
+	}
+	return pages
+}
+
+// URL trả về link tới trang number, giữ nguyên các tham số khác của request (bộ lọc, limit...)
+func (page *Page) URL(number int) string {
+	values := url.Values{}
+	for key, value := range page.query {
+		values[key] = value
+	}
+	values.Del(page.prefix + "cursor")
+	values.Set(page.prefix+"page", strconv.Itoa(number))
+	return "?" + values.Encode()
+}
+
+// NextURL trả về link tới trang sau, theo cursor khi thứ tự của danh sách hỗ trợ cursor
+// (không phải $skip qua các trang trước), theo số trang nếu không
+func (page *Page) NextURL() string {
+	if page.NextCursor == "" {
+		return page.URL(page.Page + 1)
+	}
+	values := url.Values{}
+	for key, value := range page.query {
+		values[key] = value
+	}
+	values.Del(page.prefix + "page")
+	values.Set(page.prefix+"cursor", page.NextCursor)
+	return "?" + values.Encode()
+}
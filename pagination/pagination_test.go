@@ -0,0 +1,151 @@
+package pagination
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func parseURL(t *testing.T, query string, options Options) (Params, error) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/list?"+query, nil)
+	return Parse(c, options)
+}
+
+func TestParseClampsLimitAndPage(t *testing.T) {
+	params, err := parseURL(t, "", Options{Order: ByPosition, DefaultLimit: 6})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, params.Limit)
+	assert.Equal(t, 1, params.Page)
+
+	params, err = parseURL(t, "limit=1000&page=3", Options{Order: ByPosition})
+	assert.NoError(t, err)
+	assert.Equal(t, MaxLimit, params.Limit)
+	assert.Equal(t, 3, params.Page)
+
+	// Giá trị sai dùng mặc định thay vì báo lỗi, giống cách đọc page trước đây
+	params, err = parseURL(t, "limit=-5&page=abc", Options{Order: ByPosition})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultLimit, params.Limit)
+	assert.Equal(t, 1, params.Page)
+
+	// Tham số có tiền tố không ảnh hưởng danh sách khác trên cùng trang
+	params, err = parseURL(t, "page=4&category_page=2", Options{Order: NewestFirst, Prefix: "category_"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, params.Page)
+
+	// Số trang quá lớn bị từ chối thay vì $skip tràn số
+	for _, page := range []string{"1001", "9223372036854775807"} {
+		_, err = parseURL(t, "page="+page, Options{Order: ByPosition})
+		assert.ErrorIs(t, err, ErrInvalid, page)
+	}
+	params, err = parseURL(t, "page=1000&limit=100", Options{Order: ByPosition})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.M{"$skip": 99900}, params.Window()[0])
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	position := int64(42)
+	cursor := &Cursor{Field: "position", Value: &position, ID: primitive.NewObjectID()}
+
+	params, err := parseURL(t, "cursor="+cursor.Encode()+"&page=9", Options{Order: ByPosition})
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, params.Cursor)
+	assert.Equal(t, 1, params.Page)
+}
+
+func TestParseRejectsInvalidCursor(t *testing.T) {
+	for _, value := range []string{"not-base64!", "bm90LWpzb24", (&Cursor{Field: "position"}).Encode()} {
+		_, err := parseURL(t, "cursor="+url.QueryEscape(value), Options{Order: ByPosition})
+		assert.Equal(t, ErrInvalidCursor, err, value)
+	}
+
+	// Cursor của thứ tự khác, hoặc danh sách không hỗ trợ cursor
+	cursor := (&Cursor{Field: "_id", ID: primitive.NewObjectID()}).Encode()
+	_, err := parseURL(t, "cursor="+cursor, Options{Order: ByPosition})
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, err = parseURL(t, "cursor="+cursor, Options{})
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+type item struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Position *int               `bson:"position,omitempty"`
+}
+
+func raws(t *testing.T, items ...item) []bson.Raw {
+	var result []bson.Raw
+	for _, item := range items {
+		data, err := bson.Marshal(item)
+		assert.NoError(t, err)
+		result = append(result, data)
+	}
+	return result
+}
+
+func TestFinishTrimsExtraItemAndBuildsNextCursor(t *testing.T) {
+	one, two := 1, 2
+	items := []item{
+		{ID: primitive.NewObjectID(), Position: &one},
+		{ID: primitive.NewObjectID(), Position: &two},
+		{ID: primitive.NewObjectID()},
+	}
+	params := Params{Limit: 2, Page: 1, Order: ByPosition}
+
+	var results []item
+	page, err := params.Finish(5, raws(t, items...), &results)
+	assert.NoError(t, err)
+	assert.Equal(t, items[:2], results)
+	assert.Equal(t, 3, page.TotalPages)
+	assert.True(t, page.HasNext)
+
+	cursor, err := DecodeCursor(page.NextCursor, ByPosition)
+	assert.NoError(t, err)
+	assert.Equal(t, items[1].ID, cursor.ID)
+	assert.Equal(t, int64(2), *cursor.Value)
+
+	// Trang cuối không có cursor tiếp theo
+	page, err = params.Finish(2, raws(t, items[:2]...), &results)
+	assert.NoError(t, err)
+	assert.False(t, page.HasNext)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestSeekHandlesMissingPosition(t *testing.T) {
+	id := primitive.NewObjectID()
+	params := Params{Limit: 2, Order: ByPosition, Cursor: &Cursor{Field: "position", ID: id}}
+
+	// Sau phần tử chưa có position là các phần tử chưa có position còn lại, rồi tới mọi phần tử có position
+	assert.Equal(t, bson.M{"$or": bson.A{
+		bson.M{"position": nil, "_id": bson.M{"$gt": id}},
+		bson.M{"position": bson.M{"$ne": nil}},
+	}}, params.Seek())
+
+	params = Params{Limit: 2, Order: NewestFirst, Cursor: &Cursor{Field: "_id", ID: id}}
+	assert.Equal(t, bson.M{"_id": bson.M{"$lt": id}}, params.Seek())
+}
+
+func TestPagerKeepsQueryAndCollapsesPages(t *testing.T) {
+	page := &Page{Total: 200, Limit: 10, Page: 7, TotalPages: 20, HasNext: true}
+	page.WithParams(Params{Query: url.Values{"search": {"iron man"}, "page": {"7"}, "cursor": {"x"}}})
+
+	assert.Equal(t, []int{1, 0, 5, 6, 7, 8, 9, 0, 20}, page.Pages())
+	assert.Equal(t, "?page=8&search=iron+man", page.NextURL())
+	assert.Equal(t, "?page=6&search=iron+man", page.URL(page.PrevPage()))
+
+	// Thứ tự hỗ trợ cursor thì trang sau đọc theo cursor, không $skip qua các trang trước
+	page.NextCursor = "abc"
+	assert.Equal(t, "?cursor=abc&search=iron+man", page.NextURL())
+
+	// Trang đọc theo cursor chỉ có link tới trang sau
+	page = &Page{Total: 200, Limit: 10, TotalPages: 20, HasNext: true, NextCursor: "abc"}
+	page.WithParams(Params{Prefix: "category_", Query: url.Values{"category_page": {"2"}}})
+	assert.Nil(t, page.Pages())
+	assert.Equal(t, "?category_cursor=abc", page.NextURL())
+}
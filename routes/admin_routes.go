@@ -2,8 +2,10 @@
 package routes
 
 import (
+	"errors"
 	middleware "fire-watch/auth"
 	controllers "fire-watch/controllers/admin"
+	"fire-watch/pagination"
 	"fire-watch/websocket"
 	"net/http"
 
@@ -11,7 +13,8 @@ import (
 )
 
 func RegisterAdminRoutes(router *gin.Engine, websocketServer *websocket.WebSocketServer) {
-	// Nhóm các route cho admin
+	// Nhóm các route cho admin, mọi vai trò có quyền quản trị đều vào được,
+	// các route thay đổi dữ liệu kiểm tra quyền cụ thể bằng RequirePermission
 	adminRoutes := router.Group("/admin", middleware.AuthMiddleware())
 	{
 		adminRoutes.GET("/dashboard", func(c *gin.Context) {
@@ -23,16 +26,42 @@ func RegisterAdminRoutes(router *gin.Engine, websocketServer *websocket.WebSocke
 			})
 		})
 
+		// Số liệu kết nối WebSocket (client, tin nhắn bị bỏ, client bị ngắt)
+		adminRoutes.GET("/websocket/stats", middleware.RequirePermission(middleware.PermissionSystemManage), func(c *gin.Context) {
+			c.JSON(http.StatusOK, websocketServer.Stats())
+		})
+
+		// Khóa ký JWT: xem danh sách và thay khóa mới, token cũ vẫn hợp lệ đến khi hết hạn
+		adminRoutes.GET("/auth/keys", middleware.RequirePermission(middleware.PermissionSystemManage), func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"keys": middleware.SigningKeys()})
+		})
+		adminRoutes.POST("/auth/keys/rotate", middleware.RequirePermission(middleware.PermissionSystemManage), func(c *gin.Context) {
+			kid, err := middleware.RotateSigningKey()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate signing key"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"kid": kid, "keys": middleware.SigningKeys()})
+		})
+
+		// API key cho script nhập dữ liệu (header X-API-Key), quyền theo scope của từng key
+		adminRoutes.GET("/auth/api-keys", middleware.RequirePermission(middleware.PermissionSystemManage), controllers.GetAPIKeys)
+		adminRoutes.POST("/auth/api-keys", middleware.RequirePermission(middleware.PermissionSystemManage), controllers.CreateAPIKey)
+		adminRoutes.DELETE("/auth/api-keys/:prefix", middleware.RequirePermission(middleware.PermissionSystemManage), controllers.RevokeAPIKey)
+
+		// Dựng lại chỉ mục gợi ý tìm kiếm (/search/suggest) từ toàn bộ phim
+		adminRoutes.POST("/search/suggestions/rebuild", middleware.RequirePermission(middleware.PermissionSystemManage), controllers.RebuildSearchSuggestions)
+
 		//quality
 		//quality
 		//quality
 		adminRoutes.GET("/movies/:movieID/episodes/:episodeID/server/:serverID/qualities", controllers.GetQualityByMovieEpisodeServer)
 		/// Route POST để thêm quality mới, truyền websocketQuality vào controller
-		adminRoutes.POST("/add-quality", func(c *gin.Context) {
+		adminRoutes.POST("/add-quality", middleware.RequirePermission(middleware.PermissionQualityWrite), func(c *gin.Context) {
 			controllers.AddQuality(c, websocketServer) // Truyền websocketQuality vào controller
 		})
 		// Route để cập nhật trường cụ thể của Movie
-		adminRoutes.POST("/update-qulity-field/:id", func(c *gin.Context) {
+		adminRoutes.POST("/update-qulity-field/:id", middleware.RequirePermission(middleware.PermissionQualityWrite), func(c *gin.Context) {
 			controllers.UpdateQualityField(c, websocketServer) // Truyền websocketServer vào controller
 		})
 		// /// Route POST để thêm quality mới, truyền websocketQuality vào controller
@@ -40,7 +69,7 @@ func RegisterAdminRoutes(router *gin.Engine, websocketServer *websocket.WebSocke
 		// 	controllers.UpdateQuality(c, websocketServer) // Truyền websocketQuality vào controller
 		// })
 		/// Route DELETE để xóa quality mới, truyền websocketQuality vào controller
-		adminRoutes.DELETE("/delete-quality/:id", func(c *gin.Context) {
+		adminRoutes.DELETE("/delete-quality/:id", middleware.RequirePermission(middleware.PermissionQualityWrite), func(c *gin.Context) {
 			controllers.DeleteQuality(c, websocketServer) // Truyền websocketQuality vào controller
 		})
 
@@ -49,15 +78,15 @@ func RegisterAdminRoutes(router *gin.Engine, websocketServer *websocket.WebSocke
 		//episode
 		adminRoutes.GET("/movies/:movieID/episodes", controllers.GetEpisodesByMovieID)
 		/// Route POST để thêm episode mới, truyền websocketEpisode vào controller
-		adminRoutes.POST("/add-episode", func(c *gin.Context) {
+		adminRoutes.POST("/add-episode", middleware.RequirePermission(middleware.PermissionEpisodeWrite), func(c *gin.Context) {
 			controllers.AddEpisode(c, websocketServer) // Truyền websocketEpisode vào controller
 		})
 		/// Route POST để thêm episode mới, truyền websocketEpisode vào controller
-		adminRoutes.POST("/update-episode", func(c *gin.Context) {
+		adminRoutes.POST("/update-episode", middleware.RequirePermission(middleware.PermissionEpisodeWrite), func(c *gin.Context) {
 			controllers.UpdateEpisode(c, websocketServer) // Truyền websocketEpisode vào controller
 		})
 		/// Route DELETE để xóa episode mới, truyền websocketEpisode vào controller
-		adminRoutes.DELETE("/delete-episode/:id", func(c *gin.Context) {
+		adminRoutes.DELETE("/delete-episode/:id", middleware.RequirePermission(middleware.PermissionEpisodeWrite), func(c *gin.Context) {
 			controllers.DeleteEpisode(c, websocketServer) // Truyền websocketEpisode vào controller
 		})
 		//server
@@ -88,17 +117,17 @@ func RegisterAdminRoutes(router *gin.Engine, websocketServer *websocket.WebSocke
 			})
 		})
 		/// Route POST để thêm server mới, truyền websocketServer vào controller
-		adminRoutes.POST("/add-server", func(c *gin.Context) {
+		adminRoutes.POST("/add-server", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.AddServer(c, websocketServer) // Truyền websocketServer vào controller
 		})
-		adminRoutes.POST("/update-server/:id", func(c *gin.Context) {
+		adminRoutes.POST("/update-server/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.UpdateServer(c, websocketServer) // Truyền websocketServer vào controller
 		})
-		adminRoutes.DELETE("/delete-server/:id", func(c *gin.Context) {
+		adminRoutes.DELETE("/delete-server/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.DeleteServer(c, websocketServer) // Truyền websocketServer vào controller
 		})
 		// Route để cập nhật trường cụ thể của Server
-		adminRoutes.POST("/update-server-field/:id", func(c *gin.Context) {
+		adminRoutes.POST("/update-server-field/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.UpdateServerField(c, websocketServer) // Truyền websocketServer vào controller
 		})
 
@@ -130,17 +159,17 @@ func RegisterAdminRoutes(router *gin.Engine, websocketServer *websocket.WebSocke
 			})
 		})
 		/// Route POST để thêm category mới, truyền websocketServer vào controller
-		adminRoutes.POST("/add-category", func(c *gin.Context) {
+		adminRoutes.POST("/add-category", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.AddCategory(c, websocketServer) // Truyền websocketServer vào controller
 		})
-		adminRoutes.POST("/update-category/:id", func(c *gin.Context) {
+		adminRoutes.POST("/update-category/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.UpdateCategory(c, websocketServer) // Truyền websocketServer vào controller
 		})
-		adminRoutes.DELETE("/delete-category/:id", func(c *gin.Context) {
+		adminRoutes.DELETE("/delete-category/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.DeleteCategory(c, websocketServer) // Truyền websocketServer vào controller
 		})
 		// Route để cập nhật trường cụ thể của Category
-		adminRoutes.POST("/update-category-field/:id", func(c *gin.Context) {
+		adminRoutes.POST("/update-category-field/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.UpdateCategoryField(c, websocketServer) // Truyền websocketServer vào controller
 		})
 
@@ -172,17 +201,17 @@ func RegisterAdminRoutes(router *gin.Engine, websocketServer *websocket.WebSocke
 			})
 		})
 		/// Route POST để thêm genre mới, truyền websocketServer vào controller
-		adminRoutes.POST("/add-genre", func(c *gin.Context) {
+		adminRoutes.POST("/add-genre", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.AddGenre(c, websocketServer) // Truyền websocketServer vào controller
 		})
-		adminRoutes.POST("/update-genre/:id", func(c *gin.Context) {
+		adminRoutes.POST("/update-genre/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.UpdateGenre(c, websocketServer) // Truyền websocketServer vào controller
 		})
-		adminRoutes.DELETE("/delete-genre/:id", func(c *gin.Context) {
+		adminRoutes.DELETE("/delete-genre/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.DeleteGenre(c, websocketServer) // Truyền websocketServer vào controller
 		})
 		// Route để cập nhật trường cụ thể của Genre
-		adminRoutes.POST("/update-genre-field/:id", func(c *gin.Context) {
+		adminRoutes.POST("/update-genre-field/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.UpdateGenreField(c, websocketServer) // Truyền websocketServer vào controller
 		})
 
@@ -214,17 +243,17 @@ func RegisterAdminRoutes(router *gin.Engine, websocketServer *websocket.WebSocke
 			})
 		})
 		/// Route POST để thêm country mới, truyền websocketServer vào controller
-		adminRoutes.POST("/add-country", func(c *gin.Context) {
+		adminRoutes.POST("/add-country", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.AddCountry(c, websocketServer) // Truyền websocketServer vào controller
 		})
-		adminRoutes.POST("/update-country/:id", func(c *gin.Context) {
+		adminRoutes.POST("/update-country/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.UpdateCountry(c, websocketServer) // Truyền websocketServer vào controller
 		})
-		adminRoutes.DELETE("/delete-country/:id", func(c *gin.Context) {
+		adminRoutes.DELETE("/delete-country/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.DeleteCountry(c, websocketServer) // Truyền websocketServer vào controller
 		})
 		// Route để cập nhật trường cụ thể của Country
-		adminRoutes.POST("/update-country-field/:id", func(c *gin.Context) {
+		adminRoutes.POST("/update-country-field/:id", middleware.RequirePermission(middleware.PermissionCatalogWrite), func(c *gin.Context) {
 			controllers.UpdateCountryField(c, websocketServer) // Truyền websocketServer vào controller
 		})
 
@@ -232,7 +261,11 @@ func RegisterAdminRoutes(router *gin.Engine, websocketServer *websocket.WebSocke
 		//movie
 		//movie
 		adminRoutes.GET("/movie", func(c *gin.Context) {
-			movies, categories, genres, countries, episodes, servers, err := controllers.GetAllMoviesWithOptions(c, websocketServer)
+			movies, page, categories, genres, countries, episodes, servers, err := controllers.GetAllMoviesWithOptions(c)
+			if errors.Is(err, pagination.ErrInvalid) {
+				c.String(http.StatusBadRequest, "Invalid pagination parameters")
+				return
+			}
 			if err != nil {
 				c.String(http.StatusInternalServerError, "Error fetching movies with options")
 				return
@@ -243,6 +276,7 @@ func RegisterAdminRoutes(router *gin.Engine, websocketServer *websocket.WebSocke
 				"title":      "Admin Movie List",
 				"template":   "movie",    // Đây là tên của template được định nghĩa
 				"movies":     movies,     // Danh sách phim
+				"page":       page,       // Phân trang của danh sách phim
 				"categories": categories, // Danh sách thể loại
 				"genres":     genres,     // Danh sách thể loại phim
 				"countries":  countries,  // Danh sách quốc gia
@@ -251,40 +285,44 @@ func RegisterAdminRoutes(router *gin.Engine, websocketServer *websocket.WebSocke
 			})
 		})
 		adminRoutes.GET("/movies", func(c *gin.Context) {
-			movies, categories, genres, countries, episodes, servers, err := controllers.GetAllMoviesWithOptions(c, websocketServer)
+			movies, page, categories, genres, countries, episodes, servers, err := controllers.GetAllMoviesWithOptions(c)
+			if errors.Is(err, pagination.ErrInvalid) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters"})
+				return
+			}
 			if err != nil {
 				c.String(http.StatusInternalServerError, "Error fetching movies with options")
 				return
 			}
 
-			c.JSON(http.StatusOK, gin.H{
+			c.JSON(http.StatusOK, page.Merge(gin.H{
 				"movies":     movies,     // Danh sách phim
 				"categories": categories, // Danh sách thể loại
 				"genres":     genres,     // Danh sách thể loại phim
 				"countries":  countries,  // Danh sách quốc gia
 				"episodes":   episodes,   // Danh sách quốc gia
 				"servers":    servers,
-			})
+			}))
 		})
 		/// Route POST để thêm country mới, truyền websocketServer vào controller
-		adminRoutes.POST("/add-movie", func(c *gin.Context) {
+		adminRoutes.POST("/add-movie", middleware.RequirePermission(middleware.PermissionMovieWrite), func(c *gin.Context) {
 			controllers.AddMovie(c, websocketServer) // Truyền websocketServer vào controller
 		})
-		adminRoutes.POST("/update-movie/:id", func(c *gin.Context) {
+		adminRoutes.POST("/update-movie/:id", middleware.RequirePermission(middleware.PermissionMovieWrite), func(c *gin.Context) {
 			controllers.UpdateMovie(c, websocketServer) // Truyền websocketServer vào controller
 		})
-		adminRoutes.POST("/movie-update-position", func(c *gin.Context) {
+		adminRoutes.POST("/movie-update-position", middleware.RequirePermission(middleware.PermissionMovieWrite), func(c *gin.Context) {
 			controllers.UpdateMoviePosition(c, websocketServer) // Truyền websocketServer vào controller
 		})
-		adminRoutes.DELETE("/delete-movie/:id", func(c *gin.Context) {
+		adminRoutes.DELETE("/delete-movie/:id", middleware.RequirePermission(middleware.PermissionMovieWrite), func(c *gin.Context) {
 			controllers.DeleteMovie(c, websocketServer) // Truyền websocketServer vào controller
 		})
 		// Route để cập nhật trường cụ thể của Movie
-		adminRoutes.POST("/update-movie-field/:id", func(c *gin.Context) {
+		adminRoutes.POST("/update-movie-field/:id", middleware.RequirePermission(middleware.PermissionMovieWrite), func(c *gin.Context) {
 			controllers.UpdateMovieField(c, websocketServer) // Truyền websocketServer vào controller
 		})
 		// Route để cập nhật trường cụ thể của Movie
-		adminRoutes.POST("/delete-movie-image", func(c *gin.Context) {
+		adminRoutes.POST("/delete-movie-image", middleware.RequirePermission(middleware.PermissionMovieWrite), func(c *gin.Context) {
 			controllers.DeleteMovieImage(c, websocketServer) // Truyền websocketServer vào controller
 		})
 	}
@@ -2,32 +2,76 @@
 package routes
 
 import (
+	middleware "fire-watch/auth"
 	"fire-watch/controllers"
+	"fire-watch/websocket"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterAuthRoutes(router *gin.Engine) {
+func RegisterAuthRoutes(router *gin.Engine, websocketServer *websocket.WebSocketServer) {
 	authRoutes := router.Group("/auth")
 	{
-		authRoutes.POST("/login", controllers.LoginUser)
+		// Đăng nhập sai nhiều lần bị khóa tạm thời, admin được báo qua WebSocket
+		authRoutes.POST("/login", func(c *gin.Context) {
+			controllers.LoginUser(c, websocketServer)
+		})
 		// Route GET /auth/login trả về trang đăng nhập
 		authRoutes.GET("/login", func(c *gin.Context) {
 			// Render trang sign-in.html
 			c.HTML(200, "sign-in.html", gin.H{
 				"title": "Sign In",
+				"mode":  "login",
 			})
 		})
+		// Bước thứ hai khi tài khoản đã bật xác thực hai bước (TOTP)
+		authRoutes.POST("/login/2fa", controllers.VerifyTwoFactorLogin)
+		authRoutes.POST("/refresh", controllers.RefreshToken)
+		authRoutes.POST("/logout", controllers.LogoutUser)
+		authRoutes.POST("/logout-all", controllers.LogoutAllDevices)
 		authRoutes.POST("/register", controllers.RegisterUser)
+		// Xác minh email, quên và đặt lại mật khẩu qua liên kết gửi trong email
+		authRoutes.GET("/verify", controllers.VerifyEmail)
+		authRoutes.POST("/verify", controllers.ResendVerificationEmail)
+		authRoutes.GET("/forgot", controllers.ForgotPasswordPage)
+		authRoutes.POST("/forgot", controllers.ForgotPassword)
+		authRoutes.GET("/reset", controllers.ResetPasswordPage)
+		authRoutes.POST("/reset", controllers.ResetPassword)
+		authRoutes.GET("/verify-email", controllers.ConfirmEmailChange)
 		authRoutes.GET("/register", func(c *gin.Context) {
 			// Render trang sign-in.html
 			c.HTML(200, "sign-up.html", gin.H{
 				"title": "Sign Up",
 			})
 		})
-		authRoutes.GET("/getallusers", controllers.GetAllUsers)
-		authRoutes.GET("/getuser/:id", controllers.GetUserByID)
-		authRoutes.PUT("/updateuser/:id", controllers.UpdateUser)
-		authRoutes.DELETE("/deleteuser/:id", controllers.DeleteUser)
+	}
+
+	// Đăng ký TOTP nhận cả pre-auth token (header X-Pre-Auth-Token) khi vai trò bắt buộc 2FA
+	twoFactorRoutes := router.Group("/auth/2fa")
+	{
+		twoFactorRoutes.POST("/setup", controllers.SetupTwoFactor)
+		twoFactorRoutes.POST("/enable", controllers.EnableTwoFactor)
+		twoFactorRoutes.POST("/disable", middleware.RequireAuth(), controllers.DisableTwoFactor)
+		twoFactorRoutes.POST("/recovery-codes", middleware.RequireAuth(), controllers.RegenerateRecoveryCodes)
+	}
+
+	// Người dùng tự quản lý tài khoản của mình
+	meRoutes := router.Group("/me", middleware.RequireAuth())
+	{
+		meRoutes.GET("", controllers.GetProfile)
+		meRoutes.PATCH("", controllers.UpdateProfile)
+		meRoutes.DELETE("", controllers.DeleteAccount)
+		meRoutes.POST("/avatar", controllers.UploadAvatar)
+		meRoutes.POST("/password", controllers.ChangePassword)
+		meRoutes.POST("/email", controllers.ChangeEmail)
+	}
+
+	// Quản lý người dùng cần đăng nhập và quyền user:manage, phản hồi không kèm mật khẩu
+	userRoutes := router.Group("/auth", middleware.RequireAuth(), middleware.RequirePermission(middleware.PermissionUserManage))
+	{
+		userRoutes.GET("/getallusers", controllers.GetAllUsers)
+		userRoutes.GET("/getuser/:id", controllers.GetUserByID)
+		userRoutes.PUT("/updateuser/:id", controllers.UpdateUser)
+		userRoutes.DELETE("/deleteuser/:id", controllers.DeleteUser)
 	}
 }
@@ -2,6 +2,7 @@
 package routes
 
 import (
+	middleware "fire-watch/auth"
 	"fire-watch/controllers"
 
 	"github.com/gin-gonic/gin"
@@ -10,10 +11,16 @@ import (
 func RegisterCategoryRoutes(router *gin.Engine) {
 	categoryRoutes := router.Group("/categories")
 	{
-		categoryRoutes.POST("/addcategory", controllers.AddCategory)
+		// API đọc công khai
 		categoryRoutes.GET("/getallcategories", controllers.GetAllCategories)
 		categoryRoutes.GET("/getcategory/:id", controllers.GetCategoryByID)
-		categoryRoutes.PUT("/updatecategory/:id", controllers.UpdateCategory)
-		categoryRoutes.DELETE("/deletecategory/:id", controllers.DeleteCategory)
+	}
+
+	// API ghi cần đăng nhập và quyền catalog:write
+	categoryWriteRoutes := router.Group("/categories", middleware.RequireAuth(), middleware.RequirePermission(middleware.PermissionCatalogWrite))
+	{
+		categoryWriteRoutes.POST("/addcategory", controllers.AddCategory)
+		categoryWriteRoutes.PUT("/updatecategory/:id", controllers.UpdateCategory)
+		categoryWriteRoutes.DELETE("/deletecategory/:id", controllers.DeleteCategory)
 	}
 }
@@ -2,6 +2,7 @@
 package routes
 
 import (
+	middleware "fire-watch/auth"
 	"fire-watch/controllers"
 	"github.com/gin-gonic/gin"
 )
@@ -9,10 +10,16 @@ import (
 func RegisterCountryRoutes(router *gin.Engine) {
 	countryRoutes := router.Group("/countries")
 	{
-		countryRoutes.POST("/addcountry", controllers.AddCountry)
+		// API đọc công khai
 		countryRoutes.GET("/getallcountries", controllers.GetAllCountries)
 		countryRoutes.GET("/getcountry/:id", controllers.GetCountryByID)
-		countryRoutes.PUT("/updatecountry/:id", controllers.UpdateCountry)
-		countryRoutes.DELETE("/deletecountry/:id", controllers.DeleteCountry)
+	}
+
+	// API ghi cần đăng nhập và quyền catalog:write
+	countryWriteRoutes := router.Group("/countries", middleware.RequireAuth(), middleware.RequirePermission(middleware.PermissionCatalogWrite))
+	{
+		countryWriteRoutes.POST("/addcountry", controllers.AddCountry)
+		countryWriteRoutes.PUT("/updatecountry/:id", controllers.UpdateCountry)
+		countryWriteRoutes.DELETE("/deletecountry/:id", controllers.DeleteCountry)
 	}
 }
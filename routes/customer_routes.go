@@ -2,7 +2,9 @@
 package routes
 
 import (
+	"errors"
 	controllers "fire-watch/controllers/customer"
+	"fire-watch/pagination"
 	"fire-watch/websocket"
 	"fmt"
 	"net/http"
@@ -13,14 +15,22 @@ import (
 func RegisterCustomerRoutes(router *gin.Engine, websocketServer *websocket.WebSocketServer) {
 	router.GET("/home", func(c *gin.Context) {
 		// Gọi hàm lấy danh sách phim
-		movies, err := controllers.GetAllMovies(c)
+		movies, page, err := controllers.GetAllMovies(c)
+		if errors.Is(err, pagination.ErrInvalid) {
+			c.String(http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
 		if err != nil {
 			c.String(http.StatusInternalServerError, "Error fetching movies with options")
 			return
 		}
 
 		// Gọi hàm lấy danh mục kèm danh sách phim
-		categorieswithmovie, err := controllers.GetCategoriesWithMovies(c)
+		categorieswithmovie, categoryPage, err := controllers.GetCategoriesWithMovies(c)
+		if errors.Is(err, pagination.ErrInvalid) {
+			c.String(http.StatusBadRequest, "Invalid pagination parameters")
+			return
+		}
 		if err != nil {
 			c.String(http.StatusInternalServerError, "Error fetching categories with movies")
 			return
@@ -41,13 +51,19 @@ func RegisterCustomerRoutes(router *gin.Engine, websocketServer *websocket.WebSo
 			"title":               "Customer Home",
 			"template":            "home",
 			"movies":              movies,              // Danh sách phim
+			"page":                page,                // Phân trang của danh sách phim
 			"categorieswithmovie": categorieswithmovie, // Danh sách danh mục kèm phim
+			"categoryPage":        categoryPage,        // Phân trang của danh sách danh mục
 			"user":                user,                // Danh sách danh mục kèm phim
 		})
 	})
 
 	router.GET("/search", func(c *gin.Context) {
-		movies, err := controllers.SearchMovies(c)
+		listing, err := controllers.FilterMovies(c)
+		if err == controllers.ErrInvalidFilter {
+			c.String(http.StatusBadRequest, "Invalid filter")
+			return
+		}
 		if err != nil {
 			c.String(http.StatusInternalServerError, fmt.Sprintf("Error fetching movie: %v", err))
 			return
@@ -56,11 +72,22 @@ func RegisterCustomerRoutes(router *gin.Engine, websocketServer *websocket.WebSo
 		c.HTML(http.StatusOK, "customer.html", gin.H{
 			"title":    "search",
 			"template": "search",
-			"movies":   movies, // Danh sách phim
-			// Danh sách danh mục kèm phim
+			"movies":   listing.Movies, // Danh sách phim
+			"listing":  listing,        // Tổng số, số đếm theo bộ lọc và bộ lọc đang chọn
 		})
 	})
 
+	// Gợi ý tên phim khi đang gõ vào ô tìm kiếm
+	router.GET("/search/suggest", func(c *gin.Context) {
+		suggestions, err := controllers.SuggestMovies(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching suggestions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+	})
+
 	router.GET("/movie/:id", func(c *gin.Context) {
 		movie, err := controllers.GetMoviesDetail(c)
 		if err != nil {
@@ -88,26 +115,32 @@ func RegisterCustomerRoutes(router *gin.Engine, websocketServer *websocket.WebSo
 	})
 
 	router.GET("/movies", func(c *gin.Context) {
-		movies, err := controllers.GetAllMovies(c)
+		listing, err := controllers.FilterMovies(c)
+		if err == controllers.ErrInvalidFilter {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter"})
+			return
+		}
 		if err != nil {
 			c.String(http.StatusInternalServerError, "Error fetching movies with options")
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"movies": movies, // Danh sách phim
-		})
+		c.JSON(http.StatusOK, listing)
 	})
 
 	router.GET("/categories-movies", func(c *gin.Context) {
-		categorieswithmovie, err := controllers.GetCategoriesWithMovies(c)
+		categorieswithmovie, page, err := controllers.GetCategoriesWithMovies(c)
+		if errors.Is(err, pagination.ErrInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters"})
+			return
+		}
 		if err != nil {
 			c.String(http.StatusInternalServerError, "Error fetching categorieswithmovie with options")
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
+		c.JSON(http.StatusOK, page.Merge(gin.H{
 			"categorieswithmovie": categorieswithmovie, // Danh sách phim
-		})
+		}))
 	})
 }
@@ -2,6 +2,7 @@
 package routes
 
 import (
+	middleware "fire-watch/auth"
 	"fire-watch/controllers"
 	"github.com/gin-gonic/gin"
 )
@@ -9,10 +10,16 @@ import (
 func RegisterEpisodeRoutes(router *gin.Engine) {
 	episodeRoutes := router.Group("/episodes")
 	{
-		episodeRoutes.POST("/addepisode", controllers.AddEpisode)
+		// API đọc công khai
 		episodeRoutes.GET("/getallepisodes", controllers.GetAllEpisodes)
 		episodeRoutes.GET("/getepisode/:id", controllers.GetEpisodeByID)
-		episodeRoutes.PUT("/updateepisode/:id", controllers.UpdateEpisode)
-		episodeRoutes.DELETE("/deleteepisode/:id", controllers.DeleteEpisode)
+	}
+
+	// API ghi cần đăng nhập và quyền episode:write
+	episodeWriteRoutes := router.Group("/episodes", middleware.RequireAuth(), middleware.RequirePermission(middleware.PermissionEpisodeWrite))
+	{
+		episodeWriteRoutes.POST("/addepisode", controllers.AddEpisode)
+		episodeWriteRoutes.PUT("/updateepisode/:id", controllers.UpdateEpisode)
+		episodeWriteRoutes.DELETE("/deleteepisode/:id", controllers.DeleteEpisode)
 	}
 }
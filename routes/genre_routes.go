@@ -2,6 +2,7 @@
 package routes
 
 import (
+	middleware "fire-watch/auth"
 	"fire-watch/controllers"
 
 	"github.com/gin-gonic/gin"
@@ -10,10 +11,16 @@ import (
 func RegisterGenreRoutes(router *gin.Engine) {
 	genreRoutes := router.Group("/genres")
 	{
-		genreRoutes.POST("/addgenre", controllers.AddGenre)
+		// API đọc công khai
 		genreRoutes.GET("/getallgenres", controllers.GetAllGenres)
 		genreRoutes.GET("/getgenre/:id", controllers.GetGenreByID)
-		genreRoutes.PUT("/updategenre/:id", controllers.UpdateGenre)
-		genreRoutes.DELETE("/deletegenre/:id", controllers.DeleteGenre)
+	}
+
+	// API ghi cần đăng nhập và quyền catalog:write
+	genreWriteRoutes := router.Group("/genres", middleware.RequireAuth(), middleware.RequirePermission(middleware.PermissionCatalogWrite))
+	{
+		genreWriteRoutes.POST("/addgenre", controllers.AddGenre)
+		genreWriteRoutes.PUT("/updategenre/:id", controllers.UpdateGenre)
+		genreWriteRoutes.DELETE("/deletegenre/:id", controllers.DeleteGenre)
 	}
 }
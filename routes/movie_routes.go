@@ -2,6 +2,7 @@
 package routes
 
 import (
+	middleware "fire-watch/auth"
 	"fire-watch/controllers"
 
 	"github.com/gin-gonic/gin"
@@ -10,12 +11,18 @@ import (
 func RegisterMovieRoutes(router *gin.Engine) {
 	movieRoutes := router.Group("/movies")
 	{
-		movieRoutes.POST("/addmovie", controllers.AddMovie)
+		// API đọc công khai
 		movieRoutes.GET("/getallmovies", controllers.GetAllMovies)
 		movieRoutes.GET("/getmovie/:id", controllers.GetMovieByID)
-		movieRoutes.PUT("/updatemovie/:id", controllers.UpdateMovie)
-		movieRoutes.DELETE("/deletemovie/:id", controllers.DeleteMovie)
 		movieRoutes.GET("/getmoviewithepisode/:id", controllers.GetMovieWithEpisodes)
-		movieRoutes.POST("/api/movies/bulk", controllers.CreateMoviesBulk)
+	}
+
+	// API ghi cần đăng nhập và quyền movie:write
+	movieWriteRoutes := router.Group("/movies", middleware.RequireAuth(), middleware.RequirePermission(middleware.PermissionMovieWrite))
+	{
+		movieWriteRoutes.POST("/addmovie", controllers.AddMovie)
+		movieWriteRoutes.PUT("/updatemovie/:id", controllers.UpdateMovie)
+		movieWriteRoutes.DELETE("/deletemovie/:id", controllers.DeleteMovie)
+		movieWriteRoutes.POST("/api/movies/bulk", controllers.CreateMoviesBulk)
 	}
 }
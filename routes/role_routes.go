@@ -2,6 +2,7 @@
 package routes
 
 import (
+	middleware "fire-watch/auth"
 	"fire-watch/controllers"
 
 	"github.com/gin-gonic/gin"
@@ -10,10 +11,17 @@ import (
 func RegisterRoleRoutes(router *gin.Engine) {
 	roleRoutes := router.Group("/roles")
 	{
-		roleRoutes.POST("/addrole", controllers.AddRole)
+		// API đọc công khai
 		roleRoutes.GET("/getallroles", controllers.GetAllRoles)
 		roleRoutes.GET("/getrole/:id", controllers.GetRoleByID)
-		roleRoutes.PUT("/updaterole/:id", controllers.UpdateRole)
-		roleRoutes.DELETE("/deleterole/:id", controllers.DeleteRole)
+	}
+
+	// Sửa vai trò thay đổi quyền của mọi người dùng mang vai trò đó, nên cần cả system:manage.
+	// Controller còn từ chối cấp quyền mà chính người gọi không có
+	roleWriteRoutes := router.Group("/roles", middleware.RequireAuth(), middleware.RequirePermission(middleware.PermissionUserManage, middleware.PermissionSystemManage))
+	{
+		roleWriteRoutes.POST("/addrole", controllers.AddRole)
+		roleWriteRoutes.PUT("/updaterole/:id", controllers.UpdateRole)
+		roleWriteRoutes.DELETE("/deleterole/:id", controllers.DeleteRole)
 	}
 }
@@ -0,0 +1,224 @@
+package routes
+
+import (
+	"context"
+	middleware "fire-watch/auth"
+	"fire-watch/websocket"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// Các route ghi được phép gọi khi chưa đăng nhập
+var publicMutatingRoutes = map[string]bool{
+	"POST /auth/login":     true,
+	"POST /auth/login/2fa": true,
+	"POST /auth/register":  true,
+	"POST /auth/refresh":   true,
+	"POST /auth/logout":    true,
+	"POST /auth/verify":    true,
+	"POST /auth/forgot":    true,
+	"POST /auth/reset":     true,
+}
+
+func setupRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	// Cùng thứ tự đăng ký với main.go
+	RegisterMovieRoutes(router)
+	RegisterCategoryRoutes(router)
+	RegisterCountryRoutes(router)
+	RegisterGenreRoutes(router)
+	websocketServer := websocket.NewWebSocketServer()
+	RegisterRoleRoutes(router)
+	RegisterAuthRoutes(router, websocketServer)
+	RegisterEpisodeRoutes(router)
+
+	RegisterAdminRoutes(router, websocketServer)
+	RegisterCustomerRoutes(router, websocketServer)
+	return router
+}
+
+var pathParam = regexp.MustCompile(`:[A-Za-z]+`)
+
+// Các route ghi mọi người dùng đã đăng nhập đều được gọi cho chính tài khoản của mình
+var selfServiceRoutes = map[string]bool{
+	"POST /auth/logout-all":         true,
+	"POST /auth/2fa/setup":          true,
+	"POST /auth/2fa/enable":         true,
+	"POST /auth/2fa/disable":        true,
+	"POST /auth/2fa/recovery-codes": true,
+	"PATCH /me":                     true,
+	"DELETE /me":                    true,
+	"POST /me/avatar":               true,
+	"POST /me/password":             true,
+	"POST /me/email":                true,
+}
+
+// mutatingRoutes gọi fn cho mọi route thay đổi dữ liệu, tham số đường dẫn được thay bằng ObjectID hợp lệ
+func mutatingRoutes(t *testing.T, routes gin.RoutesInfo, skip map[string]bool, fn func(method string, path string)) {
+	count := 0
+	for _, route := range routes {
+		if route.Method == http.MethodGet || route.Method == http.MethodHead {
+			continue
+		}
+		if publicMutatingRoutes[route.Method+" "+route.Path] || skip[route.Method+" "+route.Path] {
+			continue
+		}
+		count++
+		fn(route.Method, pathParam.ReplaceAllString(route.Path, "64b000000000000000000001"))
+	}
+	assert.NotZero(t, count)
+}
+
+func TestMutatingRoutesRejectAnonymousCallers(t *testing.T) {
+	for _, router := range []*gin.Engine{setupRouter(), SetupRouter()} {
+		mutatingRoutes(t, router.Routes(), nil, func(method string, path string) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+
+			// Trang admin chuyển hướng về trang đăng nhập, API trả 401
+			assert.Contains(t, []int{http.StatusUnauthorized, http.StatusFound}, recorder.Code, "%s %s", method, path)
+		})
+	}
+}
+
+func TestMutatingRoutesRejectCustomers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	middleware.EnableRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	t.Cleanup(func() { middleware.EnableRedisStore(nil) })
+
+	session, err := middleware.CreateSession(&middleware.Identity{UserID: "u1", Role: "customer"})
+	assert.NoError(t, err)
+
+	router := setupRouter()
+	mutatingRoutes(t, router.Routes(), selfServiceRoutes, func(method string, path string) {
+		request := httptest.NewRequest(method, path, nil)
+		request.AddCookie(&http.Cookie{Name: "session_token", Value: session.ID})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		assert.Contains(t, []int{http.StatusForbidden, http.StatusFound}, recorder.Code, "%s %s", method, path)
+	})
+}
+
+func TestMutatingRoutesRejectReadOnlyAPIKeys(t *testing.T) {
+	mr := miniredis.RunT(t)
+	middleware.EnableRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	t.Cleanup(func() { middleware.EnableRedisStore(nil) })
+
+	key, _, err := middleware.CreateAPIKey("importer", []string{middleware.ScopeCatalogRead}, "u1", nil)
+	assert.NoError(t, err)
+
+	router := setupRouter()
+	mutatingRoutes(t, router.Routes(), selfServiceRoutes, func(method string, path string) {
+		request := httptest.NewRequest(method, path, nil)
+		request.Header.Set("X-API-Key", key)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		assert.Contains(t, []int{http.StatusForbidden, http.StatusFound}, recorder.Code, "%s %s", method, path)
+	})
+}
+
+func TestMovieFilterRejectsInvalidParameters(t *testing.T) {
+	router := setupRouter()
+
+	// Bộ lọc sai bị từ chối trước khi truy vấn MongoDB
+	for _, query := range []string{"genre=not-an-id", "quality=480", "year=abc", "sort=random", "hot=maybe"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/movies?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+	}
+}
+
+func TestListRoutesRejectInvalidPagination(t *testing.T) {
+	router := setupRouter()
+
+	// Cursor sai hoặc số trang quá lớn bị từ chối trước khi đọc cache hay truy vấn MongoDB
+	for _, path := range []string{
+		"/movies?cursor=garbage", "/movies?sort=views&cursor=garbage", "/categories-movies?category_cursor=garbage", "/home?cursor=garbage",
+		"/movies?page=9223372036854775807", "/categories-movies?category_page=100000", "/home?page=1001",
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, path)
+	}
+}
+
+const sessionUserID = "64b000000000000000000001"
+
+// sessionWithPermissions tạo phiên của người dùng mang vai trò role với các quyền cho trước
+func sessionWithPermissions(t *testing.T, role string, permissions ...string) string {
+	mr := miniredis.RunT(t)
+	middleware.EnableRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	t.Cleanup(func() { middleware.EnableRedisStore(nil) })
+
+	middleware.SetPermissionLoader(func(ctx context.Context, name string) ([]string, error) {
+		if name == role {
+			return permissions, nil
+		}
+		return nil, nil
+	})
+	t.Cleanup(func() {
+		middleware.SetPermissionLoader(func(ctx context.Context, name string) ([]string, error) { return nil, nil })
+	})
+
+	session, err := middleware.CreateSession(&middleware.Identity{UserID: sessionUserID, Role: role})
+	assert.NoError(t, err)
+	return session.ID
+}
+
+func TestRoleWritesCannotEscalatePermissions(t *testing.T) {
+	router := setupRouter()
+	body := `{"name":"root","permissions":["system:manage","user:manage"]}`
+
+	// user:manage không đủ để tạo hay sửa vai trò
+	session := sessionWithPermissions(t, "manager", middleware.PermissionUserManage)
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/roles/addrole"},
+		{http.MethodPut, "/roles/updaterole/64b000000000000000000001"},
+	} {
+		request := httptest.NewRequest(route.method, route.path, strings.NewReader(body))
+		request.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusForbidden, recorder.Code, route.path)
+	}
+
+	// Có quyền sửa vai trò vẫn không cấp được quyền mình không có
+	session = sessionWithPermissions(t, "operator", middleware.PermissionUserManage, middleware.PermissionSystemManage)
+	request := httptest.NewRequest(http.MethodPost, "/roles/addrole", strings.NewReader(`{"name":"ads","permissions":["ads:manage"]}`))
+	request.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "Cannot grant permissions")
+}
+
+func TestUpdateUserCannotGrantMoreThanCallerHolds(t *testing.T) {
+	router := setupRouter()
+	session := sessionWithPermissions(t, "manager", middleware.PermissionUserManage)
+
+	for _, tc := range []struct{ id, body, message string }{
+		// Vai trò admin có mọi quyền, nhiều hơn người gọi
+		{"64b000000000000000000002", `{"role":"admin"}`, "Cannot grant permissions"},
+		// Không tự đổi vai trò của chính mình, kể cả sang vai trò hợp lệ
+		{sessionUserID, `{"role":"customer"}`, "your own role"},
+	} {
+		request := httptest.NewRequest(http.MethodPut, "/auth/updateuser/"+tc.id, strings.NewReader(tc.body))
+		request.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusForbidden, recorder.Code, tc.body)
+		assert.Contains(t, recorder.Body.String(), tc.message)
+	}
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	middleware "fire-watch/auth"
 	"fire-watch/controllers"
 
 	"github.com/gin-gonic/gin"
@@ -12,9 +13,11 @@ func SetupRouter() *gin.Engine {
 	// Định nghĩa các route cho sách
 	router.GET("/test/movies", controllers.GetAllMovies)
 	router.GET("/test/movies/:id", controllers.GetMovieByID)
-	router.POST("/test/movies", controllers.AddMovie)
-	router.PUT("/test/movies/:id", controllers.UpdateMovie)
-	router.DELETE("/test/movies/:id", controllers.DeleteMovie)
+
+	writeRoutes := router.Group("/test", middleware.RequireAuth(), middleware.RequirePermission(middleware.PermissionMovieWrite))
+	writeRoutes.POST("/movies", controllers.AddMovie)
+	writeRoutes.PUT("/movies/:id", controllers.UpdateMovie)
+	writeRoutes.DELETE("/movies/:id", controllers.DeleteMovie)
 
 	return router
 }
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxQueryLength giới hạn độ dài từ khóa tìm kiếm (số ký tự) để truy vấn không quá nặng
+const maxQueryLength = 100
+
+// Fold chuẩn hóa chuỗi để so khớp không dấu, không phân biệt hoa thường:
+// "Người Nhện: Không Còn Nhà" -> "nguoi nhen khong con nha".
+// Dấu câu và ký tự đặc biệt thành khoảng trắng, nên kết quả an toàn để đưa vào $text.
+func Fold(value string) string {
+	var builder strings.Builder
+	space := true // Bỏ khoảng trắng ở đầu và gộp các khoảng trắng liên tiếp
+	for _, r := range norm.NFD.String(value) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Dấu thanh và dấu mũ đã tách khỏi chữ cái sau khi chuẩn hóa NFD
+			continue
+		case r == 'đ' || r == 'Đ':
+			// "đ" là chữ cái riêng, không tách được thành "d" + dấu
+			r = 'd'
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			r = unicode.ToLower(r)
+		default:
+			if !space {
+				builder.WriteByte(' ')
+				space = true
+			}
+			continue
+		}
+		builder.WriteRune(r)
+		space = false
+	}
+	return strings.TrimRight(builder.String(), " ")
+}
+
+// Query chuẩn hóa từ khóa người dùng nhập, cắt bớt nếu quá dài. Chuỗi rỗng nghĩa là không có gì để tìm.
+func Query(value string) string {
+	if runes := []rune(value); len(runes) > maxQueryLength {
+		value = string(runes[:maxQueryLength])
+	}
+	return Fold(value)
+}
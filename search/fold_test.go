@@ -0,0 +1,26 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFoldRemovesVietnameseDiacritics(t *testing.T) {
+	assert.Equal(t, "nguoi nhen khong con nha", Fold("Người Nhện: Không Còn Nhà"))
+	assert.Equal(t, "dao hai tac", Fold("ĐẢO HẢI TẶC"))
+	assert.Equal(t, "tay du ky 1986", Fold("  Tây Du Ký (1986)  "))
+	// Chuỗi dựng sẵn (NFC) và tổ hợp (NFD) cho cùng kết quả
+	assert.Equal(t, Fold("Phở"), Fold("Phở"))
+}
+
+func TestFoldStripsTextSearchOperators(t *testing.T) {
+	assert.Equal(t, "spider man", Fold(`"spider" -man`))
+	assert.Equal(t, "", Fold(`"-" !!`))
+}
+
+func TestQueryTruncatesLongInput(t *testing.T) {
+	query := Query(strings.Repeat("ă", 500))
+	assert.Equal(t, maxQueryLength, len(query))
+}
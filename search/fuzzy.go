@@ -0,0 +1,141 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Chỉ mục trigram trong process cho gợi ý "có phải bạn muốn tìm", chỉ dùng khi tìm kiếm không có kết quả.
+// Cách tính giống word_similarity của pg_trgm: tỷ lệ trigram của từ khóa có trong tên phim,
+// nên từ khóa ngắn gõ sai vẫn khớp được tên phim dài
+
+// Độ giống tối thiểu để một tên phim được gợi ý
+const fuzzyThreshold = 0.5
+
+// Độ dài tối thiểu (ký tự, sau khi bỏ dấu) của từ khóa, từ khóa ngắn hơn cho quá nhiều gợi ý vô nghĩa
+const fuzzyMinLength = 3
+
+// DidYouMeanLimit là số gợi ý tối đa trả về
+const DidYouMeanLimit = 5
+
+// Title là một phim đang hoạt động trong chỉ mục gợi ý
+type Title struct {
+	ID      string
+	Title   string
+	NameEng string
+}
+
+// Match là một tên phim gần giống từ khóa
+type Match struct {
+	ID    string  `json:"id"`
+	Title string  `json:"title"` // Tên khớp nhất (tiếng Việt hoặc tiếng Anh), giữ nguyên dấu
+	Score float64 `json:"score"`
+}
+
+type fuzzyEntry struct {
+	id    string
+	name  string
+	grams int
+}
+
+type fuzzyIndex struct {
+	mutex    sync.RWMutex
+	entries  []fuzzyEntry
+	postings map[string][]int // trigram -> vị trí trong entries
+}
+
+var titles = &fuzzyIndex{postings: map[string][]int{}}
+
+// trigrams tách chuỗi đã bỏ dấu thành tập trigram theo từng từ, thêm khoảng trắng hai đầu như pg_trgm
+// để chữ cái đầu từ có trọng số cao hơn
+func trigrams(folded string) map[string]bool {
+	grams := map[string]bool{}
+	for _, word := range strings.Fields(folded) {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			grams[string(runes[i:i+3])] = true
+		}
+	}
+	return grams
+}
+
+// ReplaceTitles thay toàn bộ chỉ mục bằng danh sách phim mới, tìm kiếm đang chạy vẫn dùng chỉ mục cũ
+func ReplaceTitles(movies []Title) {
+	entries := make([]fuzzyEntry, 0, len(movies)*2)
+	postings := map[string][]int{}
+	for _, movie := range movies {
+		seen := map[string]bool{}
+		for _, name := range []string{movie.Title, movie.NameEng} {
+			folded := Fold(name)
+			if folded == "" || seen[folded] {
+				continue
+			}
+			seen[folded] = true
+
+			grams := trigrams(folded)
+			for gram := range grams {
+				postings[gram] = append(postings[gram], len(entries))
+			}
+			entries = append(entries, fuzzyEntry{id: movie.ID, name: name, grams: len(grams)})
+		}
+	}
+
+	titles.mutex.Lock()
+	titles.entries, titles.postings = entries, postings
+	titles.mutex.Unlock()
+}
+
+// DidYouMean trả về tối đa DidYouMeanLimit tên phim gần giống từ khóa, mỗi phim một lần, giống nhất đứng đầu
+func DidYouMean(query string) []Match {
+	folded := Query(query)
+	if len([]rune(folded)) < fuzzyMinLength {
+		return nil
+	}
+	queryGrams := trigrams(folded)
+
+	titles.mutex.RLock()
+	defer titles.mutex.RUnlock()
+
+	shared := map[int]int{}
+	for gram := range queryGrams {
+		for _, entry := range titles.postings[gram] {
+			shared[entry]++
+		}
+	}
+
+	// Điểm chính: tỷ lệ trigram của từ khóa có trong tên. Khi bằng nhau, tên ngắn hơn (giống toàn bộ hơn) đứng trước
+	best := map[string]Match{}
+	similarity := map[string]float64{}
+	for entry, count := range shared {
+		score := float64(count) / float64(len(queryGrams))
+		if score < fuzzyThreshold {
+			continue
+		}
+		candidate := titles.entries[entry]
+		full := float64(count) / float64(len(queryGrams)+candidate.grams-count)
+		current, ok := best[candidate.id]
+		if !ok || score > current.Score || (score == current.Score && full > similarity[candidate.id]) {
+			best[candidate.id] = Match{ID: candidate.id, Title: candidate.name, Score: score}
+			similarity[candidate.id] = full
+		}
+	}
+
+	matches := make([]Match, 0, len(best))
+	for _, match := range best {
+		matches = append(matches, match)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if similarity[matches[i].ID] != similarity[matches[j].ID] {
+			return similarity[matches[i].ID] > similarity[matches[j].ID]
+		}
+		return matches[i].Title < matches[j].Title
+	})
+	if len(matches) > DidYouMeanLimit {
+		matches = matches[:DidYouMeanLimit]
+	}
+	return matches
+}
@@ -0,0 +1,49 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func matchTitles(matches []Match) []string {
+	result := make([]string, 0, len(matches))
+	for _, match := range matches {
+		result = append(result, match.Title)
+	}
+	return result
+}
+
+func TestDidYouMeanToleratesTypos(t *testing.T) {
+	ReplaceTitles([]Title{
+		{ID: "1", Title: "Người Nhện: Không Còn Nhà", NameEng: "Spider-Man: No Way Home"},
+		{ID: "2", Title: "Đảo Hải Tặc", NameEng: "One Piece"},
+		{ID: "3", Title: "Người Sắt", NameEng: "Iron Man"},
+	})
+	t.Cleanup(func() { ReplaceTitles(nil) })
+
+	// Phim gần giống nhất đứng đầu, phim chỉ trùng một từ vẫn có thể được gợi ý sau đó
+	assert.Equal(t, []string{"Người Nhện: Không Còn Nhà", "Người Sắt"}, matchTitles(DidYouMean("nguoi nhn")))
+	assert.Equal(t, []string{"Spider-Man: No Way Home"}, matchTitles(DidYouMean("spidr man")))
+	assert.Equal(t, []string{"Đảo Hải Tặc"}, matchTitles(DidYouMean("dao hai tac")))
+	assert.Equal(t, []string{"One Piece"}, matchTitles(DidYouMean("one pice")))
+}
+
+func TestDidYouMeanIgnoresShortOrUnrelatedQueries(t *testing.T) {
+	ReplaceTitles([]Title{{ID: "1", Title: "Đảo Hải Tặc"}})
+	t.Cleanup(func() { ReplaceTitles(nil) })
+
+	assert.Empty(t, DidYouMean("da"))
+	assert.Empty(t, DidYouMean("xyzzy"))
+}
+
+func TestReplaceTitlesDropsOldEntries(t *testing.T) {
+	ReplaceTitles([]Title{{ID: "1", Title: "Tây Du Ký"}})
+	ReplaceTitles([]Title{{ID: "2", Title: "Hồng Lâu Mộng"}})
+	t.Cleanup(func() { ReplaceTitles(nil) })
+
+	assert.Empty(t, DidYouMean("tay du ki"))
+	matches := DidYouMean("hong lau mong")
+	assert.Len(t, matches, 1)
+	assert.Equal(t, "2", matches[0].ID)
+}
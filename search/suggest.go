@@ -0,0 +1,363 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Chỉ mục gợi ý trong Redis:
+//   - mỗi tiền tố (tối đa suggestPrefixLength ký tự) của tên đã bỏ dấu, bắt đầu từ một từ, có một
+//     sorted set suggestPrefixKey: movie ID -> điểm xếp hạng, nên "nhen" khớp "nguoi nhen" và từ khóa
+//     ngắn vẫn lấy được phim nhiều lượt xem nhất
+//   - set suggestPrefixesKey: các tiền tố đã dùng, để xóa sorted set không còn phim khi dựng lại
+//   - hash suggestMoviesKey: movie ID -> Suggestion (JSON) để trả về và để xóa tiền tố cũ khi phim đổi tên
+const (
+	suggestPrefixesKey = "search:suggest:prefixes"
+	suggestMoviesKey   = "search:suggest:movies"
+)
+
+// Sorted set tìm theo ZRANGEBYLEX của định dạng cũ, bị xóa ở lần dựng lại đầu tiên
+const legacySuggestKey = "search:suggest"
+
+func suggestPrefixKey(prefix string) string {
+	return "search:suggest:prefix:" + prefix
+}
+
+// SuggestLimit là số gợi ý tối đa trả về cho một từ khóa
+const SuggestLimit = 10
+
+// Độ dài tối đa của tiền tố được đánh chỉ mục, từ khóa dài hơn được lọc lại trên kết quả của tiền tố này
+const suggestPrefixLength = 10
+
+// Điểm cộng cho phim có tên bắt đầu bằng tiền tố, lớn hơn mọi lượt xem để các phim này luôn xếp trước
+const suggestStartScore = 1e12
+
+// Số phim có điểm cao nhất đọc từ sorted set trước khi xếp hạng lại
+const suggestScan = 100
+
+// Số lần thử lại khi chỉ mục bị thay đổi trong lúc cập nhật một phim, mỗi lần chờ ngẫu nhiên
+// tối đa suggestRetryDelay nhân số lần đã thử để các lần cập nhật cùng lúc không va chạm lại
+const (
+	suggestMaxRetries = 10
+	suggestRetryDelay = 5 * time.Millisecond
+)
+
+// ErrSuggestStore được trả về khi chưa bật chỉ mục gợi ý
+var ErrSuggestStore = errors.New("suggestion store unavailable")
+
+var suggestStore *redis.Client
+
+// EnableSuggestions lưu chỉ mục gợi ý tìm kiếm trong Redis
+func EnableSuggestions(client *redis.Client) {
+	suggestStore = client
+}
+
+// Suggestion là thông tin một phim trong danh sách gợi ý
+type Suggestion struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	NameEng   string `json:"name_eng,omitempty"`
+	Slug      string `json:"slug"`
+	Year      int    `json:"year,omitempty"`
+	Thumbnail string `json:"thumbnail,omitempty"`
+	Views     int    `json:"views"`
+	Position  int    `json:"position"`
+}
+
+// suggestNames gọi fn với các tên đã bỏ dấu của phim, bắt đầu từ từng từ trong tên.
+// first cho biết tên bắt đầu từ từ đầu tiên, tức là chính tên phim
+func suggestNames(suggestion *Suggestion, fn func(name string, first bool)) {
+	for _, name := range []string{suggestion.Title, suggestion.NameEng} {
+		words := strings.Fields(Fold(name))
+		for i := range words {
+			fn(strings.Join(words[i:], " "), i == 0)
+		}
+	}
+}
+
+// suggestPrefixes tạo các tiền tố cần đánh chỉ mục của phim kèm điểm xếp hạng:
+// tên bắt đầu bằng tiền tố được cộng suggestStartScore, sau đó theo lượt xem
+func suggestPrefixes(suggestion *Suggestion) map[string]float64 {
+	prefixes := map[string]float64{}
+	suggestNames(suggestion, func(name string, first bool) {
+		score := float64(suggestion.Views)
+		if first {
+			score += suggestStartScore
+		}
+		runes := []rune(name)
+		for length := 1; length <= len(runes) && length <= suggestPrefixLength; length++ {
+			// Từ khóa đã được bỏ khoảng trắng ở cuối nên không cần tiền tố kết thúc bằng khoảng trắng
+			if runes[length-1] == ' ' {
+				continue
+			}
+			prefix := string(runes[:length])
+			if current, ok := prefixes[prefix]; !ok || score > current {
+				prefixes[prefix] = score
+			}
+		}
+	})
+	return prefixes
+}
+
+// hasPrefix cho biết phim có tên (hoặc một từ trong tên) bắt đầu bằng prefix
+func hasPrefix(suggestion *Suggestion, prefix string) bool {
+	found := false
+	suggestNames(suggestion, func(name string, first bool) {
+		found = found || strings.HasPrefix(name, prefix)
+	})
+	return found
+}
+
+// storedSuggestion đọc gợi ý đang lưu của phim, nil nếu phim chưa có trong chỉ mục
+func storedSuggestion(ctx context.Context, client redis.Cmdable, movieID string) (*Suggestion, error) {
+	data, err := client.HGet(ctx, suggestMoviesKey, movieID).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var suggestion Suggestion
+	if err := json.Unmarshal(data, &suggestion); err != nil {
+		return nil, nil
+	}
+	return &suggestion, nil
+}
+
+// removePrefixes xóa phim khỏi các tiền tố của gợi ý cũ trong pipeline.
+// Sorted set hết phần tử thì Redis tự xóa, tiền tố vẫn nằm trong suggestPrefixesKey đến lần dựng lại sau
+func removePrefixes(ctx context.Context, pipe redis.Pipeliner, previous *Suggestion) {
+	if previous == nil {
+		return
+	}
+	for prefix := range suggestPrefixes(previous) {
+		pipe.ZRem(ctx, suggestPrefixKey(prefix), previous.ID)
+	}
+}
+
+// addPrefixes thêm phim vào sorted set của từng tiền tố, tên key có thêm suffix khi dựng lại.
+// Trả về các tiền tố đã thêm, rỗng nếu phim không có tên nào để tìm
+func addPrefixes(ctx context.Context, pipe redis.Pipeliner, suffix string, suggestion *Suggestion) map[string]float64 {
+	prefixes := suggestPrefixes(suggestion)
+	if len(prefixes) == 0 {
+		return prefixes
+	}
+
+	members := make([]interface{}, 0, len(prefixes))
+	for prefix, score := range prefixes {
+		pipe.ZAdd(ctx, suggestPrefixKey(prefix)+suffix, &redis.Z{Score: score, Member: suggestion.ID})
+		members = append(members, prefix)
+	}
+	pipe.SAdd(ctx, suggestPrefixesKey+suffix, members...)
+	return prefixes
+}
+
+// updateSuggestion xóa tiền tố của gợi ý đang lưu rồi ghi thay đổi trong cùng transaction.
+// Hash phim được WATCH để hai lần cập nhật cùng lúc không để lại tiền tố của tên cũ, bị ghi đè thì thử lại
+func updateSuggestion(ctx context.Context, movieID string, update func(pipe redis.Pipeliner)) error {
+	for attempt := 0; attempt < suggestMaxRetries; attempt++ {
+		err := suggestStore.Watch(ctx, func(tx *redis.Tx) error {
+			previous, err := storedSuggestion(ctx, tx, movieID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				removePrefixes(ctx, pipe, previous)
+				update(pipe)
+				return nil
+			})
+			return err
+		}, suggestMoviesKey)
+		if err != redis.TxFailedErr {
+			return err
+		}
+		time.Sleep(time.Duration(rand.Int63n(int64(suggestRetryDelay) * int64(attempt+1))))
+	}
+	return redis.TxFailedErr
+}
+
+// IndexSuggestion thêm hoặc cập nhật phim trong chỉ mục gợi ý, tên cũ của phim bị xóa khỏi chỉ mục
+func IndexSuggestion(ctx context.Context, suggestion *Suggestion) error {
+	if suggestStore == nil {
+		return ErrSuggestStore
+	}
+
+	data, err := json.Marshal(suggestion)
+	if err != nil {
+		return err
+	}
+
+	return updateSuggestion(ctx, suggestion.ID, func(pipe redis.Pipeliner) {
+		addPrefixes(ctx, pipe, "", suggestion)
+		pipe.HSet(ctx, suggestMoviesKey, suggestion.ID, data)
+	})
+}
+
+// RemoveSuggestion xóa phim khỏi chỉ mục gợi ý (phim bị xóa hoặc ngừng hoạt động)
+func RemoveSuggestion(ctx context.Context, movieID string) error {
+	if suggestStore == nil {
+		return ErrSuggestStore
+	}
+
+	return updateSuggestion(ctx, movieID, func(pipe redis.Pipeliner) {
+		pipe.HDel(ctx, suggestMoviesKey, movieID)
+	})
+}
+
+// SuggestionsBuilt cho biết chỉ mục gợi ý đã có dữ liệu, dùng khi khởi động để dựng lần đầu.
+// Kiểm tra set tiền tố để chỉ mục theo định dạng cũ (chỉ có legacySuggestKey) cũng được dựng lại
+func SuggestionsBuilt(ctx context.Context) (bool, error) {
+	if suggestStore == nil {
+		return false, ErrSuggestStore
+	}
+	count, err := suggestStore.Exists(ctx, suggestPrefixesKey).Result()
+	return count > 0, err
+}
+
+// RebuildSuggestions dựng lại chỉ mục từ đầu vào key tạm rồi đổi tên, người dùng không thấy chỉ mục dở dang.
+// Thay đổi phim xảy ra trong lúc dựng lại có thể bị ghi đè, cần dựng lại lần nữa nếu nghi ngờ
+func RebuildSuggestions(ctx context.Context, suggestions []*Suggestion) error {
+	if suggestStore == nil {
+		return ErrSuggestStore
+	}
+
+	suffix := ":rebuild:" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	tempMoviesKey := suggestMoviesKey + suffix
+	prefixes := map[string]bool{}
+
+	// Ghi theo từng lô để mỗi pipeline không quá lớn
+	const batchSize = 500
+	for start := 0; start < len(suggestions); start += batchSize {
+		end := start + batchSize
+		if end > len(suggestions) {
+			end = len(suggestions)
+		}
+
+		pipe := suggestStore.Pipeline()
+		for _, suggestion := range suggestions[start:end] {
+			data, err := json.Marshal(suggestion)
+			if err != nil {
+				discardRebuild(ctx, suffix, prefixes)
+				return err
+			}
+			for prefix := range addPrefixes(ctx, pipe, suffix, suggestion) {
+				prefixes[prefix] = true
+			}
+			pipe.HSet(ctx, tempMoviesKey, suggestion.ID, data)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			discardRebuild(ctx, suffix, prefixes)
+			return err
+		}
+	}
+
+	previous, err := suggestStore.SMembers(ctx, suggestPrefixesKey).Result()
+	if err != nil {
+		discardRebuild(ctx, suffix, prefixes)
+		return err
+	}
+
+	pipe := suggestStore.TxPipeline()
+	for prefix := range prefixes {
+		pipe.Rename(ctx, suggestPrefixKey(prefix)+suffix, suggestPrefixKey(prefix))
+	}
+	for _, prefix := range previous {
+		if !prefixes[prefix] {
+			pipe.Del(ctx, suggestPrefixKey(prefix))
+		}
+	}
+	// Không phim nào có tên để tìm thì key tạm không tồn tại, RENAME sẽ lỗi
+	if len(prefixes) > 0 {
+		pipe.Rename(ctx, suggestPrefixesKey+suffix, suggestPrefixesKey)
+	} else {
+		pipe.Del(ctx, suggestPrefixesKey)
+	}
+	if len(suggestions) > 0 {
+		pipe.Rename(ctx, tempMoviesKey, suggestMoviesKey)
+	} else {
+		pipe.Del(ctx, suggestMoviesKey)
+	}
+	pipe.Del(ctx, legacySuggestKey)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// discardRebuild xóa các key tạm của một lần dựng lại bị lỗi
+func discardRebuild(ctx context.Context, suffix string, prefixes map[string]bool) {
+	keys := []string{suggestPrefixesKey + suffix, suggestMoviesKey + suffix}
+	for prefix := range prefixes {
+		keys = append(keys, suggestPrefixKey(prefix)+suffix)
+	}
+	suggestStore.Del(ctx, keys...)
+}
+
+// Suggest trả về tối đa SuggestLimit phim có tên (hoặc một từ trong tên) bắt đầu bằng query.
+// Phim có tên bắt đầu bằng query xếp trước, sau đó theo lượt xem
+func Suggest(ctx context.Context, query string) ([]*Suggestion, error) {
+	if suggestStore == nil {
+		return nil, ErrSuggestStore
+	}
+
+	prefix := Query(query)
+	if prefix == "" {
+		return []*Suggestion{}, nil
+	}
+
+	// Từ khóa dài hơn tiền tố được đánh chỉ mục thì đọc tiền tố đầu rồi lọc lại theo cả từ khóa
+	indexed := prefix
+	if runes := []rune(prefix); len(runes) > suggestPrefixLength {
+		indexed = string(runes[:suggestPrefixLength])
+	}
+
+	ids, err := suggestStore.ZRevRange(ctx, suggestPrefixKey(indexed), 0, suggestScan-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*Suggestion{}, nil
+	}
+
+	values, err := suggestStore.HMGet(ctx, suggestMoviesKey, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]*Suggestion, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var suggestion Suggestion
+		if err := json.Unmarshal([]byte(data), &suggestion); err == nil && hasPrefix(&suggestion, prefix) {
+			suggestions = append(suggestions, &suggestion)
+		}
+	}
+
+	startsWith := func(suggestion *Suggestion) bool {
+		return strings.HasPrefix(Fold(suggestion.Title), prefix) || strings.HasPrefix(Fold(suggestion.NameEng), prefix)
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if first, second := startsWith(suggestions[i]), startsWith(suggestions[j]); first != second {
+			return first
+		}
+		if suggestions[i].Views != suggestions[j].Views {
+			return suggestions[i].Views > suggestions[j].Views
+		}
+		return suggestions[i].Position < suggestions[j].Position
+	})
+
+	if len(suggestions) > SuggestLimit {
+		suggestions = suggestions[:SuggestLimit]
+	}
+	return suggestions, nil
+}
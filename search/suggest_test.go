@@ -0,0 +1,151 @@
+package search
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSuggestions(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	EnableSuggestions(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	t.Cleanup(func() { suggestStore = nil })
+	return mr
+}
+
+func suggestionIDs(suggestions []*Suggestion) []string {
+	ids := make([]string, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		ids = append(ids, suggestion.ID)
+	}
+	return ids
+}
+
+func TestSuggestMatchesAnyWordWithoutAccents(t *testing.T) {
+	setupSuggestions(t)
+	ctx := context.Background()
+
+	assert.NoError(t, IndexSuggestion(ctx, &Suggestion{ID: "1", Title: "Người Nhện: Không Còn Nhà", NameEng: "Spider-Man: No Way Home", Views: 10}))
+	assert.NoError(t, IndexSuggestion(ctx, &Suggestion{ID: "2", Title: "Nhện Độc", Views: 5}))
+	assert.NoError(t, IndexSuggestion(ctx, &Suggestion{ID: "3", Title: "Đảo Hải Tặc"}))
+
+	suggestions, err := Suggest(ctx, "Nhen")
+	assert.NoError(t, err)
+	// Phim có tên bắt đầu bằng từ khóa xếp trước phim nhiều lượt xem hơn
+	assert.Equal(t, []string{"2", "1"}, suggestionIDs(suggestions))
+
+	suggestions, err = Suggest(ctx, "spider")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, suggestionIDs(suggestions))
+
+	suggestions, err = Suggest(ctx, "đảo h")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3"}, suggestionIDs(suggestions))
+
+	suggestions, err = Suggest(ctx, "  ")
+	assert.NoError(t, err)
+	assert.Empty(t, suggestions)
+}
+
+func TestIndexSuggestionReplacesOldNames(t *testing.T) {
+	mr := setupSuggestions(t)
+	ctx := context.Background()
+
+	assert.NoError(t, IndexSuggestion(ctx, &Suggestion{ID: "1", Title: "Tên Cũ"}))
+	assert.NoError(t, IndexSuggestion(ctx, &Suggestion{ID: "1", Title: "Tên Mới"}))
+
+	suggestions, err := Suggest(ctx, "cu")
+	assert.NoError(t, err)
+	assert.Empty(t, suggestions)
+	suggestions, err = Suggest(ctx, "moi")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, suggestionIDs(suggestions))
+
+	assert.NoError(t, RemoveSuggestion(ctx, "1"))
+	assert.Equal(t, []string{suggestPrefixesKey}, mr.Keys())
+}
+
+func TestRebuildSuggestionsReplacesIndex(t *testing.T) {
+	mr := setupSuggestions(t)
+	ctx := context.Background()
+
+	assert.NoError(t, IndexSuggestion(ctx, &Suggestion{ID: "stale", Title: "Phim Cũ"}))
+	_, err := mr.ZAdd(legacySuggestKey, 0, "phim cu\x00stale")
+	assert.NoError(t, err)
+	assert.NoError(t, RebuildSuggestions(ctx, []*Suggestion{{ID: "1", Title: "Tây Du Ký"}}))
+
+	suggestions, err := Suggest(ctx, "phim")
+	assert.NoError(t, err)
+	assert.Empty(t, suggestions)
+	suggestions, err = Suggest(ctx, "du ky")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, suggestionIDs(suggestions))
+	assert.False(t, mr.Exists(suggestPrefixKey("phim")))
+	assert.False(t, mr.Exists(legacySuggestKey))
+	for _, key := range mr.Keys() {
+		assert.NotContains(t, key, ":rebuild:")
+	}
+
+	assert.NoError(t, RebuildSuggestions(ctx, nil))
+	assert.Empty(t, mr.Keys())
+}
+
+func TestSuggestRanksPopularMoviesForShortPrefixes(t *testing.T) {
+	setupSuggestions(t)
+	ctx := context.Background()
+
+	// Nhiều phim ít lượt xem đứng trước phim phổ biến theo thứ tự chữ cái
+	for i := 0; i < 2*suggestScan; i++ {
+		id := strconv.Itoa(i)
+		assert.NoError(t, IndexSuggestion(ctx, &Suggestion{ID: id, Title: "Anh " + id, Views: 1}))
+	}
+	assert.NoError(t, IndexSuggestion(ctx, &Suggestion{ID: "avatar", Title: "Avatar", Views: 1000}))
+	assert.NoError(t, IndexSuggestion(ctx, &Suggestion{ID: "iron", Title: "Người Sắt", NameEng: "Iron Man: Armored", Views: 5000}))
+
+	suggestions, err := Suggest(ctx, "a")
+	assert.NoError(t, err)
+	assert.Len(t, suggestions, SuggestLimit)
+	assert.Equal(t, "avatar", suggestions[0].ID)
+	assert.NotContains(t, suggestionIDs(suggestions), "iron")
+
+	// Từ khóa dài hơn tiền tố được đánh chỉ mục vẫn lọc đúng theo cả từ khóa
+	suggestions, err = Suggest(ctx, "iron man armored")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"iron"}, suggestionIDs(suggestions))
+	suggestions, err = Suggest(ctx, "iron man armoured")
+	assert.NoError(t, err)
+	assert.Empty(t, suggestions)
+}
+
+func TestConcurrentIndexSuggestionLeavesNoStaleNames(t *testing.T) {
+	mr := setupSuggestions(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, IndexSuggestion(ctx, &Suggestion{ID: "1", Title: "Tên" + strconv.Itoa(i)}))
+		}(i)
+	}
+	wg.Wait()
+
+	// Chỉ tên được ghi sau cùng còn trong chỉ mục
+	stored, err := storedSuggestion(ctx, suggestStore, "1")
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		title := "Tên" + strconv.Itoa(i)
+		members, _ := mr.ZMembers(suggestPrefixKey(Fold(title)))
+		if title == stored.Title {
+			assert.Equal(t, []string{"1"}, members)
+		} else {
+			assert.Empty(t, members, title)
+		}
+	}
+}
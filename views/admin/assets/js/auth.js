@@ -16,7 +16,7 @@ $(document).ready(function() {
         contentType: 'application/json',
         data: JSON.stringify(formData),
         success: function(response) {
-            showSuccessToast('Register successfully!');
+            showSuccessToast('Register successfully! Please check your email to verify your account.');
             // Đặt độ trễ 2 giây trước khi chuyển hướng
             setTimeout(function() {
                 window.location.href = '/auth/login'; // Chuyển hướng tới trang đăng nhập
@@ -59,6 +59,91 @@ $(document).ready(function() {
         });
     }
   
+    // Lưu token và chuyển trang sau khi đăng nhập hoàn tất
+    function handleLoginSuccess(response) {
+        console.log("Token received:", response.token);
+        console.log("User id:", response.user_id);
+        // Lưu token vào localStorage
+        localStorage.setItem('token', response.token);
+  
+        showSuccessToast('Login successfully!');
+        // Kiểm tra vai trò người dùng
+        if (response.role === 'admin') {
+            // Đặt độ trễ 2 giây rồi gọi loadAdminDashboard để kiểm tra quyền truy cập
+            setTimeout(function() {
+                loadAdminDashboard(); // Gọi hàm để chuyển đến trang admin
+            }, 2000); // 2000 milliseconds = 2 giây
+        } else {
+            // Chuyển hướng đến trang /home nếu không phải admin
+            setTimeout(function() {
+                // Truyền user_id qua query string
+                window.location.href = `/home?user_id=${response.user_id}`;
+            }, 10000);
+        }
+    }
+
+    // Bước thứ hai: nhập mã từ ứng dụng xác thực (hoặc recovery code)
+    function verifyTwoFactor(preAuthToken) {
+        const code = prompt('Enter the 6-digit code from your authenticator app (or a recovery code):');
+        if (!code) {
+            return;
+        }
+        const data = { pre_auth_token: preAuthToken };
+        if (/^\d{6}$/.test(code.trim())) {
+            data.code = code.trim();
+        } else {
+            data.recovery_code = code.trim();
+        }
+
+        $.ajax({
+            url: '/auth/login/2fa',
+            type: 'POST',
+            contentType: 'application/json',
+            data: JSON.stringify(data),
+            success: handleLoginSuccess,
+            error: function(xhr) {
+                showErrorToast(xhr.responseJSON.error || 'Login failed!');
+                if (xhr.status === 401 && xhr.responseJSON.error === 'Invalid two-factor code') {
+                    verifyTwoFactor(preAuthToken);
+                }
+            }
+        });
+    }
+
+    // Vai trò bắt buộc 2FA nhưng tài khoản chưa đăng ký: đăng ký TOTP bằng pre-auth token rồi đăng nhập lại
+    function enrollTwoFactor(preAuthToken) {
+        const headers = { 'X-Pre-Auth-Token': preAuthToken };
+        $.ajax({
+            url: '/auth/2fa/setup',
+            type: 'POST',
+            headers: headers,
+            success: function(setup) {
+                const code = prompt('Two-factor authentication is required. Add this key to your authenticator app:\n\n'
+                    + setup.secret + '\n\n(' + setup.provisioning_uri + ')\n\nThen enter the 6-digit code:');
+                if (!code) {
+                    return;
+                }
+                $.ajax({
+                    url: '/auth/2fa/enable',
+                    type: 'POST',
+                    headers: headers,
+                    contentType: 'application/json',
+                    data: JSON.stringify({ code: code.trim() }),
+                    success: function(response) {
+                        alert('Save these recovery codes, each can be used once:\n\n' + response.recovery_codes.join('\n'));
+                        showSuccessToast('Two-factor authentication enabled, please sign in again');
+                    },
+                    error: function(xhr) {
+                        showErrorToast(xhr.responseJSON.error || 'Failed to enable two-factor authentication');
+                    }
+                });
+            },
+            error: function(xhr) {
+                showErrorToast(xhr.responseJSON.error || 'Failed to set up two-factor authentication');
+            }
+        });
+    }
+
     // Xử lý sự kiện khi form đăng nhập được submit
     $('#login-form').submit(function(event) {
         event.preventDefault(); // Ngăn chặn form tự submit
@@ -76,27 +161,17 @@ $(document).ready(function() {
             contentType: 'application/json',
             data: JSON.stringify(formData),
             success: function(response) {
-                console.log("Token received:", response.token);
-                console.log("User id:", response.user_id);
-                // Lưu token vào localStorage
-                localStorage.setItem('token', response.token);
-  
-                showSuccessToast('Login successfully!');
-                // Kiểm tra vai trò người dùng
-                if (response.role === 'admin') {
-                    // Đặt độ trễ 2 giây rồi gọi loadAdminDashboard để kiểm tra quyền truy cập
-                    setTimeout(function() {
-                        loadAdminDashboard(); // Gọi hàm để chuyển đến trang admin
-                    }, 2000); // 2000 milliseconds = 2 giây
-                } else {
-                    // Chuyển hướng đến trang /home nếu không phải admin
-                    setTimeout(function() {
-                        // Truyền user_id qua query string
-                        window.location.href = `/home?user_id=${response.user_id}`;
-                    }, 10000);
+                if (response.two_factor_required) {
+                    verifyTwoFactor(response.pre_auth_token);
+                    return;
                 }
+                handleLoginSuccess(response);
             },
             error: function(xhr, status, error) {
+                if (xhr.responseJSON && xhr.responseJSON.two_factor_setup_required) {
+                    enrollTwoFactor(xhr.responseJSON.pre_auth_token);
+                    return;
+                }
                 const errorMessage = xhr.responseJSON.error || 'Login failed!';
                 showErrorToast(errorMessage);
             }            
@@ -105,6 +180,52 @@ $(document).ready(function() {
   });
   
 
+// Quên mật khẩu và đặt lại mật khẩu qua liên kết gửi trong email
+$(document).ready(function() {
+    $('#forgot-form').submit(function(event) {
+        event.preventDefault();
+
+        $.ajax({
+            url: '/auth/forgot',
+            type: 'POST',
+            contentType: 'application/json',
+            data: JSON.stringify({ email: $('input[name="email"]').val() }),
+            success: function(response) {
+                showSuccessToast(response.message);
+            },
+            error: function(xhr) {
+                showErrorToast(xhr.responseJSON.error || 'Request failed!');
+            }
+        });
+    });
+
+    $('#reset-form').submit(function(event) {
+        event.preventDefault();
+
+        const password = $('input[name="password"]').val();
+        if (password !== $('input[name="confirm_password"]').val()) {
+            showErrorToast('Passwords do not match');
+            return;
+        }
+
+        $.ajax({
+            url: '/auth/reset',
+            type: 'POST',
+            contentType: 'application/json',
+            data: JSON.stringify({ token: $('input[name="token"]').val(), password: password }),
+            success: function(response) {
+                showSuccessToast(response.message);
+                setTimeout(function() {
+                    window.location.href = '/auth/login';
+                }, 2000);
+            },
+            error: function(xhr) {
+                showErrorToast(xhr.responseJSON.message || xhr.responseJSON.error || 'Reset failed!');
+            }
+        });
+    });
+});
+
 // // Log toàn bộ nội dung localStorage
 // console.log("Current localStorage data:", localStorage);
 
@@ -734,41 +734,92 @@ $(document).ready(function() {
 });
 
 // <!-- Hien thi bang websocket -->
-// Kết nối WebSocket
-let socket = new WebSocket("ws://localhost:8080/ws");
+// Phiên bản sự kiện mà trang này hiểu được
+const EVENT_VERSION = 1;
 
-socket.onmessage = function(event) {
-	// Khi nhận được thông báo từ server qua WebSocket
-	let message = event.data;
-	// console.log("Received message:", message);
+// Kết nối WebSocket, tự kết nối lại và yêu cầu phát lại các sự kiện đã lỡ
+let socket;
+let lastSeq = 0; // Số thứ tự của sự kiện cuối cùng đã nhận
 
-	try {
-		// Parse message thành JSON object
-		let data = JSON.parse(message);
-
-		// Kiểm tra loại thông báo (movie hoặc episode)
-		if (data.type === "movie") {
-			console.log("Movie update detected");
-			updateMoviesSocket(data.movies); // Cập nhật danh sách movies
-		} else if (data.type === "episode") {
-			console.log("Episode update detected, movie ID:", data.movieID);
-			updateEpisodes(data.movieID); // Cập nhật danh sách episodes cho movie tương ứng
-		} else if (data.type === "quality") {
-            console.log("Quality update detected, movie ID:", data.movieID, "episode ID:", data.episodeID, "server ID:", data.serverID);
-            updateQualities(data.movieID, data.episodeID, data.serverID); // Cập nhật danh sách qualities cho episode và server tương ứng
-		}
-	} catch (error) {
-		console.error("Error parsing message:", error);
+function connectSocket() {
+	let url = "ws://localhost:8080/ws?topics=admin:catalog,admin:security";
+	if (lastSeq > 0) {
+		url += "&resume_from=" + lastSeq;
 	}
-};
-// Hàm updateMoviesSocket chỉ được gọi khi có cập nhật từ WebSocket
-function updateMoviesSocket(movies) {
-	let moviesList = document.getElementById('movies-list');
-	moviesList.innerHTML = ""; // Xóa danh sách cũ
+	socket = new WebSocket(url);
 
-	movies.forEach(movie => {
-		addMovieRow(movie); // Hàm tạo và thêm hàng cho từng phim
-	});
+	socket.onmessage = function(event) {
+		// Khi nhận được thông báo từ server qua WebSocket
+		let message = event.data;
+		// console.log("Received message:", message);
+
+		try {
+			// Parse message thành JSON object
+			let frame = JSON.parse(message);
+
+			// Server không còn giữ đủ sự kiện để phát lại, tải lại toàn bộ danh sách
+			if (frame.type === "resync") {
+				updateMoviesSocket();
+				return;
+			}
+			if (frame.seq === undefined) {
+				return; // Phản hồi subscribe/unsubscribe
+			}
+			lastSeq = frame.seq;
+			let data = frame.data;
+
+			// Sự kiện theo schema /admin/assets/js/events.schema.json, phiên bản khác thì tải lại toàn bộ
+			if (data.version !== EVENT_VERSION) {
+				updateMoviesSocket();
+				return;
+			}
+
+			// Kiểm tra loại bản ghi đã thay đổi (movie, episode hoặc quality)
+			if (data.entity === "movie") {
+				console.log("Movie " + data.action + ", movie ID:", data.id);
+				updateMoviesSocket(); // Tải lại danh sách movies
+			} else if (data.entity === "episode") {
+				console.log("Episode " + data.action + ", movie ID:", data.movie_id);
+				updateEpisodes(data.movie_id); // Cập nhật danh sách episodes cho movie tương ứng
+			} else if (data.entity === "quality") {
+				console.log("Quality " + data.action + ", movie ID:", data.movie_id, "episode ID:", data.episode_id, "server ID:", data.server_id);
+				updateQualities(data.movie_id, data.episode_id, data.server_id); // Cập nhật danh sách qualities cho episode và server tương ứng
+			} else if (data.entity === "user" && data.action === "locked") {
+				// Tài khoản quản trị bị khóa tạm thời vì đăng nhập sai nhiều lần
+				showErrorToast("Account " + data.email + " locked after " + data.failures + " failed logins from " + data.ip + " until " + new Date(data.locked_until).toLocaleTimeString());
+			}
+		} catch (error) {
+			console.error("Error parsing message:", error);
+		}
+	};
+
+	socket.onclose = function() {
+		// Thử kết nối lại sau 2 giây
+		setTimeout(connectSocket, 2000);
+	};
+}
+
+connectSocket();
+// Hàm updateMoviesSocket chỉ được gọi khi có cập nhật từ WebSocket.
+// Sự kiện không còn chứa danh sách phim nên tải lại từ server, gom nhiều sự kiện liên tiếp thành một lần tải.
+let moviesRefreshTimer = null;
+function updateMoviesSocket() {
+	clearTimeout(moviesRefreshTimer);
+	moviesRefreshTimer = setTimeout(function() {
+		fetch('/admin/movies' + queryString)
+			.then(response => response.json())
+			.then(data => {
+				let moviesList = document.getElementById('movies-list');
+				moviesList.innerHTML = ""; // Xóa danh sách cũ
+
+				data.movies.forEach(movie => {
+					addMovieRow(movie); // Hàm tạo và thêm hàng cho từng phim
+				});
+			})
+			.catch(err => {
+				console.error("Failed to fetch movies:", err);
+			});
+	}, 300);
 }
 let queryString = window.location.search;
 console.log(queryString);
@@ -140,4 +140,56 @@ function activeLink() {
     this.classList.add('active')
 }
 
-list.forEach((item) => item.addEventListener('click', activeLink))
\ No newline at end of file
+list.forEach((item) => item.addEventListener('click', activeLink))
+
+// SEARCH SUGGEST
+
+let searchInput = document.querySelector('.nav-search')
+let suggestTimer = null
+
+let suggestList = document.createElement('ul')
+suggestList.className = 'search-suggest'
+if (searchInput) searchInput.closest('.search-box').appendChild(suggestList)
+
+let renderSuggestions = (suggestions) => {
+    suggestList.innerHTML = ''
+    suggestions.forEach((suggestion) => {
+        let item = document.createElement('li')
+        let link = document.createElement('a')
+        link.href = `/movie/${suggestion.id}`
+        if (suggestion.thumbnail) {
+            let img = document.createElement('img')
+            img.src = suggestion.thumbnail
+            img.alt = ''
+            link.appendChild(img)
+        }
+        let title = document.createElement('span')
+        title.textContent = suggestion.year ? `${suggestion.title} (${suggestion.year})` : suggestion.title
+        link.appendChild(title)
+        item.appendChild(link)
+        suggestList.appendChild(item)
+    })
+    suggestList.classList.toggle('active', suggestions.length > 0)
+}
+
+if (searchInput) {
+    searchInput.setAttribute('autocomplete', 'off')
+    searchInput.addEventListener('input', () => {
+        clearTimeout(suggestTimer)
+        let q = searchInput.value.trim()
+        if (!q) {
+            renderSuggestions([])
+            return
+        }
+        // Chờ người dùng ngừng gõ một chút rồi mới gọi API
+        suggestTimer = setTimeout(() => {
+            fetch(`/search/suggest?q=${encodeURIComponent(q)}`)
+                .then((response) => response.json())
+                .then((data) => {
+                    if (searchInput.value.trim() === q) renderSuggestions(data.suggestions || [])
+                })
+                .catch(() => renderSuggestions([]))
+        }, 150)
+    })
+    searchInput.addEventListener('blur', () => setTimeout(() => renderSuggestions([]), 200))
+}
@@ -0,0 +1,170 @@
+// Xem chung (watch party): đồng bộ phát phim giữa các thành viên qua WebSocket /ws.
+//
+// player là đối tượng điều khiển trình phát của trang, cần có:
+//   currentTime() -> số giây hiện tại, seek(giây), play(), pause(), setQuality(qualityId)
+// Ví dụ:
+//   const party = new WatchParty(player, { onState: renderRoom, onError: showErrorToast });
+//   party.connect().then(() => party.create(movieId, episodeId, qualityId));
+//   party.connect().then(() => party.join("ABC234"));
+
+const WATCH_PARTY_SYNC_INTERVAL = 5000;  // Host gửi vị trí hiện tại mỗi 5 giây
+const WATCH_PARTY_CHECK_INTERVAL = 2000; // Thành viên kiểm tra độ lệch mỗi 2 giây
+const WATCH_PARTY_MAX_DRIFT = 0.5;       // Lệch quá 0.5 giây thì tua lại
+
+class WatchParty {
+    constructor(player, options = {}) {
+        this.player = player;
+        this.onState = options.onState || function() {};
+        this.onMember = options.onMember || function() {};
+        this.onError = options.onError || console.error;
+        this.userId = options.userId || "";
+        this.room = null;
+        this.clockOffset = 0; // Đồng hồ server - đồng hồ trình duyệt (mili giây)
+        this.timers = [];
+    }
+
+    // Mở kết nối và đo độ lệch đồng hồ với server trước khi tạo hoặc tham gia phòng
+    connect() {
+        return new Promise((resolve, reject) => {
+            this.socket = new WebSocket(`ws://${window.location.host}/ws`);
+            this.socket.onmessage = (event) => this.handleMessage(JSON.parse(event.data));
+            this.socket.onerror = reject;
+            this.socket.onopen = () => {
+                this.syncClock();
+                resolve();
+            };
+            this.socket.onclose = () => this.stopTimers();
+        });
+    }
+
+    create(movieId, episodeId, qualityId) {
+        this.send({ action: "room.create", movie_id: movieId, episode_id: episodeId, quality_id: qualityId });
+    }
+
+    join(code) {
+        this.send({ action: "room.join", room: code.trim().toUpperCase() });
+    }
+
+    leave() {
+        this.send({ action: "room.leave" });
+        this.room = null;
+        this.stopTimers();
+    }
+
+    // Các lệnh dưới đây chỉ có tác dụng với host, server trả lỗi cho thành viên khác
+    play() {
+        this.command("play");
+    }
+
+    pause() {
+        this.command("pause");
+    }
+
+    seek(position) {
+        this.command("seek", { position: position });
+    }
+
+    switchQuality(qualityId) {
+        this.command("quality", { quality_id: qualityId });
+    }
+
+    isHost() {
+        return this.room !== null && this.room.host_id === this.userId;
+    }
+
+    command(name, extra = {}) {
+        this.send(Object.assign({
+            action: "room.command",
+            command: name,
+            position: this.player.currentTime(),
+        }, extra));
+    }
+
+    send(frame) {
+        frame.client_time = Date.now();
+        this.socket.send(JSON.stringify(frame));
+    }
+
+    // Ước lượng độ lệch đồng hồ theo kiểu NTP: giả sử thời gian đi và về bằng nhau
+    syncClock() {
+        this.send({ action: "room.time" });
+    }
+
+    serverNow() {
+        return Date.now() + this.clockOffset;
+    }
+
+    // Vị trí mà mọi thành viên nên đang ở, tính từ lệnh cuối cùng của host
+    expectedPosition() {
+        if (!this.room) {
+            return 0;
+        }
+        if (!this.room.playing) {
+            return this.room.position;
+        }
+        return this.room.position + (this.serverNow() - this.room.server_time) / 1000;
+    }
+
+    handleMessage(message) {
+        switch (message.type) {
+            case "room.time": {
+                const now = Date.now();
+                const roundTrip = now - message.client_time;
+                this.clockOffset = message.server_time - (message.client_time + roundTrip / 2);
+                break;
+            }
+            case "room.joined":
+            case "room.state":
+                this.applyState(message.room, message.command);
+                break;
+            case "room.member":
+                this.onMember(message.user_id, message.action);
+                break;
+            case "error":
+                this.onError(message.message);
+                break;
+        }
+    }
+
+    applyState(room, command) {
+        const qualityChanged = this.room && this.room.quality_id !== room.quality_id;
+        this.room = room;
+
+        if (qualityChanged) {
+            this.player.setQuality(room.quality_id);
+        }
+        if (!this.isHost() || command === undefined) {
+            this.player.seek(this.expectedPosition());
+            room.playing ? this.player.play() : this.player.pause();
+        }
+
+        this.onState(room);
+        this.startTimers();
+    }
+
+    startTimers() {
+        this.stopTimers();
+
+        if (this.isHost()) {
+            // Host là mốc thời gian: gửi vị trí định kỳ để thành viên bù lệch
+            this.timers.push(setInterval(() => {
+                if (this.room.playing) {
+                    this.command("sync");
+                }
+            }, WATCH_PARTY_SYNC_INTERVAL));
+            return;
+        }
+
+        this.timers.push(setInterval(() => {
+            const drift = this.player.currentTime() - this.expectedPosition();
+            if (Math.abs(drift) > WATCH_PARTY_MAX_DRIFT) {
+                this.player.seek(this.expectedPosition());
+            }
+        }, WATCH_PARTY_CHECK_INTERVAL));
+    }
+
+    stopTimers() {
+        this.timers.forEach(timer => clearInterval(timer));
+        this.timers = [];
+    }
+}
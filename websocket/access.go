@@ -0,0 +1,60 @@
+package websocket
+
+import (
+	middleware "fire-watch/auth"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Tiền tố của các topic chỉ dành cho admin, ví dụ danh sách phim đầy đủ
+const adminTopicPrefix = "admin:"
+
+// canSubscribe chỉ cho vai trò có quyền quản trị (được vào trang admin) đăng ký các topic admin
+func canSubscribe(client *Client, topic string) bool {
+	if !strings.HasPrefix(topic, adminTopicPrefix) {
+		return true
+	}
+
+	staff, err := middleware.IsStaff(client.Role)
+	if err != nil {
+		log.Println("Error loading role permissions:", err)
+	}
+	return staff
+}
+
+// parseAllowedOrigins đọc danh sách origin phân tách bằng dấu phẩy
+func parseAllowedOrigins(value string) []string {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			origins = append(origins, strings.ToLower(origin))
+		}
+	}
+	return origins
+}
+
+// checkOrigin chỉ chấp nhận origin trong AllowedOrigins,
+// hoặc cùng host với request nếu chưa cấu hình danh sách
+func (server *WebSocketServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Client không phải trình duyệt không gửi Origin
+		return true
+	}
+
+	if len(server.AllowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+
+	origin = strings.ToLower(strings.TrimRight(origin, "/"))
+	for _, allowed := range server.AllowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
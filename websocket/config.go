@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config cấu hình hàng đợi gửi và keepalive của mỗi kết nối
+type Config struct {
+	SendBufferSize int           // Số tin nhắn được xếp hàng trước khi client bị coi là quá chậm
+	WriteWait      time.Duration // Thời gian tối đa cho một lần ghi xuống socket
+	PongWait       time.Duration // Thời gian chờ pong trước khi coi kết nối là đã chết
+	PingInterval   time.Duration // Chu kỳ gửi ping, phải nhỏ hơn PongWait
+	MaxMessageSize int64         // Kích thước tối đa của một frame client gửi lên
+	ReplayLength   int           // Số sự kiện gần nhất được giữ trong Redis Stream để phát lại
+	RoomEmptyTTL   time.Duration // Thời gian giữ phòng xem chung sau khi không còn ai trong phòng
+	RoomHeartbeat  time.Duration // Chu kỳ instance báo thành viên phòng còn kết nối, quá 3 chu kỳ coi như đã rời
+}
+
+// DefaultConfig trả về cấu hình mặc định
+func DefaultConfig() Config {
+	return Config{
+		SendBufferSize: 64,
+		WriteWait:      10 * time.Second,
+		PongWait:       60 * time.Second,
+		PingInterval:   54 * time.Second,
+		MaxMessageSize: 4096,
+		ReplayLength:   1000,
+		RoomEmptyTTL:   30 * time.Minute,
+		RoomHeartbeat:  30 * time.Second,
+	}
+}
+
+// LoadConfig đọc cấu hình từ biến môi trường, giữ giá trị mặc định cho biến không hợp lệ
+func LoadConfig() Config {
+	config := DefaultConfig()
+	config.SendBufferSize = envInt("WS_SEND_BUFFER", config.SendBufferSize)
+	config.WriteWait = envDuration("WS_WRITE_WAIT", config.WriteWait)
+	config.PongWait = envDuration("WS_PONG_WAIT", config.PongWait)
+	config.PingInterval = envDuration("WS_PING_INTERVAL", config.PingInterval)
+	config.MaxMessageSize = int64(envInt("WS_MAX_MESSAGE_SIZE", int(config.MaxMessageSize)))
+	config.ReplayLength = envInt("WS_REPLAY_LENGTH", config.ReplayLength)
+	config.RoomEmptyTTL = envDuration("WS_ROOM_EMPTY_TTL", config.RoomEmptyTTL)
+	config.RoomHeartbeat = envDuration("WS_ROOM_HEARTBEAT", config.RoomHeartbeat)
+
+	if config.PingInterval >= config.PongWait {
+		config.PingInterval = config.PongWait * 9 / 10
+		log.Printf("WS_PING_INTERVAL must be shorter than WS_PONG_WAIT, using %s", config.PingInterval)
+	}
+	return config
+}
+
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s=%q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s=%q, using %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
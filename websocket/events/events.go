@@ -0,0 +1,140 @@
+// Package events định nghĩa các sự kiện realtime gửi tới client qua WebSocket.
+// Sự kiện chỉ mang ID của bản ghi thay đổi, client tự tải lại dữ liệu cần thiết.
+package events
+
+import (
+	"time"
+)
+
+// Version là phiên bản hiện tại của cấu trúc sự kiện, tăng khi thay đổi không tương thích
+const Version = 1
+
+// Entity là loại bản ghi đã thay đổi
+type Entity string
+
+const (
+	EntityMovie    Entity = "movie"
+	EntityEpisode  Entity = "episode"
+	EntityQuality  Entity = "quality"
+	EntityCategory Entity = "category"
+	EntityGenre    Entity = "genre"
+	EntityCountry  Entity = "country"
+	EntityServer   Entity = "server"
+	EntityUser     Entity = "user"
+)
+
+// Entities liệt kê mọi loại bản ghi, dùng cho JSON schema
+var Entities = []Entity{EntityMovie, EntityEpisode, EntityQuality, EntityCategory, EntityGenre, EntityCountry, EntityServer, EntityUser}
+
+// Action là thao tác đã thực hiện trên bản ghi
+type Action string
+
+const (
+	ActionCreated Action = "created"
+	ActionUpdated Action = "updated"
+	ActionDeleted Action = "deleted"
+)
+
+// Actions liệt kê các thao tác thêm, sửa, xóa, dùng cho JSON schema
+var Actions = []Action{ActionCreated, ActionUpdated, ActionDeleted}
+
+// ActionLocked báo tài khoản bị tạm khóa vì đăng nhập sai nhiều lần
+const ActionLocked Action = "locked"
+
+// Actor là người dùng đã thực hiện thay đổi
+type Actor struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username,omitempty"`
+}
+
+// Envelope là các trường chung của mọi sự kiện
+type Envelope struct {
+	Type       string    `json:"type"` // "<entity>.<action>", ví dụ "movie.updated"
+	Version    int       `json:"version"`
+	Entity     Entity    `json:"entity"`
+	ID         string    `json:"id"`
+	Action     Action    `json:"action"`
+	Actor      Actor     `json:"actor"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+func newEnvelope(entity Entity, action Action, id string, actor Actor) Envelope {
+	return Envelope{
+		Type:       string(entity) + "." + string(action),
+		Version:    Version,
+		Entity:     entity,
+		ID:         id,
+		Action:     action,
+		Actor:      actor,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// MovieEvent báo một bộ phim đã thay đổi
+type MovieEvent struct {
+	Envelope
+}
+
+// NewMovieEvent tạo sự kiện cho một bộ phim
+func NewMovieEvent(action Action, movieID string, actor Actor) MovieEvent {
+	return MovieEvent{Envelope: newEnvelope(EntityMovie, action, movieID, actor)}
+}
+
+// EpisodeEvent báo một tập phim đã thay đổi
+type EpisodeEvent struct {
+	Envelope
+	MovieID string `json:"movie_id"`
+}
+
+// NewEpisodeEvent tạo sự kiện cho một tập phim
+func NewEpisodeEvent(action Action, episodeID string, movieID string, actor Actor) EpisodeEvent {
+	return EpisodeEvent{Envelope: newEnvelope(EntityEpisode, action, episodeID, actor), MovieID: movieID}
+}
+
+// QualityEvent báo một quality của tập phim trên một server đã thay đổi
+type QualityEvent struct {
+	Envelope
+	MovieID   string `json:"movie_id"`
+	EpisodeID string `json:"episode_id"`
+	ServerID  string `json:"server_id"`
+}
+
+// NewQualityEvent tạo sự kiện cho một quality
+func NewQualityEvent(action Action, qualityID string, movieID string, episodeID string, serverID string, actor Actor) QualityEvent {
+	return QualityEvent{
+		Envelope:  newEnvelope(EntityQuality, action, qualityID, actor),
+		MovieID:   movieID,
+		EpisodeID: episodeID,
+		ServerID:  serverID,
+	}
+}
+
+// CatalogEvent báo một danh mục, thể loại, quốc gia hoặc server đã thay đổi
+type CatalogEvent struct {
+	Envelope
+}
+
+// NewCatalogEvent tạo sự kiện cho các bản ghi danh mục (category, genre, country, server)
+func NewCatalogEvent(entity Entity, action Action, id string, actor Actor) CatalogEvent {
+	return CatalogEvent{Envelope: newEnvelope(entity, action, id, actor)}
+}
+
+// AccountLockedEvent báo một tài khoản quản trị bị tạm khóa vì đăng nhập sai nhiều lần
+type AccountLockedEvent struct {
+	Envelope
+	Email       string    `json:"email"`
+	IP          string    `json:"ip"` // IP của lần đăng nhập sai cuối cùng
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// NewAccountLockedEvent tạo sự kiện khóa tài khoản, không có actor vì do hệ thống thực hiện
+func NewAccountLockedEvent(userID string, email string, ip string, failures int, lockedUntil time.Time) AccountLockedEvent {
+	return AccountLockedEvent{
+		Envelope:    newEnvelope(EntityUser, ActionLocked, userID, Actor{}),
+		Email:       email,
+		IP:          ip,
+		Failures:    failures,
+		LockedUntil: lockedUntil.UTC(),
+	}
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQualityEventJSON(t *testing.T) {
+	event := NewQualityEvent(ActionDeleted, "q1", "m1", "e1", "s1", Actor{UserID: "u1", Username: "admin"})
+
+	data, err := json.Marshal(event)
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "quality.deleted", decoded["type"])
+	assert.Equal(t, float64(Version), decoded["version"])
+	assert.Equal(t, "quality", decoded["entity"])
+	assert.Equal(t, "q1", decoded["id"])
+	assert.Equal(t, "deleted", decoded["action"])
+	assert.Equal(t, map[string]interface{}{"user_id": "u1", "username": "admin"}, decoded["actor"])
+	assert.Equal(t, "m1", decoded["movie_id"])
+	assert.Equal(t, "e1", decoded["episode_id"])
+	assert.Equal(t, "s1", decoded["server_id"])
+	assert.NotEmpty(t, decoded["occurred_at"])
+}
+
+func TestSchemaDescribesEveryEventField(t *testing.T) {
+	schema, err := Schema()
+	assert.NoError(t, err)
+
+	var decoded struct {
+		Definitions map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+			Required   []string               `json:"required"`
+		} `json:"definitions"`
+	}
+	assert.NoError(t, json.Unmarshal(schema, &decoded))
+
+	episode := decoded.Definitions["EpisodeEvent"]
+	assert.ElementsMatch(t, []string{"type", "version", "entity", "id", "action", "actor", "occurred_at", "movie_id"}, episode.Required)
+	assert.Contains(t, episode.Properties, "movie_id")
+	assert.NotContains(t, decoded.Definitions["MovieEvent"].Properties, "movie_id")
+}
+
+// File schema phục vụ cho frontend phải khớp với các struct, chạy go generate khi test này lỗi
+func TestGeneratedSchemaIsUpToDate(t *testing.T) {
+	schema, err := Schema()
+	assert.NoError(t, err)
+
+	generated, err := os.ReadFile("../../views/admin/assets/js/events.schema.json")
+	assert.NoError(t, err)
+	assert.Equal(t, string(append(schema, '\n')), string(generated))
+}
@@ -0,0 +1,24 @@
+// Chương trình gen ghi JSON schema của các sự kiện realtime ra file.
+// Chạy bằng: go generate ./websocket/events
+package main
+
+import (
+	"fire-watch/websocket/events"
+	"log"
+	"os"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: gen <output file>")
+	}
+
+	schema, err := events.Schema()
+	if err != nil {
+		log.Fatal("Error generating event schema: ", err)
+	}
+
+	if err := os.WriteFile(os.Args[1], append(schema, '\n'), 0644); err != nil {
+		log.Fatal("Error writing event schema: ", err)
+	}
+}
@@ -0,0 +1,110 @@
+package events
+
+//go:generate go run ./gen ../../views/admin/assets/js/events.schema.json
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// eventTypes là các sự kiện được mô tả trong schema, kèm các entity và thao tác mỗi loại có thể mang
+var eventTypes = []struct {
+	name     string
+	event    interface{}
+	entities []Entity
+	actions  []Action
+}{
+	{"MovieEvent", MovieEvent{}, []Entity{EntityMovie}, Actions},
+	{"EpisodeEvent", EpisodeEvent{}, []Entity{EntityEpisode}, Actions},
+	{"QualityEvent", QualityEvent{}, []Entity{EntityQuality}, Actions},
+	{"CatalogEvent", CatalogEvent{}, []Entity{EntityCategory, EntityGenre, EntityCountry, EntityServer}, Actions},
+	{"AccountLockedEvent", AccountLockedEvent{}, []Entity{EntityUser}, []Action{ActionLocked}},
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Schema sinh JSON schema (draft-07) cho mọi sự kiện từ các struct Go,
+// để frontend có thể kiểm tra sự kiện nhận được
+func Schema() ([]byte, error) {
+	definitions := map[string]interface{}{}
+	var oneOf []interface{}
+
+	for _, eventType := range eventTypes {
+		definition := objectSchema(reflect.TypeOf(eventType.event))
+		properties := definition["properties"].(map[string]interface{})
+		properties["entity"] = map[string]interface{}{"type": "string", "enum": eventType.entities}
+		properties["version"] = map[string]interface{}{"type": "integer", "const": Version}
+		properties["action"] = map[string]interface{}{"type": "string", "enum": eventType.actions}
+
+		var types []string
+		for _, entity := range eventType.entities {
+			for _, action := range eventType.actions {
+				types = append(types, string(entity)+"."+string(action))
+			}
+		}
+		properties["type"] = map[string]interface{}{"type": "string", "enum": types}
+
+		definitions[eventType.name] = definition
+		oneOf = append(oneOf, map[string]interface{}{"$ref": "#/definitions/" + eventType.name})
+	}
+
+	schema := map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"$id":         "/admin/assets/js/events.schema.json",
+		"title":       "Fire Watch realtime event",
+		"definitions": definitions,
+		"oneOf":       oneOf,
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// objectSchema mô tả một struct, gộp các trường của struct nhúng vào cùng cấp như encoding/json
+func objectSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	collectFields(t, properties, &required)
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func collectFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			collectFields(field.Type, properties, required)
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		properties[name] = fieldSchema(field.Type)
+		if options != "omitempty" {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func fieldSchema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(Action("")):
+		return map[string]interface{}{"type": "string", "enum": Actions}
+	case t.Kind() == reflect.Struct:
+		return objectSchema(t)
+	case t.Kind() == reflect.Int:
+		return map[string]interface{}{"type": "integer"}
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
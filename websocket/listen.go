@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Listener nhận sự kiện của hub ngay trong process (ví dụ làm mới chỉ mục tìm kiếm),
+// gồm cả sự kiện từ instance khác được relay qua Redis
+type Listener struct {
+	// Events nhận từng sự kiện thuộc các topic đã đăng ký. Kênh bị đóng khi gọi Close
+	// hoặc khi listener nhận quá chậm và bị hub loại, khi đó cần Listen lại và tự đồng bộ
+	Events <-chan []byte
+
+	server *WebSocketServer
+	client *Client
+	once   sync.Once
+}
+
+// Listen đăng ký listener vào các topic, không qua kiểm tra quyền như client bên ngoài
+func (server *WebSocketServer) Listen(topics ...string) *Listener {
+	client := &Client{
+		Send:   make(chan []byte, server.Config.SendBufferSize),
+		Topics: make(map[string]bool),
+		UserID: "internal",
+	}
+
+	server.Register <- client
+	for _, topic := range topics {
+		server.Subscriptions <- &Subscription{Client: client, Topic: topic, Subscribe: true}
+	}
+	return &Listener{Events: client.Send, server: server, client: client}
+}
+
+// Close hủy đăng ký listener, gọi nhiều lần không sao
+func (listener *Listener) Close() {
+	listener.once.Do(func() {
+		listener.server.Unregister <- listener.client
+	})
+}
+
+// EventData bỏ phần bọc số thứ tự của frame sự kiện, trả về dữ liệu gốc đã publish
+func EventData(frame []byte) []byte {
+	var event eventFrame
+	if err := json.Unmarshal(frame, &event); err != nil || event.Data == nil {
+		return frame
+	}
+	return event.Data
+}
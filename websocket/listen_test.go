@@ -0,0 +1,33 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenerReceivesPublishedEvents(t *testing.T) {
+	server := NewWebSocketServer()
+	go server.Run()
+
+	listener := server.Listen(TopicAdminCatalog)
+	server.Publish([]byte(`{"entity":"movie"}`), MovieTopic("0123456789abcdef01234567"))
+	server.Publish([]byte(`{"entity":"genre"}`), TopicAdminCatalog)
+
+	select {
+	case frame := <-listener.Events:
+		assert.JSONEq(t, `{"entity":"genre"}`, string(EventData(frame)))
+	case <-time.After(time.Second):
+		t.Fatal("listener did not receive event")
+	}
+
+	listener.Close()
+	listener.Close()
+	select {
+	case _, ok := <-listener.Events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("events channel was not closed")
+	}
+}
@@ -0,0 +1,85 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Kênh Redis dùng chung để chuyển tin nhắn giữa các instance
+const relayChannel = "ws:events"
+
+// relayEnvelope là tin nhắn gửi qua Redis, kèm ID của instance đã publish
+type relayEnvelope struct {
+	Instance string   `json:"instance"`
+	Seq      int64    `json:"seq"`
+	Topics   []string `json:"topics"`
+	Data     []byte   `json:"data"`
+}
+
+func newInstanceID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatal("Không thể tạo instance ID cho WebSocket server: ", err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// EnableRedisRelay cho phép hub gửi và nhận tin nhắn qua Redis pub/sub,
+// để client kết nối tới instance khác cũng nhận được sự kiện
+func (server *WebSocketServer) EnableRedisRelay(client *redis.Client) {
+	server.redis = client
+	pubsub := client.Subscribe(context.Background(), relayChannel)
+
+	// Chờ Redis xác nhận đăng ký để không bỏ lỡ tin nhắn ngay sau khi khởi động
+	if _, err := pubsub.Receive(context.Background()); err != nil {
+		log.Println("Error subscribing to WebSocket relay channel:", err)
+	}
+
+	go server.relay(pubsub)
+
+	// Phòng xem chung cần Redis, gia hạn các phòng còn thành viên trên instance này
+	go server.keepRoomsAlive()
+}
+
+// relay chuyển tin nhắn đến từ các instance khác cho client cục bộ
+func (server *WebSocketServer) relay(pubsub *redis.PubSub) {
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		var envelope relayEnvelope
+		if err := json.Unmarshal([]byte(msg.Payload), &envelope); err != nil {
+			log.Println("Error decoding relayed message:", err)
+			continue
+		}
+
+		// Tin nhắn của chính instance này đã được gửi cục bộ trong Publish
+		if envelope.Instance == server.InstanceID {
+			continue
+		}
+
+		server.Broadcast <- &Message{Seq: envelope.Seq, Topics: envelope.Topics, Data: envelope.Data}
+	}
+}
+
+// publishRemote gửi tin nhắn lên Redis cho các instance khác
+func (server *WebSocketServer) publishRemote(message *Message) {
+	payload, err := json.Marshal(relayEnvelope{
+		Instance: server.InstanceID,
+		Seq:      message.Seq,
+		Topics:   message.Topics,
+		Data:     message.Data,
+	})
+	if err != nil {
+		log.Println("Error encoding relayed message:", err)
+		return
+	}
+
+	if err := server.redis.Publish(context.Background(), relayChannel, payload).Err(); err != nil {
+		log.Println("Error publishing message to Redis:", err)
+	}
+}
@@ -0,0 +1,41 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishReachesClientsOnOtherInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	first, dialFirst := dialTestServer(t)
+	second, dialSecond := dialTestServer(t)
+	for _, server := range []*WebSocketServer{first, second} {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		server.EnableRedisRelay(client)
+	}
+
+	local := dialFirst("role=admin")
+	remote := dialSecond("role=admin")
+	subscribeTo(t, local, TopicAdminCatalog)
+	subscribeTo(t, remote, TopicAdminCatalog)
+
+	first.Publish([]byte("movie changed"), TopicAdminCatalog)
+
+	data, err := readWithTimeout(remote, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "movie changed", eventText(t, data))
+
+	// Instance gốc chỉ gửi một lần dù cũng nhận lại tin nhắn từ Redis
+	data, err = readWithTimeout(local, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "movie changed", eventText(t, data))
+
+	_, err = readWithTimeout(local, 200*time.Millisecond)
+	assert.Error(t, err)
+}
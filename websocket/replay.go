@@ -0,0 +1,243 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Khóa Redis lưu số thứ tự sự kiện và stream giữ các sự kiện gần nhất để phát lại
+const (
+	sequenceKey = "ws:seq"
+	streamKey   = "ws:stream"
+)
+
+// Tăng số thứ tự và ghi sự kiện vào stream trong cùng một lệnh, để ID của stream luôn tăng dần
+var appendEventScript = redis.NewScript(`
+local seq = redis.call("INCR", KEYS[1])
+redis.call("XADD", KEYS[2], "MAXLEN", "~", ARGV[1], seq .. "-0", "topics", ARGV[2], "data", ARGV[3])
+return seq
+`)
+
+// eventFrame là tin nhắn sự kiện gửi xuống client, kèm số thứ tự để client có thể resume
+type eventFrame struct {
+	Seq  int64           `json:"seq"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Resume là yêu cầu phát lại các sự kiện sau From cho một client
+type Resume struct {
+	Client *Client
+	From   int64
+}
+
+// encodeFrame bọc dữ liệu sự kiện cùng số thứ tự, dữ liệu không phải JSON được gửi dưới dạng chuỗi
+func encodeFrame(seq int64, data []byte) []byte {
+	raw := json.RawMessage(data)
+	if !json.Valid(data) {
+		raw, _ = json.Marshal(string(data))
+	}
+
+	frame, err := json.Marshal(eventFrame{Seq: seq, Data: raw})
+	if err != nil {
+		log.Println("Error encoding event frame:", err)
+		return data
+	}
+	return frame
+}
+
+// Số sự kiện đọc từ stream mỗi lần khi phát lại, để một lần resume không đọc cả stream
+const replayPageSize = 100
+
+// Chu kỳ thử lại khi hàng đợi của client đang đầy trong lúc phát lại
+const replayRetryInterval = 10 * time.Millisecond
+
+// nextSequence cấp số thứ tự cho một sự kiện và lưu nó vào stream nếu có Redis.
+// ok là false nếu không ghi được vào stream, khi đó sự kiện không có số thứ tự hợp lệ
+func (server *WebSocketServer) nextSequence(data []byte, topics []string) (seq int64, ok bool) {
+	if server.redis == nil {
+		return server.localSeq.Add(1), true
+	}
+
+	topicsJSON, _ := json.Marshal(topics)
+	seq, err := appendEventScript.Run(context.Background(), server.redis,
+		[]string{sequenceKey, streamKey}, server.Config.ReplayLength, topicsJSON, data).Int64()
+	if err != nil {
+		log.Println("Error appending event to stream:", err)
+		return 0, false
+	}
+	return seq, true
+}
+
+// startReplay đánh dấu client đang được phát lại và phát lại trong goroutine riêng,
+// để việc đọc Redis và chờ client không chặn hub. Phải được gọi khi đang giữ Mutex.
+func (server *WebSocketServer) startReplay(client *Client, from int64) {
+	if client.replaying {
+		// Đang phát lại từ một vị trí trước đó, client sẽ nhận đủ sự kiện khi lần đó xong
+		return
+	}
+	if server.redis == nil {
+		if from < server.localSeq.Load() {
+			server.replyLocked(client, serverReply{Type: "resync"})
+		}
+		return
+	}
+
+	client.replaying = true
+	client.skippedTo = 0
+	go server.replay(client, from)
+}
+
+// replay gửi lại cho client các sự kiện có số thứ tự lớn hơn from thuộc các topic nó đã đăng ký,
+// đọc stream theo từng trang. Trong lúc phát lại, hub không gửi sự kiện trực tiếp có số thứ tự
+// cho client mà chỉ ghi nhớ số lớn nhất đã bỏ qua; replay đọc tiếp stream cho tới khi vượt qua số đó
+// nên client nhận sự kiện đúng thứ tự và không thiếu.
+// Nếu stream không còn đủ sự kiện, client nhận thêm phản hồi "resync" để tự tải lại dữ liệu.
+func (server *WebSocketServer) replay(client *Client, from int64) {
+	last := from
+	resync := false
+	defer func() { server.finishReplay(client, last, resync) }()
+
+	first := true
+	for {
+		entries, err := server.redis.XRangeN(context.Background(), streamKey, strconv.FormatInt(last, 10)+"-0", "+", replayPageSize).Result()
+		if err != nil {
+			log.Println("Error reading event stream:", err)
+			resync = true
+			return
+		}
+
+		if first {
+			first = false
+			if len(entries) == 0 || streamSeq(entries[0].ID) != from {
+				// Sự kiện from đã bị cắt khỏi stream hoặc stream đã mất, có thể đã lỡ sự kiện
+				if !server.replyReplay(client, serverReply{Type: "resync"}) {
+					return
+				}
+			}
+		}
+
+		for _, entry := range entries {
+			seq := streamSeq(entry.ID)
+			if seq <= last {
+				continue
+			}
+			last = seq
+
+			topics := []string{}
+			if value, ok := entry.Values["topics"].(string); ok {
+				json.Unmarshal([]byte(value), &topics)
+			}
+			data, _ := entry.Values["data"].(string)
+			if !server.deliverReplay(client, topics, encodeFrame(seq, []byte(data))) {
+				return
+			}
+		}
+
+		if len(entries) < replayPageSize && server.caughtUp(client, last, len(entries) == 0) {
+			return
+		}
+	}
+}
+
+// caughtUp kết thúc phát lại nếu hub chưa bỏ qua sự kiện nào mới hơn last. Các sự kiện đó đã nằm
+// trong stream trước khi tới hub, nên stream không còn gì mới (empty) nghĩa là chúng đã bị cắt
+func (server *WebSocketServer) caughtUp(client *Client, last int64, empty bool) bool {
+	server.Mutex.Lock()
+	defer server.Mutex.Unlock()
+	if _, ok := server.Clients[client]; !ok {
+		return true
+	}
+	if client.skippedTo <= last {
+		return true
+	}
+	if empty {
+		server.replyLocked(client, serverReply{Type: "resync"})
+		return true
+	}
+	return false
+}
+
+// finishReplay đưa client về nhận sự kiện trực tiếp, sự kiện không mới hơn last sẽ không gửi lại
+func (server *WebSocketServer) finishReplay(client *Client, last int64, resync bool) {
+	server.Mutex.Lock()
+	defer server.Mutex.Unlock()
+	if _, ok := server.Clients[client]; !ok {
+		return
+	}
+	client.replaying = false
+	if last > client.replayedTo {
+		client.replayedTo = last
+	}
+	if resync {
+		server.replyLocked(client, serverReply{Type: "resync"})
+	}
+}
+
+// deliverReplay đưa frame phát lại vào hàng đợi nếu client đăng ký một trong các topic.
+// Hàng đợi đầy thì chờ client đọc bớt thay vì loại ngay, chỉ loại client không đọc gì trong WriteWait.
+// Trả về false nếu client đã ngắt kết nối hoặc bị loại
+func (server *WebSocketServer) deliverReplay(client *Client, topics []string, data []byte) bool {
+	deadline := time.Now().Add(server.Config.WriteWait)
+	for {
+		server.Mutex.Lock()
+		if _, ok := server.Clients[client]; !ok {
+			server.Mutex.Unlock()
+			return false
+		}
+		if !client.subscribedToAny(topics) {
+			server.Mutex.Unlock()
+			return true
+		}
+
+		select {
+		case client.Send <- data:
+			server.stats.delivered.Add(1)
+			server.Mutex.Unlock()
+			return true
+		default:
+		}
+
+		if time.Now().After(deadline) {
+			server.evict(client)
+			server.Mutex.Unlock()
+			return false
+		}
+		server.Mutex.Unlock()
+		time.Sleep(replayRetryInterval)
+	}
+}
+
+// replyReplay gửi phản hồi cho client đang được phát lại, chờ hàng đợi như deliverReplay
+func (server *WebSocketServer) replyReplay(client *Client, reply serverReply) bool {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return true
+	}
+	return server.deliverReplay(client, nil, data)
+}
+
+// streamSeq lấy số thứ tự từ ID "<seq>-0" của stream
+func streamSeq(id string) int64 {
+	seq, _ := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	return seq
+}
+
+// subscribedToAny cho biết client có đăng ký ít nhất một trong các topic không, nil nghĩa là mọi client.
+// Phải được gọi khi đang giữ Mutex
+func (client *Client) subscribedToAny(topics []string) bool {
+	if topics == nil {
+		return true
+	}
+	for _, topic := range topics {
+		if client.Topics[topic] {
+			return true
+		}
+	}
+	return false
+}
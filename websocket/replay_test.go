@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// dialReplayServer giống dialTestServer nhưng bật Redis để sự kiện được lưu vào stream
+func dialReplayServer(t *testing.T) (*WebSocketServer, func(query string) *websocket.Conn) {
+	mr := miniredis.RunT(t)
+	server, dial := dialTestServer(t)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	server.EnableRedisRelay(client)
+	return server, dial
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) eventFrame {
+	data, err := readWithTimeout(conn, time.Second)
+	assert.NoError(t, err)
+
+	var frame eventFrame
+	assert.NoError(t, json.Unmarshal(data, &frame))
+	return frame
+}
+
+func TestResumeReplaysMissedEventsBeforeLiveDelivery(t *testing.T) {
+	server, dial := dialReplayServer(t)
+
+	server.Publish([]byte(`{"type":"movie"}`), TopicAdminCatalog)
+	server.Publish([]byte(`{"type":"episode"}`), EpisodeTopic(testMovieID), TopicAdminCatalog)
+	server.Publish([]byte(`{"type":"quality"}`), MovieTopic(testMovieID))
+	server.Publish([]byte(`{"type":"movie"}`), TopicAdminCatalog)
+
+	conn := dial("role=admin&topics=" + TopicAdminCatalog + "&resume_from=1")
+
+	// Sự kiện 3 thuộc topic client không đăng ký nên không được phát lại
+	assert.Equal(t, int64(2), readFrame(t, conn).Seq)
+	frame := readFrame(t, conn)
+	assert.Equal(t, int64(4), frame.Seq)
+	assert.JSONEq(t, `{"type":"movie"}`, string(frame.Data))
+
+	server.Publish([]byte(`{"type":"movie"}`), TopicAdminCatalog)
+	assert.Equal(t, int64(5), readFrame(t, conn).Seq)
+
+	_, err := readWithTimeout(conn, 100*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestResumeFrameAfterSubscribing(t *testing.T) {
+	server, dial := dialReplayServer(t)
+
+	server.Publish([]byte(`{"type":"movie"}`), TopicAdminCatalog)
+	server.Publish([]byte(`{"type":"movie"}`), TopicAdminCatalog)
+
+	conn := dial("role=admin")
+	subscribeTo(t, conn, TopicAdminCatalog)
+	assert.NoError(t, conn.WriteJSON(clientFrame{Action: "resume", ResumeFrom: 1}))
+
+	assert.Equal(t, int64(2), readFrame(t, conn).Seq)
+}
+
+func TestResumeAsksForResyncWhenEventsWereTrimmed(t *testing.T) {
+	server, dial := dialReplayServer(t)
+
+	for i := 0; i < 3; i++ {
+		server.Publish([]byte(`{"type":"movie"}`), TopicAdminCatalog)
+	}
+	// Giả lập stream đã bị cắt ngắn hoàn toàn trước sự kiện 3
+	assert.NoError(t, server.redis.XTrimMaxLen(server.redis.Context(), streamKey, 1).Err())
+
+	conn := dial("role=admin&topics=" + TopicAdminCatalog + "&resume_from=1")
+
+	var reply serverReply
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NoError(t, conn.ReadJSON(&reply))
+	assert.Equal(t, "resync", reply.Type)
+	assert.Equal(t, int64(3), readFrame(t, conn).Seq)
+}
+
+func TestResumePastSendBufferDeliversEveryEvent(t *testing.T) {
+	server, dial := dialReplayServer(t)
+
+	// Lỡ nhiều sự kiện hơn cả hàng đợi gửi và nhiều trang của stream
+	total := 3*server.Config.SendBufferSize + replayPageSize
+	for i := 0; i < total; i++ {
+		server.Publish([]byte(`{"type":"movie"}`), TopicAdminCatalog)
+	}
+
+	conn := dial("role=admin&topics=" + TopicAdminCatalog + "&resume_from=1")
+
+	// Sự kiện mới trong lúc đang phát lại vẫn đến đúng thứ tự, sau các sự kiện cũ
+	go server.Publish([]byte(`{"type":"live"}`), TopicAdminCatalog)
+
+	for seq := int64(2); seq <= int64(total+1); seq++ {
+		assert.Equal(t, seq, readFrame(t, conn).Seq)
+	}
+	_, err := readWithTimeout(conn, 100*time.Millisecond)
+	assert.Error(t, err)
+	assert.Zero(t, server.Stats().Evicted)
+}
+
+func TestPublishAsksForResyncWhenStreamIsUnavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	server, dial := dialTestServer(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	server.EnableRedisRelay(client)
+
+	conn := dial("role=admin&topics=" + TopicAdminCatalog)
+	// Chờ hub xử lý đăng ký topic
+	assert.Eventually(t, func() bool { return server.Stats().Topics == 1 }, time.Second, 10*time.Millisecond)
+	mr.Close()
+
+	server.Publish([]byte(`{"type":"movie"}`), TopicAdminCatalog)
+
+	var reply serverReply
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NoError(t, conn.ReadJSON(&reply))
+	assert.Equal(t, "resync", reply.Type)
+}
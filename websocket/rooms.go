@@ -0,0 +1,482 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Các action của phòng xem chung trong frame client gửi lên
+const (
+	roomCreate  = "room.create"
+	roomJoin    = "room.join"
+	roomLeave   = "room.leave"
+	roomCommand = "room.command"
+	roomTime    = "room.time"
+)
+
+// Mã phòng ngắn để chia sẻ, bỏ các ký tự dễ nhầm như 0/O, 1/I
+const (
+	roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	roomCodeLength   = 6
+)
+
+var (
+	errRoomUnavailable = errors.New("Watch party is unavailable")
+	errRoomNotFound    = errors.New("Room not found")
+	errNotRoomHost     = errors.New("Only the host can control playback")
+	errInvalidCommand  = errors.New("Invalid room command")
+)
+
+// RoomTopic nhận trạng thái phát và thành viên của một phòng xem chung.
+// Client không tự đăng ký topic này mà được thêm vào khi tham gia phòng.
+func RoomTopic(code string) string {
+	return "room:" + code
+}
+
+func roomKey(code string) string {
+	return "room:" + code
+}
+
+func roomMembersKey(code string) string {
+	return "room:" + code + ":members"
+}
+
+// roomSeenKey là sorted set user ID -> lần cuối instance giữ kết nối của thành viên báo còn sống (mili giây).
+// Thành viên trên instance đã dừng đột ngột không được gia hạn và bị bỏ qua khi chuyển quyền host
+func roomSeenKey(code string) string {
+	return "room:" + code + ":seen"
+}
+
+// roomMemberStale là thời gian không có heartbeat để coi một thành viên là đã rời phòng
+func (server *WebSocketServer) roomMemberStale() time.Duration {
+	return 3 * server.Config.RoomHeartbeat
+}
+
+// RoomState là trạng thái phát của phòng, lưu trong Redis để mọi instance dùng chung.
+// Position được đo theo đồng hồ của host tại HostTime, server ghi lại ServerTime khi nhận lệnh
+// để thành viên tự tính vị trí hiện tại và bù lệch.
+type RoomState struct {
+	Code       string  `json:"code"`
+	HostID     string  `json:"host_id"`
+	MovieID    string  `json:"movie_id"`
+	EpisodeID  string  `json:"episode_id"`
+	QualityID  string  `json:"quality_id"`
+	Playing    bool    `json:"playing"`
+	Position   float64 `json:"position"`    // Giây
+	HostTime   int64   `json:"host_time"`   // Mili giây theo đồng hồ host
+	ServerTime int64   `json:"server_time"` // Mili giây theo đồng hồ server
+}
+
+// roomFrame là frame điều khiển phòng xem chung
+type roomFrame struct {
+	Action     string  `json:"action"`
+	Room       string  `json:"room"`
+	MovieID    string  `json:"movie_id"`
+	EpisodeID  string  `json:"episode_id"`
+	QualityID  string  `json:"quality_id"`
+	Command    string  `json:"command"` // "play", "pause", "seek", "quality" hoặc "sync"
+	Position   float64 `json:"position"`
+	ClientTime int64   `json:"client_time"` // Mili giây theo đồng hồ của client gửi frame
+}
+
+// roomMessage là tin nhắn gửi cho thành viên phòng
+type roomMessage struct {
+	Type       string     `json:"type"` // "room.state", "room.member", "room.joined", "room.left", "room.time"
+	Command    string     `json:"command,omitempty"`
+	Room       *RoomState `json:"room,omitempty"`
+	UserID     string     `json:"user_id,omitempty"`
+	Action     string     `json:"action,omitempty"` // "joined" hoặc "left" với room.member
+	ClientTime int64      `json:"client_time,omitempty"`
+	ServerTime int64      `json:"server_time,omitempty"`
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// handleRoomFrame xử lý các frame room.* trong goroutine đọc của client
+func (server *WebSocketServer) handleRoomFrame(client *Client, message []byte) {
+	var frame roomFrame
+	if err := json.Unmarshal(message, &frame); err != nil {
+		server.reply(client, serverReply{Type: "error", Message: "Invalid frame"})
+		return
+	}
+
+	// Đồng bộ đồng hồ không cần Redis: client tự tính độ lệch từ client_time và server_time
+	if frame.Action == roomTime {
+		server.reply(client, roomMessage{Type: roomTime, ClientTime: frame.ClientTime, ServerTime: nowMillis()})
+		return
+	}
+
+	if server.redis == nil {
+		server.reply(client, serverReply{Type: "error", Message: errRoomUnavailable.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var err error
+	switch frame.Action {
+	case roomCreate:
+		err = server.createRoom(ctx, client, frame)
+	case roomJoin:
+		err = server.joinRoom(ctx, client, frame.Room)
+	case roomLeave:
+		server.leaveRoom(client)
+		server.reply(client, roomMessage{Type: "room.left"})
+	case roomCommand:
+		err = server.roomCommand(ctx, client, frame)
+	}
+
+	if err != nil {
+		server.reply(client, serverReply{Type: "error", Message: err.Error()})
+	}
+}
+
+// createRoom tạo phòng mới với client là host rồi cho client tham gia phòng
+func (server *WebSocketServer) createRoom(ctx context.Context, client *Client, frame roomFrame) error {
+	for _, id := range []string{frame.MovieID, frame.EpisodeID, frame.QualityID} {
+		if !primitive.IsValidObjectID(id) {
+			return errInvalidCommand
+		}
+	}
+
+	state := &RoomState{
+		HostID:     client.UserID,
+		MovieID:    frame.MovieID,
+		EpisodeID:  frame.EpisodeID,
+		QualityID:  frame.QualityID,
+		HostTime:   frame.ClientTime,
+		ServerTime: nowMillis(),
+	}
+
+	// Thử vài mã ngẫu nhiên, SETNX đảm bảo không ghi đè phòng đang tồn tại
+	for attempt := 0; attempt < 5; attempt++ {
+		code, err := newRoomCode()
+		if err != nil {
+			return err
+		}
+		state.Code = code
+
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		created, err := server.redis.SetNX(ctx, roomKey(code), data, server.Config.RoomEmptyTTL).Result()
+		if err != nil {
+			log.Println("Error creating room:", err)
+			return errRoomUnavailable
+		}
+		if created {
+			return server.joinRoom(ctx, client, code)
+		}
+	}
+	return errRoomUnavailable
+}
+
+func newRoomCode() (string, error) {
+	code := make([]byte, roomCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(roomCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = roomCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// joinRoom thêm client vào phòng, gửi trạng thái hiện tại cho client và báo cho các thành viên khác
+func (server *WebSocketServer) joinRoom(ctx context.Context, client *Client, code string) error {
+	state, err := server.loadRoom(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	if client.Room != "" && client.Room != code {
+		server.leaveRoom(client)
+	}
+
+	if client.Room != code {
+		_, err = server.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HIncrBy(ctx, roomMembersKey(code), client.UserID, 1)
+			pipe.ZAdd(ctx, roomSeenKey(code), &redis.Z{Score: float64(nowMillis()), Member: client.UserID})
+			pipe.Expire(ctx, roomMembersKey(code), server.Config.RoomEmptyTTL)
+			pipe.Expire(ctx, roomSeenKey(code), server.Config.RoomEmptyTTL)
+			pipe.Expire(ctx, roomKey(code), server.Config.RoomEmptyTTL)
+			return nil
+		})
+		if err != nil {
+			log.Println("Error joining room:", err)
+			return errRoomUnavailable
+		}
+
+		client.Room = code
+		server.trackRoom(code, client.UserID, 1)
+		server.Subscriptions <- &Subscription{Client: client, Topic: RoomTopic(code), Subscribe: true}
+		server.publishRoom(code, roomMessage{Type: "room.member", Action: "joined", UserID: client.UserID})
+	}
+
+	server.reply(client, roomMessage{Type: "room.joined", Room: state})
+	return nil
+}
+
+// leaveRoom đưa client ra khỏi phòng, chuyển quyền host nếu host rời đi khi phòng còn người.
+// Phòng không còn ai sẽ tự hết hạn sau RoomEmptyTTL.
+func (server *WebSocketServer) leaveRoom(client *Client) {
+	code := client.Room
+	if code == "" {
+		return
+	}
+	client.Room = ""
+	server.trackRoom(code, client.UserID, -1)
+	server.Subscriptions <- &Subscription{Client: client, Topic: RoomTopic(code), Subscribe: false}
+
+	if server.redis == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	remaining, err := server.redis.HIncrBy(ctx, roomMembersKey(code), client.UserID, -1).Result()
+	if err != nil {
+		log.Println("Error leaving room:", err)
+		return
+	}
+	if remaining > 0 {
+		// Người dùng vẫn còn tab khác trong phòng
+		return
+	}
+	server.removeRoomMembers(ctx, code, client.UserID)
+
+	state, err := server.loadRoom(ctx, code)
+	if err != nil || state.HostID != client.UserID {
+		return
+	}
+
+	host, err := server.nextRoomHost(ctx, code)
+	if err != nil || host == "" {
+		return
+	}
+
+	// Host mới dùng đồng hồ của mình làm mốc từ lệnh tiếp theo
+	state.HostID = host
+	if err := server.saveRoom(ctx, state); err == nil {
+		server.publishRoom(code, roomMessage{Type: "room.state", Command: "host", Room: state})
+	}
+}
+
+// removeRoomMembers xóa thành viên khỏi phòng và báo cho các thành viên còn lại
+func (server *WebSocketServer) removeRoomMembers(ctx context.Context, code string, userIDs ...string) {
+	members := make([]interface{}, len(userIDs))
+	for i, userID := range userIDs {
+		members[i] = userID
+	}
+	_, err := server.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, roomMembersKey(code), userIDs...)
+		pipe.ZRem(ctx, roomSeenKey(code), members...)
+		return nil
+	})
+	if err != nil {
+		log.Println("Error leaving room:", err)
+		return
+	}
+	for _, userID := range userIDs {
+		server.publishRoom(code, roomMessage{Type: "room.member", Action: "left", UserID: userID})
+	}
+}
+
+// nextRoomHost chọn thành viên có heartbeat gần nhất làm host mới, rỗng nếu phòng không còn ai.
+// Thành viên quá roomMemberStale không có heartbeat (instance đã dừng) bị xóa khỏi phòng
+func (server *WebSocketServer) nextRoomHost(ctx context.Context, code string) (string, error) {
+	members, err := server.redis.HKeys(ctx, roomMembersKey(code)).Result()
+	if err != nil || len(members) == 0 {
+		return "", err
+	}
+	seen, err := server.redis.ZRevRangeWithScores(ctx, roomSeenKey(code), 0, -1).Result()
+	if err != nil {
+		return "", err
+	}
+
+	isMember := make(map[string]bool, len(members))
+	for _, userID := range members {
+		isMember[userID] = true
+	}
+
+	cutoff := float64(time.Now().Add(-server.roomMemberStale()).UnixMilli())
+	host := ""
+	fresh := make(map[string]bool, len(seen))
+	for _, entry := range seen {
+		userID, _ := entry.Member.(string)
+		if entry.Score < cutoff || !isMember[userID] {
+			continue
+		}
+		fresh[userID] = true
+		if host == "" {
+			host = userID
+		}
+	}
+
+	var stale []string
+	for _, userID := range members {
+		if !fresh[userID] {
+			stale = append(stale, userID)
+		}
+	}
+	if len(stale) > 0 {
+		server.removeRoomMembers(ctx, code, stale...)
+	}
+	return host, nil
+}
+
+// roomCommand áp dụng lệnh phát của host lên trạng thái phòng và gửi cho mọi thành viên
+func (server *WebSocketServer) roomCommand(ctx context.Context, client *Client, frame roomFrame) error {
+	if client.Room == "" {
+		return errRoomNotFound
+	}
+
+	state, err := server.loadRoom(ctx, client.Room)
+	if err != nil {
+		return err
+	}
+	if state.HostID != client.UserID {
+		return errNotRoomHost
+	}
+
+	switch frame.Command {
+	case "play":
+		state.Playing = true
+		state.Position = frame.Position
+	case "pause":
+		state.Playing = false
+		state.Position = frame.Position
+	case "seek", "sync":
+		state.Position = frame.Position
+	case "quality":
+		if !primitive.IsValidObjectID(frame.QualityID) {
+			return errInvalidCommand
+		}
+		state.QualityID = frame.QualityID
+		state.Position = frame.Position
+	default:
+		return errInvalidCommand
+	}
+	if state.Position < 0 {
+		return errInvalidCommand
+	}
+
+	state.HostTime = frame.ClientTime
+	state.ServerTime = nowMillis()
+	if err := server.saveRoom(ctx, state); err != nil {
+		return err
+	}
+
+	server.publishRoom(state.Code, roomMessage{Type: "room.state", Command: frame.Command, Room: state})
+	return nil
+}
+
+func (server *WebSocketServer) loadRoom(ctx context.Context, code string) (*RoomState, error) {
+	data, err := server.redis.Get(ctx, roomKey(code)).Bytes()
+	if err == redis.Nil {
+		return nil, errRoomNotFound
+	}
+	if err != nil {
+		log.Println("Error loading room:", err)
+		return nil, errRoomUnavailable
+	}
+
+	var state RoomState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errRoomNotFound
+	}
+	return &state, nil
+}
+
+func (server *WebSocketServer) saveRoom(ctx context.Context, state *RoomState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := server.redis.Set(ctx, roomKey(state.Code), data, server.Config.RoomEmptyTTL).Err(); err != nil {
+		log.Println("Error saving room:", err)
+		return errRoomUnavailable
+	}
+	return nil
+}
+
+// publishRoom gửi tin nhắn tới mọi thành viên của phòng trên mọi instance
+func (server *WebSocketServer) publishRoom(code string, message roomMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Println("Error encoding room message:", err)
+		return
+	}
+	server.publishTransient(data, RoomTopic(code))
+}
+
+// trackRoom đếm số client cục bộ của mỗi thành viên trong từng phòng để keepRoomsAlive gia hạn
+func (server *WebSocketServer) trackRoom(code string, userID string, delta int) {
+	server.Mutex.Lock()
+	defer server.Mutex.Unlock()
+
+	members := server.rooms[code]
+	if members == nil {
+		members = make(map[string]int)
+		server.rooms[code] = members
+	}
+	members[userID] += delta
+	if members[userID] <= 0 {
+		delete(members, userID)
+	}
+	if len(members) == 0 {
+		delete(server.rooms, code)
+	}
+}
+
+// keepRoomsAlive gia hạn các phòng còn thành viên trên instance này và ghi heartbeat cho từng thành viên.
+// Phòng không được instance nào gia hạn (đã trống hoặc instance đã dừng) sẽ hết hạn sau RoomEmptyTTL.
+func (server *WebSocketServer) keepRoomsAlive() {
+	ticker := time.NewTicker(server.Config.RoomHeartbeat)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		server.Mutex.Lock()
+		rooms := make(map[string][]*redis.Z, len(server.rooms))
+		now := float64(nowMillis())
+		for code, members := range server.rooms {
+			for userID := range members {
+				rooms[code] = append(rooms[code], &redis.Z{Score: now, Member: userID})
+			}
+		}
+		server.Mutex.Unlock()
+
+		if len(rooms) == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := server.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for code, members := range rooms {
+				pipe.ZAdd(ctx, roomSeenKey(code), members...)
+				pipe.Expire(ctx, roomKey(code), server.Config.RoomEmptyTTL)
+				pipe.Expire(ctx, roomMembersKey(code), server.Config.RoomEmptyTTL)
+				pipe.Expire(ctx, roomSeenKey(code), server.Config.RoomEmptyTTL)
+			}
+			return nil
+		})
+		cancel()
+		if err != nil {
+			log.Println("Error refreshing rooms:", err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testEpisodeID = "64b7f0c2a1b2c3d4e5f60719"
+	testQualityID = "64b7f0c2a1b2c3d4e5f6071a"
+	otherQuality  = "64b7f0c2a1b2c3d4e5f6071b"
+)
+
+func readRoomMessage(t *testing.T, conn *websocket.Conn) roomMessage {
+	var message roomMessage
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NoError(t, conn.ReadJSON(&message))
+	return message
+}
+
+// createTestRoom để host tạo phòng và guest tham gia, trả về mã phòng
+func createTestRoom(t *testing.T, host, guest *websocket.Conn) string {
+	assert.NoError(t, host.WriteJSON(roomFrame{Action: roomCreate, MovieID: testMovieID, EpisodeID: testEpisodeID, QualityID: testQualityID, ClientTime: 1000}))
+
+	// Host nhận thông báo thành viên (chính mình) và trạng thái phòng, thứ tự có thể khác nhau
+	var joined roomMessage
+	for i := 0; i < 2; i++ {
+		if message := readRoomMessage(t, host); message.Type == "room.joined" {
+			joined = message
+		}
+	}
+	assert.NotNil(t, joined.Room)
+	assert.Len(t, joined.Room.Code, roomCodeLength)
+	assert.Equal(t, "host", joined.Room.HostID)
+
+	assert.NoError(t, guest.WriteJSON(roomFrame{Action: roomJoin, Room: joined.Room.Code}))
+	for i := 0; i < 2; i++ {
+		if message := readRoomMessage(t, guest); message.Type == "room.joined" {
+			assert.Equal(t, testQualityID, message.Room.QualityID)
+		}
+	}
+	assert.Equal(t, roomMessage{Type: "room.member", Action: "joined", UserID: "guest"}, readRoomMessage(t, host))
+
+	return joined.Room.Code
+}
+
+func TestRoomCommandsReachEveryMember(t *testing.T) {
+	server, dial := dialReplayServer(t)
+
+	host := dial("user=host")
+	guest := dial("user=guest")
+	code := createTestRoom(t, host, guest)
+
+	assert.NoError(t, host.WriteJSON(roomFrame{Action: roomCommand, Command: "play", Position: 42.5, ClientTime: 5000}))
+	for _, conn := range []*websocket.Conn{host, guest} {
+		message := readRoomMessage(t, conn)
+		assert.Equal(t, "room.state", message.Type)
+		assert.Equal(t, "play", message.Command)
+		assert.True(t, message.Room.Playing)
+		assert.Equal(t, 42.5, message.Room.Position)
+		assert.Equal(t, int64(5000), message.Room.HostTime)
+		assert.NotZero(t, message.Room.ServerTime)
+	}
+
+	// Trạng thái được lưu trong Redis để instance khác dùng chung
+	state, err := server.loadRoom(context.Background(), code)
+	assert.NoError(t, err)
+	assert.True(t, state.Playing)
+
+	// Chỉ host được điều khiển
+	assert.NoError(t, guest.WriteJSON(roomFrame{Action: roomCommand, Command: "pause", Position: 43}))
+	var reply serverReply
+	guest.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NoError(t, guest.ReadJSON(&reply))
+	assert.Equal(t, serverReply{Type: "error", Message: errNotRoomHost.Error()}, reply)
+
+	assert.NoError(t, host.WriteJSON(roomFrame{Action: roomCommand, Command: "quality", QualityID: otherQuality, Position: 44}))
+	assert.Equal(t, otherQuality, readRoomMessage(t, guest).Room.QualityID)
+}
+
+func TestRoomHostLeavingTransfersHost(t *testing.T) {
+	server, dial := dialReplayServer(t)
+
+	host := dial("user=host")
+	guest := dial("user=guest")
+	code := createTestRoom(t, host, guest)
+
+	assert.NoError(t, host.WriteJSON(roomFrame{Action: roomLeave}))
+
+	var transferred bool
+	for i := 0; i < 2; i++ {
+		message := readRoomMessage(t, guest)
+		if message.Type == "room.state" {
+			assert.Equal(t, "host", message.Command)
+			assert.Equal(t, "guest", message.Room.HostID)
+			transferred = true
+		}
+	}
+	assert.True(t, transferred)
+
+	// Phòng trống sẽ hết hạn sau RoomEmptyTTL
+	guest.Close()
+	assert.Eventually(t, func() bool {
+		ttl, err := server.redis.TTL(context.Background(), roomKey(code)).Result()
+		return err == nil && ttl > 0 && ttl <= server.Config.RoomEmptyTTL
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		members, err := server.redis.HLen(context.Background(), roomMembersKey(code)).Result()
+		return err == nil && members == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRoomHostHandoffSkipsStaleMembers(t *testing.T) {
+	server, dial := dialReplayServer(t)
+
+	host := dial("user=host")
+	guest := dial("user=guest")
+	code := createTestRoom(t, host, guest)
+
+	// Thành viên trên instance đã dừng: còn trong hash nhưng heartbeat đã quá hạn
+	ctx := context.Background()
+	stale := time.Now().Add(-2 * server.roomMemberStale()).UnixMilli()
+	assert.NoError(t, server.redis.HSet(ctx, roomMembersKey(code), "ghost", 1).Err())
+	assert.NoError(t, server.redis.ZAdd(ctx, roomSeenKey(code), &redis.Z{Score: float64(stale), Member: "ghost"}).Err())
+
+	assert.NoError(t, host.WriteJSON(roomFrame{Action: roomLeave}))
+
+	var newHost string
+	assert.Eventually(t, func() bool {
+		state, err := server.loadRoom(ctx, code)
+		if err == nil {
+			newHost = state.HostID
+		}
+		return newHost != "host"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "guest", newHost)
+
+	members, err := server.redis.HKeys(ctx, roomMembersKey(code)).Result()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"guest"}, members)
+}
+
+func TestRoomJoinUnknownCode(t *testing.T) {
+	_, dial := dialReplayServer(t)
+
+	conn := dial("user=guest")
+	assert.NoError(t, conn.WriteJSON(roomFrame{Action: roomJoin, Room: "NOPE22"}))
+
+	var reply serverReply
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NoError(t, conn.ReadJSON(&reply))
+	assert.Equal(t, errRoomNotFound.Error(), reply.Message)
+}
+
+func TestRoomTimeEchoesClientTime(t *testing.T) {
+	_, dial := dialTestServer(t)
+
+	conn := dial("user=guest")
+	assert.NoError(t, conn.WriteJSON(roomFrame{Action: roomTime, ClientTime: 123}))
+
+	message := readRoomMessage(t, conn)
+	assert.Equal(t, roomTime, message.Type)
+	assert.Equal(t, int64(123), message.ClientTime)
+	assert.InDelta(t, time.Now().UnixMilli(), message.ServerTime, 1000)
+}
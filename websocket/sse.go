@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// Chu kỳ gửi comment giữ kết nối SSE, tránh proxy đóng kết nối im lặng
+const sseKeepAlive = 25 * time.Second
+
+// HandleSSE phục vụ luồng Server-Sent Events cho một người dùng đã xác thực.
+// Client SSE dùng chung hub, topic và stream phát lại với client WebSocket:
+// /events?topics=admin:catalog,movie:<id>, kết nối lại bằng header Last-Event-ID.
+func (server *WebSocketServer) HandleSSE(c *gin.Context, userID string, role string) {
+	client := &Client{
+		Send:   make(chan []byte, server.Config.SendBufferSize),
+		Topics: make(map[string]bool),
+		UserID: userID,
+		Role:   role,
+	}
+
+	server.Register <- client
+	defer func() { server.Unregister <- client }()
+
+	for _, topic := range strings.Split(c.Query("topics"), ",") {
+		if isValidTopic(topic) && canSubscribe(client, topic) {
+			server.Subscriptions <- &Subscription{Client: client, Topic: topic, Subscribe: true}
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // Tắt buffer của nginx
+
+	// Gửi header ngay để client biết luồng đã mở trước khi có sự kiện đầu tiên
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+
+	// EventSource tự gửi Last-Event-ID khi kết nối lại, query dùng cho client tự quản lý.
+	// Phát lại sau khi luồng đã mở, replay chờ vòng lặp bên dưới đọc hàng đợi khi client lỡ nhiều sự kiện
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	if from, err := strconv.ParseInt(lastEventID, 10, 64); err == nil && from > 0 {
+		server.Resumes <- &Resume{Client: client, From: from}
+	}
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+
+		case <-ticker.C:
+			io.WriteString(w, ": ping\n\n")
+			return true
+
+		case message, ok := <-client.Send:
+			if !ok {
+				// Hub đã đóng Send (client nhận quá chậm), client sẽ tự kết nối lại với Last-Event-ID
+				return false
+			}
+			c.Render(-1, sseEvent(message))
+			return true
+		}
+	})
+}
+
+// sseEvent chuyển tin nhắn trong hàng đợi thành sự kiện SSE:
+// frame sự kiện dùng seq làm id, phản hồi của hub dùng type làm tên sự kiện
+func sseEvent(message []byte) sse.Event {
+	var frame struct {
+		Seq  int64           `json:"seq"`
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(message, &frame); err != nil || frame.Seq == 0 {
+		return sse.Event{Event: frame.Type, Data: string(message)}
+	}
+	return sse.Event{Id: strconv.FormatInt(frame.Seq, 10), Event: "message", Data: string(frame.Data)}
+}
@@ -0,0 +1,135 @@
+package websocket
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// openSSE khởi động hub có Redis, mở luồng /events và trả về bộ đọc các dòng của luồng
+func openSSE(t *testing.T, prepare func(server *WebSocketServer), query string, lastEventID string) (*WebSocketServer, *bufio.Reader) {
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	server := NewWebSocketServer()
+	go server.Run()
+	server.EnableRedisRelay(redisClient)
+	if prepare != nil {
+		prepare(server)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/events", func(c *gin.Context) {
+		server.HandleSSE(c, "u1", c.Query("role"))
+	})
+	httpServer := httptest.NewServer(router)
+	t.Cleanup(httpServer.Close)
+
+	request, err := http.NewRequest(http.MethodGet, httpServer.URL+"/events?"+query, nil)
+	assert.NoError(t, err)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("open /events: %v", err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	return server, bufio.NewReader(response.Body)
+}
+
+// readSSEEvent đọc một sự kiện SSE (các dòng tới dòng trống), bỏ qua comment giữ kết nối
+func readSSEEvent(t *testing.T, reader *bufio.Reader) map[string]string {
+	event := map[string]string{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\n")
+			if line == "" {
+				if len(event) > 0 {
+					return
+				}
+				continue
+			}
+			if strings.HasPrefix(line, ":") {
+				continue
+			}
+			key, value, _ := strings.Cut(line, ":")
+			event[key] = value
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for SSE event")
+	}
+	return event
+}
+
+func TestSSEDeliversSubscribedTopics(t *testing.T) {
+	server, reader := openSSE(t, nil, "role=user&topics="+MovieTopic(testMovieID)+","+TopicAdminCatalog, "")
+
+	// Client không phải admin không nhận được topic admin
+	server.Publish([]byte(`{"entity":"category"}`), TopicAdminCatalog)
+	server.Publish([]byte(`{"entity":"quality"}`), MovieTopic(testMovieID))
+
+	event := readSSEEvent(t, reader)
+	assert.Equal(t, "2", event["id"])
+	assert.Equal(t, "message", event["event"])
+	assert.Equal(t, `{"entity":"quality"}`, event["data"])
+}
+
+func TestSSEReplaysFromLastEventID(t *testing.T) {
+	publishMissed := func(server *WebSocketServer) {
+		server.Publish([]byte(`{"entity":"movie","id":"1"}`), TopicAdminCatalog)
+		server.Publish([]byte(`{"entity":"movie","id":"2"}`), TopicAdminCatalog)
+		server.Publish([]byte(`{"entity":"movie","id":"3"}`), TopicAdminCatalog)
+	}
+	server, reader := openSSE(t, publishMissed, "role=admin&topics="+TopicAdminCatalog, "1")
+
+	assert.Equal(t, "2", readSSEEvent(t, reader)["id"])
+	assert.Equal(t, "3", readSSEEvent(t, reader)["id"])
+
+	server.Publish([]byte(`{"entity":"movie","id":"4"}`), TopicAdminCatalog)
+	assert.Equal(t, "4", readSSEEvent(t, reader)["id"])
+}
+
+func TestSSEResumesPastSendBuffer(t *testing.T) {
+	var total int
+	publishMissed := func(server *WebSocketServer) {
+		total = 2*server.Config.SendBufferSize + 10
+		for i := 0; i < total; i++ {
+			server.Publish([]byte(`{"entity":"movie"}`), TopicAdminCatalog)
+		}
+	}
+	server, reader := openSSE(t, publishMissed, "role=admin&topics="+TopicAdminCatalog, "1")
+
+	// Client lỡ nhiều sự kiện hơn hàng đợi vẫn nhận đủ, không bị loại vì nhận chậm
+	for seq := 2; seq <= total; seq++ {
+		assert.Equal(t, strconv.Itoa(seq), readSSEEvent(t, reader)["id"])
+	}
+	assert.Zero(t, server.Stats().Evicted)
+
+	server.Publish([]byte(`{"entity":"movie"}`), TopicAdminCatalog)
+	assert.Equal(t, strconv.Itoa(total+1), readSSEEvent(t, reader)["id"])
+}
@@ -0,0 +1,34 @@
+package websocket
+
+import "sync/atomic"
+
+// counters đếm tin nhắn của hub, an toàn khi đọc từ goroutine khác
+type counters struct {
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	evicted   atomic.Uint64
+}
+
+// Stats là ảnh chụp số liệu của hub
+type Stats struct {
+	Clients   int    `json:"clients"`
+	Topics    int    `json:"topics"`
+	Delivered uint64 `json:"delivered"` // Tin nhắn đã đưa vào hàng đợi của client
+	Dropped   uint64 `json:"dropped"`   // Tin nhắn bị bỏ do hàng đợi đầy
+	Evicted   uint64 `json:"evicted"`   // Client bị ngắt vì nhận quá chậm
+}
+
+// Stats trả về số liệu hiện tại của hub
+func (server *WebSocketServer) Stats() Stats {
+	server.Mutex.Lock()
+	clients, topics := len(server.Clients), len(server.Topics)
+	server.Mutex.Unlock()
+
+	return Stats{
+		Clients:   clients,
+		Topics:    topics,
+		Delivered: server.stats.delivered.Load(),
+		Dropped:   server.stats.dropped.Load(),
+		Evicted:   server.stats.evicted.Load(),
+	}
+}
@@ -0,0 +1,40 @@
+package websocket
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TopicAdminCatalog nhận mọi thay đổi của danh mục, thể loại, quốc gia, server và phim trong trang admin
+const TopicAdminCatalog = "admin:catalog"
+
+// TopicAdminSecurity nhận các cảnh báo bảo mật cho admin, ví dụ tài khoản admin bị khóa
+const TopicAdminSecurity = "admin:security"
+
+// Số topic tối đa một client được đăng ký cùng lúc
+const maxTopicsPerClient = 50
+
+// MovieTopic nhận các thay đổi của một bộ phim (chi tiết, qualities)
+func MovieTopic(movieID string) string {
+	return "movie:" + movieID
+}
+
+// EpisodeTopic nhận các thay đổi danh sách tập của một bộ phim
+func EpisodeTopic(movieID string) string {
+	return "episode:" + movieID
+}
+
+// isValidTopic chỉ chấp nhận các topic mà server thực sự publish
+func isValidTopic(topic string) bool {
+	if topic == TopicAdminCatalog || topic == TopicAdminSecurity {
+		return true
+	}
+
+	for _, prefix := range []string{"movie:", "episode:"} {
+		if id, ok := strings.CutPrefix(topic, prefix); ok {
+			return primitive.IsValidObjectID(id)
+		}
+	}
+	return false
+}
@@ -1,35 +1,96 @@
 package websocket
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/websocket"
 )
 
 // Client đại diện cho một kết nối WebSocket
 type Client struct {
-	Conn *websocket.Conn
-	Send chan []byte
+	Conn   *websocket.Conn
+	Send   chan []byte
+	Topics map[string]bool // Các topic client đã đăng ký
+	UserID string          // Người dùng đã xác thực khi nâng cấp kết nối
+	Role   string
+
+	Room       string // Mã phòng xem chung client đang tham gia, chỉ dùng trong goroutine đọc
+	evicted    bool   // Được đặt trước khi đóng Send nếu client bị loại vì nhận quá chậm
+	replayedTo int64  // Số thứ tự lớn nhất đã phát lại, sự kiện trực tiếp cũ hơn sẽ bị bỏ qua
+	replaying  bool   // Đang phát lại, sự kiện trực tiếp có số thứ tự được gửi qua replay
+	skippedTo  int64  // Số thứ tự lớn nhất hub đã bỏ qua trong lúc phát lại
+}
+
+// Message là một tin nhắn gửi tới các client đã đăng ký ít nhất một trong các topic
+type Message struct {
+	Seq    int64
+	Topics []string
+	Data   []byte // Frame đã bọc số thứ tự, gửi nguyên văn cho client
+}
+
+// Subscription là yêu cầu đăng ký hoặc hủy đăng ký một topic của client
+type Subscription struct {
+	Client    *Client
+	Topic     string
+	Subscribe bool
+}
+
+// clientFrame là frame điều khiển client gửi lên server
+type clientFrame struct {
+	Action     string `json:"action"` // "subscribe", "unsubscribe" hoặc "resume"
+	Topic      string `json:"topic"`
+	ResumeFrom int64  `json:"resume_from"` // Số thứ tự cuối cùng client đã nhận, dùng với "resume"
+}
+
+// serverReply là phản hồi chỉ gửi riêng cho client đã gửi frame
+type serverReply struct {
+	Type    string `json:"type"`
+	Topic   string `json:"topic,omitempty"`
+	Message string `json:"message,omitempty"`
 }
 
 // WebSocketServer quản lý tất cả các kết nối WebSocket
 type WebSocketServer struct {
-	Clients    map[*Client]bool
-	Broadcast  chan []byte
-	Register   chan *Client
-	Unregister chan *Client
-	Mutex      sync.Mutex
+	Clients        map[*Client]bool
+	Topics         map[string]map[*Client]bool // Chỉ mục client theo topic
+	Broadcast      chan *Message
+	Register       chan *Client
+	Unregister     chan *Client
+	Subscriptions  chan *Subscription
+	Resumes        chan *Resume
+	Mutex          sync.Mutex
+	AllowedOrigins []string // Các origin được phép kết nối, rỗng thì chỉ chấp nhận cùng host
+	InstanceID     string   // ID của process, dùng để bỏ qua tin nhắn của chính mình khi relay
+	Config         Config
+	redis          *redis.Client // Nil nếu chỉ gửi tin nhắn cục bộ
+	stats          counters
+	localSeq       atomic.Int64              // Số thứ tự dùng khi không có Redis
+	rooms          map[string]map[string]int // Phòng xem chung -> user ID -> số client cục bộ, được bảo vệ bởi Mutex
 }
 
 // NewWebSocketServer tạo một WebSocket server mới
 func NewWebSocketServer() *WebSocketServer {
 	return &WebSocketServer{
-		Clients:    make(map[*Client]bool),
-		Broadcast:  make(chan []byte),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
+		Clients:        make(map[*Client]bool),
+		Topics:         make(map[string]map[*Client]bool),
+		Broadcast:      make(chan *Message),
+		Register:       make(chan *Client),
+		Unregister:     make(chan *Client),
+		Subscriptions:  make(chan *Subscription),
+		Resumes:        make(chan *Resume),
+		rooms:          make(map[string]map[string]int),
+		InstanceID:     newInstanceID(),
+		AllowedOrigins: parseAllowedOrigins(os.Getenv("WS_ALLOWED_ORIGINS")),
+		Config:         LoadConfig(),
 	}
 }
 
@@ -46,31 +107,120 @@ func (server *WebSocketServer) Run() {
 		case client := <-server.Unregister:
 			server.Mutex.Lock()
 			if _, ok := server.Clients[client]; ok {
-				delete(server.Clients, client)
-				close(client.Send)
+				server.removeClient(client)
 				log.Println("Client disconnected")
 			}
 			server.Mutex.Unlock()
 
+		case sub := <-server.Subscriptions:
+			server.Mutex.Lock()
+			if _, ok := server.Clients[sub.Client]; ok {
+				if sub.Subscribe {
+					server.subscribe(sub.Client, sub.Topic)
+				} else {
+					server.unsubscribe(sub.Client, sub.Topic)
+				}
+			}
+			server.Mutex.Unlock()
+
+		case resume := <-server.Resumes:
+			server.Mutex.Lock()
+			if _, ok := server.Clients[resume.Client]; ok {
+				server.startReplay(resume.Client, resume.From)
+			}
+			server.Mutex.Unlock()
+
 		case message := <-server.Broadcast:
 			server.Mutex.Lock()
-			for client := range server.Clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(server.Clients, client)
+			for client := range server.recipients(message.Topics) {
+				// Sự kiện đã được gửi trong lúc phát lại
+				if message.Seq > 0 && message.Seq <= client.replayedTo {
+					continue
 				}
+				// Sự kiện sẽ được replay đọc từ stream, gửi ngay bây giờ sẽ sai thứ tự
+				if message.Seq > 0 && client.replaying {
+					if message.Seq > client.skippedTo {
+						client.skippedTo = message.Seq
+					}
+					continue
+				}
+				server.deliver(client, message.Data)
 			}
 			server.Mutex.Unlock()
 		}
 	}
 }
 
-// HandleConnections xử lý yêu cầu kết nối WebSocket
-func (server *WebSocketServer) HandleConnections(w http.ResponseWriter, r *http.Request) {
+// deliver đưa tin nhắn vào hàng đợi của client, loại client nếu hàng đợi đã đầy.
+// Phải được gọi khi đang giữ Mutex.
+func (server *WebSocketServer) deliver(client *Client, data []byte) bool {
+	select {
+	case client.Send <- data:
+		server.stats.delivered.Add(1)
+		return true
+	default:
+		// Hàng đợi đầy: loại client thay vì chặn cả hub
+		server.stats.dropped.Add(1)
+		server.evict(client)
+		return false
+	}
+}
+
+// evict loại client nhận quá chậm, phải được gọi khi đang giữ Mutex
+func (server *WebSocketServer) evict(client *Client) {
+	server.stats.evicted.Add(1)
+	client.evicted = true
+	server.removeClient(client)
+	log.Println("Evicted slow WebSocket client:", client.UserID)
+}
+
+// subscribe thêm client vào topic, phải được gọi khi đang giữ Mutex
+func (server *WebSocketServer) subscribe(client *Client, topic string) {
+	if len(client.Topics) >= maxTopicsPerClient {
+		return
+	}
+	client.Topics[topic] = true
+	if server.Topics[topic] == nil {
+		server.Topics[topic] = make(map[*Client]bool)
+	}
+	server.Topics[topic][client] = true
+}
+
+// unsubscribe bỏ client khỏi topic, phải được gọi khi đang giữ Mutex
+func (server *WebSocketServer) unsubscribe(client *Client, topic string) {
+	delete(client.Topics, topic)
+	if subscribers, ok := server.Topics[topic]; ok {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(server.Topics, topic)
+		}
+	}
+}
+
+// removeClient gỡ client khỏi server và mọi topic, phải được gọi khi đang giữ Mutex
+func (server *WebSocketServer) removeClient(client *Client) {
+	for topic := range client.Topics {
+		server.unsubscribe(client, topic)
+	}
+	delete(server.Clients, client)
+	close(client.Send)
+}
+
+// recipients trả về tập client đã đăng ký ít nhất một topic, mỗi client chỉ xuất hiện một lần
+func (server *WebSocketServer) recipients(topics []string) map[*Client]bool {
+	result := make(map[*Client]bool)
+	for _, topic := range topics {
+		for client := range server.Topics[topic] {
+			result[client] = true
+		}
+	}
+	return result
+}
+
+// HandleConnections xử lý yêu cầu kết nối WebSocket của một người dùng đã xác thực
+func (server *WebSocketServer) HandleConnections(w http.ResponseWriter, r *http.Request, userID string, role string) {
 	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true }, // Cho phép kết nối từ bất kỳ domain nào
+		CheckOrigin: server.checkOrigin,
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -79,25 +229,54 @@ func (server *WebSocketServer) HandleConnections(w http.ResponseWriter, r *http.
 		return
 	}
 
-	client := &Client{Conn: conn, Send: make(chan []byte)}
+	client := &Client{
+		Conn:   conn,
+		Send:   make(chan []byte, server.Config.SendBufferSize),
+		Topics: make(map[string]bool),
+		UserID: userID,
+		Role:   role,
+	}
 
 	// Đăng ký client mới
 	server.Register <- client
 
-	// Đọc tin nhắn từ client và gửi vào channel Broadcast
-	go server.handleMessages(client)
-
-	// Gửi tin nhắn từ channel Send về lại client
+	// Gửi tin nhắn từ channel Send về lại client. Phải chạy trước khi phát lại,
+	// nếu không hàng đợi sẽ đầy khi client lỡ nhiều sự kiện
 	go server.sendMessages(client)
+
+	// Client kết nối lại có thể đăng ký topic và yêu cầu phát lại ngay trong URL:
+	// /ws?topics=admin:catalog&resume_from=<seq>
+	query := r.URL.Query()
+	if topics := query.Get("topics"); topics != "" {
+		for _, topic := range strings.Split(topics, ",") {
+			if isValidTopic(topic) && canSubscribe(client, topic) {
+				server.Subscriptions <- &Subscription{Client: client, Topic: topic, Subscribe: true}
+			}
+		}
+	}
+	if from, err := strconv.ParseInt(query.Get("resume_from"), 10, 64); err == nil && from > 0 {
+		server.Resumes <- &Resume{Client: client, From: from}
+	}
+
+	// Đọc frame điều khiển từ client
+	go server.handleMessages(client)
 }
 
-// handleMessages xử lý tin nhắn đến từ client
+// handleMessages xử lý frame subscribe/unsubscribe đến từ client, không phát lại cho client khác
 func (server *WebSocketServer) handleMessages(client *Client) {
 	defer func() {
+		server.leaveRoom(client)
 		server.Unregister <- client
 		client.Conn.Close()
 	}()
 
+	// Mỗi pong gia hạn thời gian đọc, kết nối nửa mở sẽ hết hạn sau PongWait
+	client.Conn.SetReadLimit(server.Config.MaxMessageSize)
+	client.Conn.SetReadDeadline(time.Now().Add(server.Config.PongWait))
+	client.Conn.SetPongHandler(func(string) error {
+		return client.Conn.SetReadDeadline(time.Now().Add(server.Config.PongWait))
+	})
+
 	for {
 		_, message, err := client.Conn.ReadMessage()
 		if err != nil {
@@ -109,23 +288,127 @@ func (server *WebSocketServer) handleMessages(client *Client) {
 			break
 		}
 
-		// Gửi tin nhắn tới tất cả các client
-		server.Broadcast <- message
+		var frame clientFrame
+		if err := json.Unmarshal(message, &frame); err != nil {
+			server.reply(client, serverReply{Type: "error", Message: "Invalid frame"})
+			continue
+		}
+
+		switch frame.Action {
+		case "subscribe", "unsubscribe":
+			if !isValidTopic(frame.Topic) {
+				server.reply(client, serverReply{Type: "error", Topic: frame.Topic, Message: "Unknown topic"})
+				continue
+			}
+			if !canSubscribe(client, frame.Topic) {
+				server.reply(client, serverReply{Type: "error", Topic: frame.Topic, Message: "Forbidden topic"})
+				continue
+			}
+			server.Subscriptions <- &Subscription{Client: client, Topic: frame.Topic, Subscribe: frame.Action == "subscribe"}
+			server.reply(client, serverReply{Type: frame.Action + "d", Topic: frame.Topic})
+		case "resume":
+			server.Resumes <- &Resume{Client: client, From: frame.ResumeFrom}
+		case roomCreate, roomJoin, roomLeave, roomCommand, roomTime:
+			server.handleRoomFrame(client, message)
+		default:
+			server.reply(client, serverReply{Type: "error", Message: "Unknown action"})
+		}
+	}
+}
+
+// reply gửi phản hồi trực tiếp cho một client qua channel Send của nó
+func (server *WebSocketServer) reply(client *Client, reply interface{}) {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+
+	server.Mutex.Lock()
+	defer server.Mutex.Unlock()
+	if _, ok := server.Clients[client]; !ok {
+		return
+	}
+	server.sendReply(client, data)
+}
+
+// replyLocked giống reply nhưng dùng khi đang giữ Mutex
+func (server *WebSocketServer) replyLocked(client *Client, reply interface{}) {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return
 	}
+	server.sendReply(client, data)
 }
-// Gửi tin nhắn tới tất cả client khi có sự kiện xảy ra
-func (server *WebSocketServer) BroadcastMessage(message []byte) {
-    server.Broadcast <- message // Đẩy tin nhắn vào channel Broadcast
+
+func (server *WebSocketServer) sendReply(client *Client, data []byte) {
+	select {
+	case client.Send <- data:
+	default:
+		server.stats.dropped.Add(1)
+	}
 }
 
-// sendMessages gửi tin nhắn từ server đến client
+// Publish gửi tin nhắn tới các client đã đăng ký một trong các topic,
+// trên instance này và trên các instance khác nếu đã bật Redis relay
+func (server *WebSocketServer) Publish(message []byte, topics ...string) {
+	seq, ok := server.nextSequence(message, topics)
+	if !ok {
+		// Không lưu được sự kiện nên không có số thứ tự để resume,
+		// client cần tự tải lại dữ liệu thay vì nhận một số thứ tự không khớp với stream
+		reply, _ := json.Marshal(serverReply{Type: "resync"})
+		server.publishTransient(reply, topics...)
+		return
+	}
+	msg := &Message{Seq: seq, Topics: topics, Data: encodeFrame(seq, message)}
+	server.broadcast(msg)
+}
+
+// publishTransient gửi tin nhắn không đánh số và không lưu để phát lại,
+// dùng cho các tin nhắn tần suất cao như lệnh phát của phòng xem chung
+func (server *WebSocketServer) publishTransient(message []byte, topics ...string) {
+	server.broadcast(&Message{Topics: topics, Data: message})
+}
+
+func (server *WebSocketServer) broadcast(msg *Message) {
+	server.Broadcast <- msg
+
+	if server.redis != nil {
+		server.publishRemote(msg)
+	}
+}
+
+// sendMessages gửi tin nhắn từ server đến client và ping định kỳ để giữ kết nối
 func (server *WebSocketServer) sendMessages(client *Client) {
-	defer client.Conn.Close()
-	for message := range client.Send {
-		err := client.Conn.WriteMessage(websocket.TextMessage, message)
-		if err != nil {
-			log.Println("Error sending message:", err)
-			break
+	ticker := time.NewTicker(server.Config.PingInterval)
+	defer func() {
+		ticker.Stop()
+		client.Conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-client.Send:
+			client.Conn.SetWriteDeadline(time.Now().Add(server.Config.WriteWait))
+			if !ok {
+				// Hub đã đóng Send: gửi close frame với lý do phù hợp
+				closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+				if client.evicted {
+					closeMessage = websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer")
+				}
+				client.Conn.WriteMessage(websocket.CloseMessage, closeMessage)
+				return
+			}
+
+			if err := client.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				log.Println("Error sending message:", err)
+				return
+			}
+
+		case <-ticker.C:
+			client.Conn.SetWriteDeadline(time.Now().Add(server.Config.WriteWait))
+			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
 		}
 	}
 }
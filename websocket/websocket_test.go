@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMovieID = "64b7f0c2a1b2c3d4e5f60718"
+
+// dialTestServer khởi động hub và trả về hàm mở kết nối WebSocket tới nó với query cho trước,
+// trong đó tham số user và role giả lập người dùng đã xác thực
+func dialTestServer(t *testing.T) (*WebSocketServer, func(query string) *websocket.Conn) {
+	server := NewWebSocketServer()
+	go server.Run()
+
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.URL.Query().Get("user")
+		if userID == "" {
+			userID = "u1"
+		}
+		server.HandleConnections(w, r, userID, r.URL.Query().Get("role"))
+	}))
+	t.Cleanup(httpServer.Close)
+
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+	return server, func(query string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?"+query, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+}
+
+func subscribeTo(t *testing.T, conn *websocket.Conn, topic string) {
+	assert.NoError(t, conn.WriteJSON(clientFrame{Action: "subscribe", Topic: topic}))
+
+	var reply serverReply
+	assert.NoError(t, conn.ReadJSON(&reply))
+	assert.Equal(t, serverReply{Type: "subscribed", Topic: topic}, reply)
+}
+
+func readWithTimeout(conn *websocket.Conn, timeout time.Duration) ([]byte, error) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, data, err := conn.ReadMessage()
+	return data, err
+}
+
+// eventText giải mã frame sự kiện có dữ liệu dạng chuỗi
+func eventText(t *testing.T, data []byte) string {
+	var frame eventFrame
+	assert.NoError(t, json.Unmarshal(data, &frame))
+	assert.Positive(t, frame.Seq)
+
+	var text string
+	assert.NoError(t, json.Unmarshal(frame.Data, &text))
+	return text
+}
+
+func TestPublishOnlyReachesSubscribers(t *testing.T) {
+	server, dial := dialTestServer(t)
+
+	catalog := dial("role=admin")
+	movie := dial("role=admin")
+	subscribeTo(t, catalog, TopicAdminCatalog)
+	subscribeTo(t, movie, MovieTopic(testMovieID))
+
+	server.Publish([]byte("catalog changed"), TopicAdminCatalog)
+
+	data, err := readWithTimeout(catalog, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "catalog changed", eventText(t, data))
+
+	_, err = readWithTimeout(movie, 100*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestPublishDeliversOncePerClient(t *testing.T) {
+	server, dial := dialTestServer(t)
+
+	conn := dial("role=admin")
+	subscribeTo(t, conn, TopicAdminCatalog)
+	subscribeTo(t, conn, MovieTopic(testMovieID))
+
+	server.Publish([]byte("quality changed"), MovieTopic(testMovieID), TopicAdminCatalog)
+
+	data, err := readWithTimeout(conn, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "quality changed", eventText(t, data))
+
+	_, err = readWithTimeout(conn, 100*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestClientMessagesAreNotEchoed(t *testing.T) {
+	_, dial := dialTestServer(t)
+
+	sender := dial("role=admin")
+	listener := dial("role=admin")
+	subscribeTo(t, listener, TopicAdminCatalog)
+
+	assert.NoError(t, sender.WriteMessage(websocket.TextMessage, []byte("hello everyone")))
+
+	var reply serverReply
+	sender.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NoError(t, sender.ReadJSON(&reply))
+	assert.Equal(t, "error", reply.Type)
+
+	_, err := readWithTimeout(listener, 100*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestSubscribeRejectsUnknownTopic(t *testing.T) {
+	_, dial := dialTestServer(t)
+
+	conn := dial("role=admin")
+	assert.NoError(t, conn.WriteJSON(clientFrame{Action: "subscribe", Topic: "movie:not-an-id"}))
+
+	var reply serverReply
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NoError(t, conn.ReadJSON(&reply))
+	assert.Equal(t, "error", reply.Type)
+	assert.Equal(t, "movie:not-an-id", reply.Topic)
+}
+
+func TestAdminTopicsRequireAdminRole(t *testing.T) {
+	_, dial := dialTestServer(t)
+
+	conn := dial("role=user")
+	assert.NoError(t, conn.WriteJSON(clientFrame{Action: "subscribe", Topic: TopicAdminCatalog}))
+
+	var reply serverReply
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NoError(t, conn.ReadJSON(&reply))
+	assert.Equal(t, serverReply{Type: "error", Topic: TopicAdminCatalog, Message: "Forbidden topic"}, reply)
+
+	subscribeTo(t, conn, MovieTopic(testMovieID))
+}
+
+func TestCheckOrigin(t *testing.T) {
+	server := NewWebSocketServer()
+
+	request := httptest.NewRequest(http.MethodGet, "http://localhost:8080/ws", nil)
+	request.Header.Set("Origin", "http://localhost:8080")
+	assert.True(t, server.checkOrigin(request))
+
+	request.Header.Set("Origin", "http://evil.example")
+	assert.False(t, server.checkOrigin(request))
+
+	server.AllowedOrigins = parseAllowedOrigins(" https://admin.example/ , http://localhost:3000")
+	assert.False(t, server.checkOrigin(request))
+
+	request.Header.Set("Origin", "https://Admin.example")
+	assert.True(t, server.checkOrigin(request))
+}
+
+func TestSlowConsumerIsEvicted(t *testing.T) {
+	server := NewWebSocketServer()
+	server.Config.SendBufferSize = 2
+	go server.Run()
+
+	// Client không có writer nên hàng đợi sẽ đầy sau SendBufferSize tin nhắn
+	client := &Client{Send: make(chan []byte, server.Config.SendBufferSize), Topics: make(map[string]bool), Role: "admin"}
+	server.Register <- client
+	server.Subscriptions <- &Subscription{Client: client, Topic: TopicAdminCatalog, Subscribe: true}
+
+	for i := 0; i < 3; i++ {
+		server.Publish([]byte("movie changed"), TopicAdminCatalog)
+	}
+
+	assert.Eventually(t, func() bool {
+		return server.Stats() == Stats{Clients: 0, Topics: 0, Delivered: 2, Dropped: 1, Evicted: 1}
+	}, time.Second, 10*time.Millisecond)
+
+	// Hub đánh dấu client bị loại rồi đóng Send để writer gửi close frame
+	server.Mutex.Lock()
+	assert.True(t, client.evicted)
+	server.Mutex.Unlock()
+	assert.Len(t, client.Send, 2)
+	<-client.Send
+	<-client.Send
+	_, ok := <-client.Send
+	assert.False(t, ok)
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("WS_SEND_BUFFER", "8")
+	t.Setenv("WS_PONG_WAIT", "10s")
+	t.Setenv("WS_PING_INTERVAL", "30s")
+	t.Setenv("WS_WRITE_WAIT", "bogus")
+
+	config := LoadConfig()
+	assert.Equal(t, 8, config.SendBufferSize)
+	assert.Equal(t, 10*time.Second, config.PongWait)
+	assert.Equal(t, 9*time.Second, config.PingInterval)
+	assert.Equal(t, DefaultConfig().WriteWait, config.WriteWait)
+}